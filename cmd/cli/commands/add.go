@@ -1,7 +1,9 @@
 package commands
 
 import (
+	"dspn-regogenerator/internal/policy/parser"
 	"dspn-regogenerator/internal/usecases"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -10,7 +12,17 @@ import (
 )
 
 var (
-	openAPISpec string
+	openAPISpec      string
+	timelinessSource string
+	locationSource   string
+	audience         string
+	clockSkew        string
+	pinKeys          bool
+	pinnedKeysFile   string
+	pathPrefix       string
+	hosts            []string
+	matchHosts       bool
+	extAuthzResult   bool
 )
 
 func loadSpecFile(specFile string) ([]byte, error) {
@@ -40,7 +52,35 @@ var AddCmd = &cobra.Command{
 			return
 		}
 
-		err = usecases.AddService(serviceName, specData)
+		var pinnedKeys []byte
+		if pinnedKeysFile != "" {
+			if pinnedKeys, err = os.ReadFile(pinnedKeysFile); err != nil {
+				slog.Error("Error loading pinned keys file", "error", err)
+				return
+			}
+		}
+
+		diagnostics, err := usecases.AddService(serviceName, specData, usecases.ServiceConfig{
+			TimelinessSource: timelinessSource,
+			LocationSource:   locationSource,
+			Audience:         audience,
+			ClockSkew:        clockSkew,
+			PinKeys:          pinKeys,
+			PinnedKeys:       pinnedKeys,
+			PathPrefix:       pathPrefix,
+			Hosts:            hosts,
+			MatchHosts:       matchHosts,
+			ExtAuthzResult:   extAuthzResult,
+			Actor:            cliActor(),
+		})
+		// Show every problem found in the spec, prefixed by its file name
+		for _, diagnostic := range diagnostics {
+			cmd.PrintErrf("%s: %s\n", openAPISpec, diagnostic)
+		}
+		if errors.As(err, &parser.Diagnostics{}) {
+			slog.Error("Invalid OpenAPI spec", "serviceName", serviceName, "errors", len(diagnostics))
+			return
+		}
 		if err != nil {
 			slog.Error("Error adding service", "serviceName", serviceName, "error", err)
 			return
@@ -50,5 +90,15 @@ var AddCmd = &cobra.Command{
 
 func init() {
 	AddCmd.Flags().StringVar(&openAPISpec, "spec", "", "OpenAPI spec filename (required)")
+	AddCmd.Flags().StringVar(&timelinessSource, "timeliness-source", "", "Attribute holding the data timestamp for timeliness policies, as <header|query|claim>:<name> (default header:x-data-timestamp)")
+	AddCmd.Flags().StringVar(&locationSource, "location-source", "", "Attribute holding the location for storage location policies, as <header|query|claim>:<name> (default claim:location)")
+	AddCmd.Flags().StringVar(&audience, "audience", "", "Audience the tokens must be issued for (default any audience)")
+	AddCmd.Flags().StringVar(&clockSkew, "clock-skew", "", "Clock skew tolerated when checking the expiration of the tokens, e.g. 30s (default 0s)")
+	AddCmd.Flags().BoolVar(&pinKeys, "pin-keys", false, "Fetch the keys of the identity providers and pin them in the bundle, so that OPA verifies the tokens without reaching the providers")
+	AddCmd.Flags().StringVar(&pinnedKeysFile, "pinned-keys", "", "JSON file mapping each issuer to its JWKS, pinned in the bundle instead of fetching the keys")
+	AddCmd.Flags().StringVar(&pathPrefix, "path-prefix", "", "Path prefix of the requests addressed to the service, / for none (default the base path of the servers of the spec, or /<service name>)")
+	AddCmd.Flags().StringSliceVar(&hosts, "hosts", nil, "Comma separated host names the requests must be addressed to (default any host)")
+	AddCmd.Flags().BoolVar(&matchHosts, "match-hosts", false, "Accept only the requests addressed to the hosts of the servers of the spec")
+	AddCmd.Flags().BoolVar(&extAuthzResult, "ext-authz-result", false, "Generate the Envoy ext_authz result object, with the user in the headers and the deny reason in the body")
 	AddCmd.MarkFlagRequired("spec")
 }
@@ -20,7 +20,7 @@ var DeleteCmd = &cobra.Command{
 			return
 		}
 
-		err := usecases.DeleteService(serviceName)
+		err := usecases.DeleteService(serviceName, cliActor())
 		if err != nil {
 			slog.Error("Error deleting service", "serviceName", serviceName, "error", err)
 		}
@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"dspn-regogenerator/internal/usecases"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffJSON bool
+)
+
+func init() {
+	DiffCmd.Flags().BoolVar(&diffJSON, "json", false, "Print the changes as JSON")
+}
+
+var DiffCmd = &cobra.Command{
+	Use:   "diff [--json] <tag A> <tag B>",
+	Short: "Show the changes between two versions of the bundle",
+	Long:  `Compare two versions of the bundle, as listed by the history command, printing the added and removed services, the unified diff of the changed modules, the changed data documents and the manifest changes.`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		changes, err := usecases.DiffBundles(args[0], args[1])
+		if err != nil {
+			slog.Error("Error comparing bundles", "error", err)
+			return
+		}
+		out := cmd.OutOrStdout()
+		if diffJSON {
+			encoded, err := json.MarshalIndent(changes, "", "  ")
+			if err != nil {
+				slog.Error("Error encoding changes", "error", err)
+				return
+			}
+			fmt.Fprintln(out, string(encoded))
+			return
+		}
+
+		if changes.Empty() {
+			fmt.Fprintln(out, "No changes")
+			return
+		}
+		if len(changes.AddedServices) > 0 {
+			fmt.Fprintln(out, "Added services:", strings.Join(changes.AddedServices, ", "))
+		}
+		if len(changes.RemovedServices) > 0 {
+			fmt.Fprintln(out, "Removed services:", strings.Join(changes.RemovedServices, ", "))
+		}
+		for _, module := range changes.Modules {
+			fmt.Fprintf(out, "\nModule %s %s\n%s", module.Path, module.Status, module.Diff)
+		}
+		if len(changes.Data) > 0 {
+			fmt.Fprintln(out, "\nData:")
+			for _, change := range changes.Data {
+				fmt.Fprintf(out, "    %s %s: %s -> %s\n", change.Status, change.Path, jsonValue(change.Before), jsonValue(change.After))
+			}
+		}
+		if len(changes.Manifest) > 0 {
+			fmt.Fprintln(out, "\nManifest:")
+			for _, change := range changes.Manifest {
+				fmt.Fprintf(out, "    %s: %s -> %s\n", change.Field, jsonValue(change.Before), jsonValue(change.After))
+			}
+		}
+	},
+}
+
+// jsonValue encodes a value of the bundle as JSON for the output, "-" if it is missing.
+func jsonValue(value interface{}) string {
+	if value == nil {
+		return "-"
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "?"
+	}
+	return string(encoded)
+}
@@ -27,13 +27,14 @@ var GetCmd = &cobra.Command{
 			slog.Error("Error creating minio repository", "error", err)
 			return
 		}
-		b, err := minioRepo.Read(config.LatestBundleName)
+		// The archive is copied as is, keeping the signatures and the revision of the published bundle
+		archive, err := minioRepo.ReadArchive(config.LatestBundleName)
 		if err != nil {
 			slog.Error("Error reading bundle from Minio", "error", err)
 			return
 		}
 		fileRepo := bundle.NewFileSystemRepository(outputDir)
-		if err := fileRepo.Write(config.LatestBundleName, *b); err != nil {
+		if err := fileRepo.WriteArchive(config.LatestBundleName, archive); err != nil {
 			slog.Error("Error writing bundle to file system", "error", err)
 			return
 		}
@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"dspn-regogenerator/internal/usecases"
+	"fmt"
+	"log/slog"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var HistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the versions of the bundle",
+	Long:  `List the latest bundle and its timestamped backups, from the most recent one, with the revision, the services and the actor of each write.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		versions, err := usecases.History()
+		if err != nil {
+			slog.Error("Error listing bundle history", "error", err)
+			return
+		}
+		writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "TAG\tTIMESTAMP\tREVISION\tACTOR\tSERVICES")
+		for _, version := range versions {
+			actor := version.Actor
+			if version.RollbackOf != "" {
+				actor += " (rollback)"
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", version.Tag, version.Timestamp.Local().Format(time.DateTime),
+				version.Revision, actor, strings.Join(version.Services, ", "))
+		}
+		writer.Flush()
+	},
+}
+
+var RollbackCmd = &cobra.Command{
+	Use:   "rollback <tag>",
+	Short: "Restore a previous version of the bundle",
+	Long:  `Replace the latest bundle with the version with the tag, as listed by the history command. The latest bundle is backed up first and the rollback is recorded as a new revision.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := usecases.Rollback(args[0], cliActor()); err != nil {
+			slog.Error("Error rolling back bundle", "tag", args[0], "error", err)
+		}
+	},
+}
+
+// cliActor returns the name of the user running the command, recorded in the history of the bundle.
+func cliActor() string {
+	current, err := user.Current()
+	if err != nil {
+		return "cli"
+	}
+	return current.Username
+}
@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"dspn-regogenerator/internal/usecases"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneDryRun   bool
+	pruneKeepLast int
+	pruneKeepDays int
+)
+
+func init() {
+	PruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "List the backups that would be deleted without deleting them")
+	PruneCmd.Flags().IntVar(&pruneKeepLast, "keep-last", 0, "Number of most recent backups to keep, overriding BUNDLE_RETENTION_COUNT")
+	PruneCmd.Flags().IntVar(&pruneKeepDays, "keep-days", 0, "Number of days the backups are kept, overriding BUNDLE_RETENTION_DAYS")
+}
+
+var PruneCmd = &cobra.Command{
+	Use:   "prune [--dry-run] [--keep-last <count>] [--keep-days <days>]",
+	Short: "Delete the bundle backups expired by the retention policy",
+	Long:  `Delete the timestamped backups of the bundle that are neither among the most recent ones nor taken in the last days. The latest bundle and the tagged releases are always kept.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		retention := usecases.RetentionFromConfig()
+		if cmd.Flags().Changed("keep-last") {
+			retention.KeepLast = pruneKeepLast
+		}
+		if cmd.Flags().Changed("keep-days") {
+			retention.KeepFor = time.Duration(pruneKeepDays) * 24 * time.Hour
+		}
+		if retention.Unlimited() {
+			slog.Warn("No retention policy configured, every backup is kept")
+			return
+		}
+
+		expired, err := usecases.Prune(retention, pruneDryRun)
+		out := cmd.OutOrStdout()
+		for _, version := range expired {
+			if pruneDryRun {
+				fmt.Fprintln(out, "Would delete", version.Tag)
+			} else {
+				fmt.Fprintln(out, "Deleted", version.Tag)
+			}
+		}
+		if err != nil {
+			slog.Error("Error pruning bundle backups", "error", err)
+			return
+		}
+		if len(expired) == 0 {
+			fmt.Fprintln(out, "No expired backup")
+		}
+	},
+}
@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"dspn-regogenerator/internal/usecases"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	refreshKeysFile string
+)
+
+func init() {
+	RefreshKeysCmd.Flags().StringVar(&refreshKeysFile, "pinned-keys", "", "JSON file mapping each issuer to its JWKS, pinned instead of fetching the keys")
+}
+
+var RefreshKeysCmd = &cobra.Command{
+	Use:   "refresh-keys [--pinned-keys <path>] <service name>",
+	Short: "Refresh the identity provider keys pinned for a service and republish the bundle",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		serviceName := args[0]
+
+		var keysData []byte
+		if refreshKeysFile != "" {
+			var err error
+			if keysData, err = os.ReadFile(refreshKeysFile); err != nil {
+				slog.Error("Error loading pinned keys file", "error", err)
+				return
+			}
+		}
+
+		if err := usecases.RefreshPinnedKeys(serviceName, keysData, cliActor()); err != nil {
+			slog.Error("Error refreshing pinned keys", "serviceName", serviceName, "error", err)
+		}
+	},
+}
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"context"
+	"dspn-regogenerator/internal/usecases"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	simulateMethod  string
+	simulateHost    string
+	simulateToken   string
+	simulateClaims  string
+	simulateHeaders []string
+)
+
+func init() {
+	SimulateCmd.Flags().StringVarP(&simulateMethod, "method", "X", "GET", "HTTP method of the request")
+	SimulateCmd.Flags().StringVar(&simulateHost, "host", "", "Host the request is addressed to")
+	SimulateCmd.Flags().StringVar(&simulateToken, "token", "", "Bearer token sent in the authorization header and verified by the policies")
+	SimulateCmd.Flags().StringVar(&simulateClaims, "claims", "", "JSON claims of a token assumed to be valid, instead of verifying a token")
+	SimulateCmd.Flags().StringArrayVarP(&simulateHeaders, "header", "H", nil, "Header of the request as \"name: value\", can be repeated")
+}
+
+var SimulateCmd = &cobra.Command{
+	Use:   "simulate [-X <method>] [--host <host>] [--token <token> | --claims <json>] [-H <header>]... <path>",
+	Short: "Simulate a request against the policies of the bundle and explain the decision",
+	Long:  `Evaluate a request against the policies of the latest bundle, printing whether it is allowed, the service it is routed to and the reasons collected by the policies of the service.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		request := usecases.DecisionRequest{
+			Method:  simulateMethod,
+			Path:    args[0],
+			Host:    simulateHost,
+			Headers: make(map[string]string),
+		}
+		for _, header := range simulateHeaders {
+			name, value, ok := strings.Cut(header, ":")
+			if !ok {
+				slog.Error("Invalid header, expected \"name: value\"", "header", header)
+				return
+			}
+			request.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+		if simulateToken != "" {
+			request.Headers["authorization"] = "Bearer " + simulateToken
+		}
+		if simulateClaims != "" {
+			if err := json.Unmarshal([]byte(simulateClaims), &request.Claims); err != nil {
+				slog.Error("Invalid claims", "error", err)
+				return
+			}
+		}
+
+		decision, err := usecases.Decide(context.Background(), request)
+		if err != nil {
+			slog.Error("Error simulating request", "error", err)
+			return
+		}
+		out := cmd.OutOrStdout()
+		fmt.Fprintln(out, "Allow:", decision.Allow)
+		if decision.Service != "" {
+			fmt.Fprintln(out, "Service:", decision.Service)
+		}
+		fmt.Fprintln(out, "Reason:", decision.Reason)
+		if len(decision.Reasons) > 0 {
+			fmt.Fprintln(out, "Reasons:")
+			for _, reason := range decision.Reasons {
+				fmt.Fprintln(out, "    -", reason)
+			}
+		}
+	},
+}
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"dspn-regogenerator/internal/bundle"
+	"dspn-regogenerator/internal/config"
+	"dspn-regogenerator/internal/usecases"
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyKey       string
+	verifyAlgorithm string
+	verifyKeyID     string
+)
+
+func init() {
+	VerifyCmd.Flags().StringVar(&verifyKey, "key", "", "HMAC secret or PEM public key verifying the bundle, or the path of a file holding it (default from the configuration)")
+	VerifyCmd.Flags().StringVar(&verifyAlgorithm, "alg", "", "Algorithm of the signature, e.g. HS256, RS256 or ES256 (default from the configuration)")
+	VerifyCmd.Flags().StringVar(&verifyKeyID, "key-id", "", "Id of the key signing the bundle (default from the configuration)")
+}
+
+var VerifyCmd = &cobra.Command{
+	Use:   "verify [--key <key>] [--alg <algorithm>] [--key-id <id>] <bundle path>",
+	Short: "Verify the signature of a bundle archive",
+	Long:  `Verify the .signatures.json of a bundle archive, e.g. downloaded manually from the bucket. Unsigned bundles and bundles whose content does not match the signature are refused.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		signingKeys := bundle.NewSigningKeysFromConfig()
+		if signingKeys == nil {
+			signingKeys = &bundle.SigningKeys{KeyID: config.BundleKeyID, Algorithm: config.BundleSigningAlgorithm}
+		}
+		if verifyKey != "" {
+			signingKeys.VerificationKey = verifyKey
+		}
+		if verifyAlgorithm != "" {
+			signingKeys.Algorithm = verifyAlgorithm
+		}
+		if verifyKeyID != "" {
+			signingKeys.KeyID = verifyKeyID
+		}
+
+		services, err := usecases.VerifyBundleFile(args[0], signingKeys)
+		if err != nil {
+			slog.Error("Error verifying bundle", "path", args[0], "error", err)
+			return
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Bundle signature verified, services: %v\n", services)
+	},
+}
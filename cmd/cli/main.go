@@ -11,7 +11,7 @@ import (
 
 func main() {
 	var rootCmd = &cobra.Command{Use: "dspn-regogenerator"}
-	rootCmd.AddCommand(commands.AddCmd, commands.ListCmd, commands.DeleteCmd, commands.TestCmd, commands.GetCmd)
+	rootCmd.AddCommand(commands.AddCmd, commands.ListCmd, commands.DeleteCmd, commands.TestCmd, commands.GetCmd, commands.RefreshKeysCmd, commands.SimulateCmd, commands.VerifyCmd, commands.HistoryCmd, commands.RollbackCmd, commands.PruneCmd, commands.DiffCmd)
 
 	slog.SetDefault(slog.New(NewCliHandler(os.Stderr)))
 
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"dspn-regogenerator/internal/usecases"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Decide evaluates the JSON decision request in the body against the policies of the latest bundle, responding with
+// the decision and the human readable reasons of the service the request is routed to.
+func Decide(w http.ResponseWriter, r *http.Request) {
+	var request usecases.DecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid decision request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Method == "" || request.Path == "" {
+		http.Error(w, "method and path are required", http.StatusBadRequest)
+		return
+	}
+
+	decision, err := usecases.Decide(r.Context(), request)
+	if errors.As(err, &usecases.InvalidDecisionRequestError{}) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json, err := json.Marshal(decision)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"dspn-regogenerator/internal/usecases"
+	"encoding/json"
+	"net/http"
+)
+
+// ListHistory responds with the versions of the bundle, from the most recent one.
+func ListHistory(w http.ResponseWriter, r *http.Request) {
+	versions, err := usecases.History()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json, err := json.Marshal(struct {
+		Versions []usecases.BundleVersion `json:"versions"`
+	}{
+		Versions: versions,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(json)
+}
+
+// RollbackBundle replaces the latest bundle with the version with the tag given in the form.
+func RollbackBundle(w http.ResponseWriter, r *http.Request) {
+	tag := r.FormValue("tag")
+	if tag == "" {
+		http.Error(w, "tag is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := usecases.Rollback(tag, requestActor(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestActor returns the user authenticated by the proxy in front of the manager, or the address of the client,
+// recorded in the history of the bundle.
+func requestActor(r *http.Request) string {
+	if user := r.Header.Get("X-Forwarded-User"); user != "" {
+		return user
+	}
+	return r.RemoteAddr
+}
@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"dspn-regogenerator/internal/policy/parser"
 	"dspn-regogenerator/internal/usecases"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"strings"
 )
 
 func ListServicePolicies(w http.ResponseWriter, r *http.Request) {
@@ -46,14 +49,60 @@ func AddServicePolicies(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = usecases.AddService(serviceName, specData)
+	// The keys to pin are optional, when missing they are fetched if pinKeys is set
+	var pinnedKeys []byte
+	if keysFile, _, err := r.FormFile("pinnedKeys"); err == nil {
+		defer keysFile.Close()
+		if pinnedKeys, err = io.ReadAll(keysFile); err != nil {
+			http.Error(w, "Failed to read pinned keys", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	diagnostics, err := usecases.AddService(serviceName, specData, usecases.ServiceConfig{
+		TimelinessSource: r.FormValue("timelinessSource"),
+		LocationSource:   r.FormValue("locationSource"),
+		Audience:         r.FormValue("audience"),
+		ClockSkew:        r.FormValue("clockSkew"),
+		PinKeys:          r.FormValue("pinKeys") == "true",
+		PinnedKeys:       pinnedKeys,
+		PathPrefix:       r.FormValue("pathPrefix"),
+		Hosts:            formList(r.FormValue("hosts")),
+		MatchHosts:       r.FormValue("matchHosts") == "true",
+		ExtAuthzResult:   r.FormValue("extAuthzResult") == "true",
+		Actor:            requestActor(r),
+	})
+	if errors.As(err, &parser.Diagnostics{}) {
+		writeDiagnostics(w, http.StatusUnprocessableEntity, diagnostics)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if len(diagnostics) > 0 {
+		writeDiagnostics(w, http.StatusCreated, diagnostics)
+		return
+	}
 	w.WriteHeader(http.StatusCreated)
 }
 
+// writeDiagnostics responds with every problem found in the uploaded spec.
+func writeDiagnostics(w http.ResponseWriter, status int, diagnostics parser.Diagnostics) {
+	json, err := json.Marshal(struct {
+		Diagnostics parser.Diagnostics `json:"diagnostics"`
+	}{
+		Diagnostics: diagnostics,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(json)
+}
+
 func DeleteServicePolicies(w http.ResponseWriter, r *http.Request) {
 	serviceName := r.FormValue("serviceName")
 	if serviceName == "" {
@@ -61,10 +110,21 @@ func DeleteServicePolicies(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := usecases.DeleteService(serviceName)
+	err := usecases.DeleteService(serviceName, requestActor(r))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// formList splits a comma separated form value, ignoring empty items.
+func formList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -24,6 +24,9 @@ func main() {
 	mux.HandleFunc("GET /api/policies", handlers.ListServicePolicies)
 	mux.HandleFunc("PUT /api/policies", handlers.AddServicePolicies)
 	mux.HandleFunc("DELETE /api/policies", handlers.DeleteServicePolicies)
+	mux.HandleFunc("POST /api/decision", handlers.Decide)
+	mux.HandleFunc("GET /api/history", handlers.ListHistory)
+	mux.HandleFunc("POST /api/rollback", handlers.RollbackBundle)
 	slog.Info("Starting server on :8080")
 	err := http.ListenAndServe(":8080", mux)
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -13,11 +13,15 @@ import (
 
 	"github.com/open-policy-agent/opa/v1/ast"
 	opabundle "github.com/open-policy-agent/opa/v1/bundle"
+	"github.com/open-policy-agent/opa/v1/rego"
+	"github.com/open-policy-agent/opa/v1/util"
 )
 
 // Represent a OPA bundle in the teadal context, which is a collection of services identified by an unique name. Each service may contain multiple rego file and it is stored in a directory wit its name.
 type Bundle struct {
 	bundle *opabundle.Bundle
+	// Name of the bundle restored by the next stamp, if it is a rollback
+	rollbackOf string
 }
 
 const mainFilePath = "/rego/main.rego"
@@ -32,7 +36,7 @@ func NewFromFS(ctx context.Context, fs fs.FS, serviceNames ...string) (*Bundle,
 
 	opab.Manifest.Metadata = map[string]interface{}{"services": serviceNames}
 
-	return &Bundle{&opab}, nil
+	return &Bundle{bundle: &opab}, nil
 }
 
 // Read the bundle metadata service key, which is a list of service names. Modify it to be a list of strings if it is not already.
@@ -63,14 +67,26 @@ func (b *Bundle) normalizeMetadata() error {
 }
 
 // NewFromArchive creates a new Bundle from an archive reader. The reader should be a tarball containing the OPA bundle files.
+// Signed bundles are read without verifying their signature, see NewVerifiedFromArchive.
 func NewFromArchive(ctx context.Context, reader io.Reader) (*Bundle, error) {
+	return readArchive(reader, nil)
+}
+
+// readArchive reads a bundle from an archive reader, verifying its signature if verification is not nil.
+func readArchive(reader io.Reader, verification *opabundle.VerificationConfig) (*Bundle, error) {
 	loader := opabundle.NewTarballLoaderWithBaseURL(reader, "")
-	bundle, err := opabundle.NewCustomReader(loader).Read()
+	bundleReader := opabundle.NewCustomReader(loader)
+	if verification != nil {
+		bundleReader = bundleReader.WithBundleVerificationConfig(verification)
+	} else {
+		bundleReader = bundleReader.WithSkipBundleVerification(true)
+	}
+	bundle, err := bundleReader.Read()
 	if err != nil {
 		return nil, err
 	}
 
-	newBundle := Bundle{&bundle}
+	newBundle := Bundle{bundle: &bundle}
 	if err := newBundle.normalizeMetadata(); err != nil {
 		return nil, err
 	}
@@ -100,7 +116,55 @@ func (b *Bundle) Services() ([]string, error) {
 	}
 }
 
+// RouteMatchedRuleName is the rule of the service package telling the main policy whether a request is addressed to the
+// service.
+const RouteMatchedRuleName = "route_matched"
+
+// UnroutedServices returns the services of the bundle whose package declares no route, as generated before the main
+// policy dispatched the requests by route. The main policy never dispatches a request to them.
+func (b *Bundle) UnroutedServices() ([]string, error) {
+	services, err := b.Services()
+	if err != nil {
+		return nil, err
+	}
+	unrouted := make([]string, 0)
+	for _, service := range services {
+		routed := slices.ContainsFunc(b.bundle.Modules, func(module opabundle.ModuleFile) bool {
+			return packageRoot(module) == ServiceRoot(service) && slices.ContainsFunc(module.Parsed.Rules, func(rule *ast.Rule) bool {
+				return rule.Head.Ref().String() == RouteMatchedRuleName
+			})
+		})
+		if !routed {
+			unrouted = append(unrouted, service)
+		}
+	}
+	return unrouted, nil
+}
+
 func (b *Bundle) AddService(serviceName string, specData map[string][]byte) error {
+	// Parse the spec data files, which must stay within the root of the service
+	modules := make([]opabundle.ModuleFile, 0, len(specData))
+	for path, data := range specData {
+		cleanPath := filepath.Clean(path)
+		if cleanPath[0] != os.PathSeparator && cleanPath[0] != '.' {
+			cleanPath = string(os.PathSeparator) + cleanPath
+		}
+
+		parsedData, err := ast.ParseModule(cleanPath, string(data))
+		if err != nil {
+			return fmt.Errorf("failed to parse module %s: %w", cleanPath, err)
+		}
+		modules = append(modules, opabundle.ModuleFile{
+			URL:    cleanPath,
+			Path:   cleanPath,
+			Raw:    data,
+			Parsed: parsedData,
+		})
+	}
+	if err := b.checkServiceRoot(serviceName, modules); err != nil {
+		return err
+	}
+
 	// Add the service to the bundle metadata
 	if b.bundle.Manifest.Metadata == nil {
 		b.bundle.Manifest.Metadata = make(map[string]interface{})
@@ -122,39 +186,78 @@ func (b *Bundle) AddService(serviceName string, specData map[string][]byte) erro
 	}
 
 	// Add the spec data files to the bundle
-	for path, data := range specData {
-		cleanPath := filepath.Clean(path)
-		if cleanPath[0] != os.PathSeparator && cleanPath[0] != '.' {
-			cleanPath = string(os.PathSeparator) + cleanPath
-		}
-
-		parsedData, err := ast.ParseModule(cleanPath, string(data))
-		if err != nil {
-			return fmt.Errorf("failed to parse module %s: %w", cleanPath, err)
-		}
-
+	for _, newModule := range modules {
 		moduleFound := false
 		for index, module := range b.bundle.Modules {
-			if module.Path == cleanPath {
-				module.Raw = data
-				module.Parsed = parsedData
+			if module.Path == newModule.Path {
+				module.Raw = newModule.Raw
+				module.Parsed = newModule.Parsed
 				b.bundle.Modules[index] = module
 				moduleFound = true
 			}
 		}
 		if !moduleFound {
-			b.bundle.Modules = append(b.bundle.Modules, opabundle.ModuleFile{
-				URL:    cleanPath,
-				Path:   cleanPath,
-				Raw:    data,
-				Parsed: parsedData,
-			})
+			b.bundle.Modules = append(b.bundle.Modules, newModule)
 		}
 	}
 
 	return nil
 }
 
+// SetData stores the value in the bundle data document at the provided slash separated path (e.g. "teadal/regions"),
+// replacing any previous value. The value must be serializable to JSON.
+func (b *Bundle) SetData(path string, value interface{}) error {
+	keys := strings.Split(strings.Trim(path, "/"), "/")
+	if len(keys) == 0 || keys[0] == "" {
+		return errors.New("empty data path")
+	}
+	if err := util.RoundTrip(&value); err != nil {
+		return fmt.Errorf("failed to convert data at %s: %w", path, err)
+	}
+
+	if b.bundle.Data == nil {
+		b.bundle.Data = make(map[string]interface{})
+	}
+	node := b.bundle.Data
+	for _, key := range keys[:len(keys)-1] {
+		if _, ok := node[key]; !ok {
+			node[key] = make(map[string]interface{})
+		}
+		child, ok := node[key].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("data at %s is not an object", key)
+		}
+		node = child
+	}
+	node[keys[len(keys)-1]] = value
+	return nil
+}
+
+// GetData returns the value stored in the bundle data document at the provided slash separated path.
+func (b *Bundle) GetData(path string) (interface{}, bool) {
+	var node interface{} = b.bundle.Data
+	for _, key := range strings.Split(strings.Trim(path, "/"), "/") {
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if node, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// Query evaluates the query against the policies and data of the bundle with the given input, as OPA would once the
+// bundle is published.
+func (b *Bundle) Query(ctx context.Context, query string, input interface{}) (rego.ResultSet, error) {
+	return rego.New(
+		rego.Query(query),
+		rego.ParsedBundle("bundle", b.bundle),
+		rego.Input(input),
+	).Eval(ctx)
+}
+
 func (b *Bundle) GetMain() ([]byte, error) {
 	if b.bundle == nil {
 		return nil, errors.New("bundle is nil")
@@ -231,6 +334,8 @@ func (b *Bundle) RemoveService(serviceName string) error {
 	b.bundle.Modules = slices.DeleteFunc(b.bundle.Modules, func(module opabundle.ModuleFile) bool {
 		return strings.HasPrefix(module.Path, "/rego"+string(os.PathSeparator)+serviceName)
 	})
+	// Remove the data stored under the service namespace, such as its pinned keys
+	delete(b.bundle.Data, serviceName)
 
 	return nil
 }
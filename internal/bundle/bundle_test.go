@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/open-policy-agent/opa/v1/bundle"
@@ -303,6 +304,36 @@ func TestAddService(t *testing.T) {
 			t.Fatalf("expected /service1/policy.rego, got %v", bundle.bundle.Modules[0].Path)
 		}
 	})
+
+	t.Run("RootCollision", func(t *testing.T) {
+		bundle, err := beforeEach(t)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		for _, serviceName := range []string{"teadal", "service1.orders", "teadal.orders"} {
+			specData := map[string][]byte{
+				"collision/policy.rego": []byte("package " + serviceName + "\n"),
+			}
+			if err := bundle.AddService(serviceName, specData); err == nil {
+				t.Errorf("expected service %s to collide with the roots of the bundle", serviceName)
+			}
+		}
+		specData := map[string][]byte{
+			"service2/policy.rego": []byte("package service1\n"),
+		}
+		if err := bundle.AddService("service2", specData); err == nil {
+			t.Errorf("expected the package of service2 to be refused outside of its root")
+		}
+
+		services, err := bundle.Services()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(services) != 1 || len(bundle.bundle.Modules) != 1 {
+			t.Fatalf("expected the refused services not to be added, got %v", services)
+		}
+	})
 }
 
 func TestGetMain(t *testing.T) {
@@ -409,3 +440,92 @@ func TestRemoveService(t *testing.T) {
 		}
 	})
 }
+
+func TestSetData(t *testing.T) {
+	tempDir := t.TempDir()
+	os.Mkdir(tempDir+"/service1", 0755)
+	os.WriteFile(tempDir+"/service1/policy.rego", []byte("package service1\n"), 0644)
+
+	b, err := NewFromFS(context.Background(), os.DirFS(tempDir), "service1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := b.SetData("teadal/regions", map[string][]string{"Italy": {"Europe"}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := b.SetData("teadal/regions/Italy/0", "Europe"); err == nil {
+		t.Fatal("expected error setting data below a non object value, got nil")
+	}
+
+	// The data must survive a write and read cycle
+	archive := &bytes.Buffer{}
+	if err := bundle.NewWriter(archive).Write(*b.bundle); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	loaded, err := NewFromArchive(context.Background(), archive)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	regions, ok := loaded.GetData("teadal/regions")
+	if !ok {
+		t.Fatal("expected regions data to be present")
+	}
+	parents, ok := regions.(map[string]interface{})["Italy"].([]interface{})
+	if !ok || len(parents) != 1 || parents[0] != "Europe" {
+		t.Fatalf("expected Italy to be in Europe, got %v", regions)
+	}
+	if _, ok := loaded.GetData("teadal/missing"); ok {
+		t.Fatal("expected missing data to be absent")
+	}
+}
+
+func TestRemoveServiceData(t *testing.T) {
+	tempDir := t.TempDir()
+	os.Mkdir(tempDir+"/service1", 0755)
+	os.WriteFile(tempDir+"/service1/policy.rego", []byte("package service1\n"), 0644)
+
+	b, err := NewFromFS(context.Background(), os.DirFS(tempDir), "service1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := b.normalizeMetadata(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := b.SetData("service1/pinned_keys", map[string]interface{}{"issuers": map[string]interface{}{}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := b.SetData("teadal/regions", map[string][]string{"Italy": {"Europe"}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := b.RemoveService("service1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, ok := b.GetData("service1/pinned_keys"); ok {
+		t.Fatal("expected the service data to be removed")
+	}
+	if _, ok := b.GetData("teadal/regions"); !ok {
+		t.Fatal("expected the shared data to be kept")
+	}
+}
+
+func TestUnroutedServices(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(tempDir+"/routed", 0755)
+	os.WriteFile(tempDir+"/routed/policy.rego", []byte("package routed\n\nroute_matched := true\n"), 0644)
+	os.MkdirAll(tempDir+"/legacy/service", 0755)
+	os.WriteFile(tempDir+"/legacy/service/policy.rego", []byte("package legacy.service\n\nroute_matched := true\n"), 0644)
+
+	b, err := NewFromFS(context.Background(), os.DirFS(tempDir), "routed", "legacy")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	unrouted, err := b.UnroutedServices()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(unrouted, []string{"legacy"}) {
+		t.Errorf("expected only the service declaring no route in its package to be unrouted, got %v", unrouted)
+	}
+}
@@ -0,0 +1,220 @@
+package bundle
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// ChangeStatus tells how an item of a bundle changed from a bundle to another.
+type ChangeStatus string
+
+const (
+	ChangeAdded    ChangeStatus = "added"
+	ChangeRemoved  ChangeStatus = "removed"
+	ChangeModified ChangeStatus = "modified"
+)
+
+// Changes describes the differences from a bundle to another, as computed by Diff.
+type Changes struct {
+	AddedServices   []string         `json:"added_services"`
+	RemovedServices []string         `json:"removed_services"`
+	Modules         []ModuleChange   `json:"modules"`
+	Data            []DataChange     `json:"data"`
+	Manifest        []ManifestChange `json:"manifest"`
+}
+
+// ModuleChange describes a changed module, with the unified diff of its source.
+type ModuleChange struct {
+	Path   string       `json:"path"`
+	Status ChangeStatus `json:"status"`
+	Diff   string       `json:"diff"`
+}
+
+// DataChange describes a changed data document, identified by its slash separated path, e.g. teadal/regions.
+type DataChange struct {
+	Path   string       `json:"path"`
+	Status ChangeStatus `json:"status"`
+	Before interface{}  `json:"before,omitempty"`
+	After  interface{}  `json:"after,omitempty"`
+}
+
+// ManifestChange describes a changed field of the manifest, e.g. revision, roots or metadata.actor.
+type ManifestChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// Empty reports whether the bundles have the same services, modules, data and manifest.
+func (c *Changes) Empty() bool {
+	return len(c.AddedServices) == 0 && len(c.RemovedServices) == 0 && len(c.Modules) == 0 && len(c.Data) == 0 &&
+		len(c.Manifest) == 0
+}
+
+// Diff returns the changes from the bundle a to the bundle b. The signatures are not compared, as they change with the
+// content.
+func Diff(a *Bundle, b *Bundle) (*Changes, error) {
+	changes := &Changes{
+		AddedServices:   []string{},
+		RemovedServices: []string{},
+		Modules:         []ModuleChange{},
+		Data:            []DataChange{},
+		Manifest:        []ManifestChange{},
+	}
+
+	servicesA, err := a.Services()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get services of the first bundle: %v", err)
+	}
+	servicesB, err := b.Services()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get services of the second bundle: %v", err)
+	}
+	for _, service := range servicesB {
+		if !slices.Contains(servicesA, service) {
+			changes.AddedServices = append(changes.AddedServices, service)
+		}
+	}
+	for _, service := range servicesA {
+		if !slices.Contains(servicesB, service) {
+			changes.RemovedServices = append(changes.RemovedServices, service)
+		}
+	}
+
+	if err := changes.diffModules(a, b); err != nil {
+		return nil, err
+	}
+	changes.diffData("", a.bundle.Data, b.bundle.Data)
+	changes.diffManifest(a, b)
+	return changes, nil
+}
+
+// diffModules adds the modules added, removed or modified from a to b, sorted by path.
+func (c *Changes) diffModules(a *Bundle, b *Bundle) error {
+	sources := func(bundle *Bundle) map[string]string {
+		modules := make(map[string]string, len(bundle.bundle.Modules))
+		for _, module := range bundle.bundle.Modules {
+			modules[module.Path] = string(module.Raw)
+		}
+		return modules
+	}
+	modulesA, modulesB := sources(a), sources(b)
+	paths := slices.Sorted(maps.Keys(modulesA))
+	for path := range modulesB {
+		if _, ok := modulesA[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+
+	for _, path := range paths {
+		sourceA, inA := modulesA[path]
+		sourceB, inB := modulesB[path]
+		status := ChangeModified
+		if !inA {
+			status = ChangeAdded
+		} else if !inB {
+			status = ChangeRemoved
+		} else if sourceA == sourceB {
+			continue
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines(sourceA),
+			B:        splitLines(sourceB),
+			FromFile: "a" + path,
+			ToFile:   "b" + path,
+			Context:  3,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to diff module %s: %v", path, err)
+		}
+		c.Modules = append(c.Modules, ModuleChange{Path: path, Status: status, Diff: diff})
+	}
+	return nil
+}
+
+// splitLines splits the source in lines ending with a line feed, adding it to the last line if missing.
+func splitLines(source string) []string {
+	lines := strings.SplitAfter(source, "\n")
+	if last := lines[len(lines)-1]; last == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		lines[len(lines)-1] = last + "\n"
+	}
+	return lines
+}
+
+// diffData adds the data documents added, removed or modified from a to b under the path. Objects are compared key by
+// key, so that only the innermost changed documents are reported.
+func (c *Changes) diffData(path string, a interface{}, b interface{}) {
+	objectA, isObjectA := a.(map[string]interface{})
+	objectB, isObjectB := b.(map[string]interface{})
+	if isObjectA && isObjectB {
+		keys := slices.Sorted(maps.Keys(objectA))
+		for key := range objectB {
+			if _, ok := objectA[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			valueA, inA := objectA[key]
+			valueB, inB := objectB[key]
+			keyPath := strings.TrimPrefix(path+"/"+key, "/")
+			switch {
+			case !inA:
+				c.Data = append(c.Data, DataChange{Path: keyPath, Status: ChangeAdded, After: valueB})
+			case !inB:
+				c.Data = append(c.Data, DataChange{Path: keyPath, Status: ChangeRemoved, Before: valueA})
+			default:
+				c.diffData(keyPath, valueA, valueB)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		c.Data = append(c.Data, DataChange{Path: path, Status: ChangeModified, Before: a, After: b})
+	}
+}
+
+// diffManifest adds the changed revision, roots and metadata of the manifest, except the services, which are compared
+// on their own.
+func (c *Changes) diffManifest(a *Bundle, b *Bundle) {
+	manifestA, manifestB := a.bundle.Manifest, b.bundle.Manifest
+	if manifestA.Revision != manifestB.Revision {
+		c.Manifest = append(c.Manifest, ManifestChange{Field: "revision", Before: manifestA.Revision, After: manifestB.Revision})
+	}
+	var rootsA, rootsB []string
+	if manifestA.Roots != nil {
+		rootsA = *manifestA.Roots
+	}
+	if manifestB.Roots != nil {
+		rootsB = *manifestB.Roots
+	}
+	if !slices.Equal(rootsA, rootsB) {
+		c.Manifest = append(c.Manifest, ManifestChange{Field: "roots", Before: rootsA, After: rootsB})
+	}
+
+	keys := slices.Sorted(maps.Keys(manifestA.Metadata))
+	for key := range manifestB.Metadata {
+		if _, ok := manifestA.Metadata[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if key == "services" || reflect.DeepEqual(manifestA.Metadata[key], manifestB.Metadata[key]) {
+			continue
+		}
+		c.Manifest = append(c.Manifest, ManifestChange{
+			Field:  "metadata." + key,
+			Before: manifestA.Metadata[key],
+			After:  manifestB.Metadata[key],
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package bundle
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a := newSigningTestBundle(t)
+	if err := a.AddService("service2", map[string][]byte{"service2/policy.rego": []byte("package service2\n")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := a.SetData("teadal/regions", map[string]interface{}{"Europe": []interface{}{"Italy"}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	b := newSigningTestBundle(t)
+	if err := b.AddService("service3", map[string][]byte{"service3/policy.rego": []byte("package service3\n")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := b.AddService("service1", map[string][]byte{"service1/policy.rego": []byte("package service1\n\nallow := false\n")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := b.SetData("teadal/regions", map[string]interface{}{"Europe": []interface{}{"Italy", "Spain"}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := b.SetData("service1/config/limit", 10); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	b.bundle.Manifest.Revision = "2-abc"
+
+	changes, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(changes.AddedServices, []string{"service3"}) || !reflect.DeepEqual(changes.RemovedServices, []string{"service2"}) {
+		t.Errorf("expected service3 added and service2 removed, got %v and %v", changes.AddedServices, changes.RemovedServices)
+	}
+
+	statuses := map[string]ChangeStatus{}
+	for _, module := range changes.Modules {
+		statuses[module.Path] = module.Status
+	}
+	wantStatuses := map[string]ChangeStatus{
+		"/service1/policy.rego": ChangeModified,
+		"/service2/policy.rego": ChangeRemoved,
+		"/service3/policy.rego": ChangeAdded,
+	}
+	if !reflect.DeepEqual(statuses, wantStatuses) {
+		t.Errorf("expected module statuses %v, got %v", wantStatuses, statuses)
+	}
+	wantDiff := "--- a/service1/policy.rego\n+++ b/service1/policy.rego\n@@ -1,3 +1,3 @@\n package service1\n \n-allow := true\n+allow := false\n"
+	if changes.Modules[0].Diff != wantDiff {
+		t.Errorf("expected diff %q, got %q", wantDiff, changes.Modules[0].Diff)
+	}
+
+	wantData := []DataChange{
+		{Path: "service1/config/limit", Status: ChangeAdded, After: json.Number("10")},
+		{Path: "teadal/regions/Europe", Status: ChangeModified, Before: []interface{}{"Italy"}, After: []interface{}{"Italy", "Spain"}},
+	}
+	if !reflect.DeepEqual(changes.Data, wantData) {
+		t.Errorf("expected data changes %v, got %v", wantData, changes.Data)
+	}
+
+	fields := []string{}
+	for _, change := range changes.Manifest {
+		fields = append(fields, change.Field)
+	}
+	if strings.Join(fields, ",") != "revision" {
+		t.Errorf("expected the revision to change, got %v", changes.Manifest)
+	}
+
+	if changes, err := Diff(a, a); err != nil || !changes.Empty() {
+		t.Errorf("expected no change between a bundle and itself, got %+v %v", changes, err)
+	}
+}
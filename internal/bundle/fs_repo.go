@@ -1,7 +1,6 @@
 package bundle
 
 import (
-	"context"
 	"os"
 	"path/filepath"
 
@@ -11,6 +10,8 @@ import (
 type FileSystemRepository struct {
 	// Path to base directory
 	basePath string
+	// Keys verifying the read bundles, if any
+	signingKeys *SigningKeys
 }
 
 // Read implements [Repository.Read].
@@ -21,7 +22,11 @@ func (f *FileSystemRepository) Read(path string) (*Bundle, error) {
 		return nil, err
 	}
 	defer file.Close()
-	bundle, err := NewFromArchive(context.TODO(), file)
+	verification, err := f.signingKeys.verificationConfig()
+	if err != nil {
+		return nil, err
+	}
+	bundle, err := readArchive(file, verification)
 	if err != nil {
 		return nil, err
 	}
@@ -47,10 +52,26 @@ func (f *FileSystemRepository) Write(path string, bundle Bundle) error {
 	return nil
 }
 
+// WriteArchive writes the archive of a bundle as is, e.g. downloaded with [MinioRepository.ReadArchive], so that it
+// keeps its signatures and manifest.
+func (f *FileSystemRepository) WriteArchive(path string, archive []byte) error {
+	fullPath := filepath.Join(f.basePath, path)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(fullPath, archive, 0644)
+}
+
 func NewFileSystemRepository(baseDir string) *FileSystemRepository {
 	return &FileSystemRepository{
 		basePath: baseDir,
 	}
 }
 
+// WithSigningKeys verifies the bundles read from the repository with the keys.
+func (f *FileSystemRepository) WithSigningKeys(signingKeys *SigningKeys) *FileSystemRepository {
+	f.signingKeys = signingKeys
+	return f
+}
+
 var _ Repository = (*FileSystemRepository)(nil)
@@ -0,0 +1,133 @@
+package bundle
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Manifest metadata keys recording who wrote the bundle, when, and which bundle it restored, if any.
+const (
+	actorKey      = "actor"
+	writtenAtKey  = "written_at"
+	rollbackOfKey = "rollback_of"
+)
+
+// HistoryEntry describes a bundle stored in a repository, as stamped when it was published.
+type HistoryEntry struct {
+	// Name of the bundle in the repository
+	Name string `json:"name"`
+	// Timestamp of the stamp of the bundle, or of the object for bundles that were never stamped
+	Timestamp time.Time `json:"timestamp"`
+	Revision  string    `json:"revision"`
+	Services  []string  `json:"services"`
+	Actor     string    `json:"actor,omitempty"`
+	// Name of the bundle restored by the write, if it was a rollback
+	RollbackOf string `json:"rollback_of,omitempty"`
+}
+
+// PrepareRollback prepares the bundle, read from the bundle name, to replace the latest bundle: its next stamp is
+// recorded as a new revision following the one of the latest bundle, restoring the named bundle.
+func (b *Bundle) PrepareRollback(latest *Bundle, name string) {
+	b.bundle.Manifest.Revision = latest.bundle.Manifest.Revision
+	b.rollbackOf = name
+}
+
+// stampHistory records the actor, the time and the restored bundle of the publication in the manifest.
+func (b *Bundle) stampHistory(actor string) {
+	metadata := b.bundle.Manifest.Metadata
+	metadata[writtenAtKey] = time.Now().UTC().Format(time.RFC3339)
+	for key, value := range map[string]string{actorKey: actor, rollbackOfKey: b.rollbackOf} {
+		if value != "" {
+			metadata[key] = value
+		} else {
+			delete(metadata, key)
+		}
+	}
+}
+
+// historyEntry describes the bundle stored with the name, modified at the given time.
+func (b *Bundle) historyEntry(name string, modified time.Time) HistoryEntry {
+	metadata := b.bundle.Manifest.Metadata
+	entry := HistoryEntry{Name: name, Timestamp: modified, Revision: b.bundle.Manifest.Revision, Services: []string{}}
+	if writtenAt, ok := metadata[writtenAtKey].(string); ok {
+		if timestamp, err := time.Parse(time.RFC3339, writtenAt); err == nil {
+			entry.Timestamp = timestamp
+		}
+	}
+	if services, err := b.Services(); err == nil {
+		entry.Services = services
+	}
+	entry.Actor, _ = metadata[actorKey].(string)
+	entry.RollbackOf, _ = metadata[rollbackOfKey].(string)
+	return entry
+}
+
+// sortHistory sorts the entries from the most recent one.
+func sortHistory(entries []HistoryEntry) {
+	slices.SortStableFunc(entries, func(a, b HistoryEntry) int {
+		return b.Timestamp.Compare(a.Timestamp)
+	})
+}
+
+// History implements [Repository.History]. The bundles are read without verifying their signature, as they are only
+// described.
+func (f *FileSystemRepository) History(ctx context.Context, prefix string) ([]HistoryEntry, error) {
+	files, err := os.ReadDir(f.basePath)
+	if err != nil {
+		return nil, err
+	}
+	entries := []HistoryEntry{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), prefix) || !strings.HasSuffix(file.Name(), ".tar.gz") {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return nil, err
+		}
+		reader, err := os.Open(filepath.Join(f.basePath, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		b, err := readArchive(reader, nil)
+		reader.Close()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, b.historyEntry(file.Name(), info.ModTime()))
+	}
+	sortHistory(entries)
+	return entries, nil
+}
+
+// History implements [Repository.History]. The bundles are read without verifying their signature, as they are only
+// described.
+func (m *MinioRepository) History(ctx context.Context, prefix string) ([]HistoryEntry, error) {
+	entries := []HistoryEntry{}
+	for object := range m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		if !strings.HasSuffix(object.Key, ".tar.gz") {
+			continue
+		}
+		reader, err := m.client.GetObject(ctx, m.bucket, object.Key, minio.GetObjectOptions{})
+		if err != nil {
+			return nil, err
+		}
+		b, err := readArchive(reader, nil)
+		reader.Close()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, b.historyEntry(object.Key, object.LastModified))
+	}
+	sortHistory(entries)
+	return entries, nil
+}
@@ -0,0 +1,99 @@
+package bundle
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSystemRepositoryHistory(t *testing.T) {
+	tempDir := t.TempDir()
+	repo := NewFileSystemRepository(tempDir)
+	ctx := context.TODO()
+
+	b := newSigningTestBundle(t)
+	if err := b.Stamp("alice"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := repo.Write("bundle-2025-01-01_10-00-00.tar.gz", *b); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// Ensure distinct timestamps, stamped to the second
+	time.Sleep(1100 * time.Millisecond)
+	if err := b.AddService("service2", map[string][]byte{"service2/policy.rego": []byte("package service2\n")}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := b.Stamp("bob"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := repo.Write("bundle-LATEST.tar.gz", *b); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	os.WriteFile(filepath.Join(tempDir, "other.tar.gz"), []byte("not a bundle"), 0644)
+	// Unreadable bundles are skipped
+	os.WriteFile(filepath.Join(tempDir, "bundle-broken.tar.gz"), []byte("not a bundle"), 0644)
+
+	entries, err := repo.History(ctx, "bundle-")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", entries)
+	}
+	latest, backup := entries[0], entries[1]
+	if latest.Name != "bundle-LATEST.tar.gz" || latest.Actor != "bob" || !strings.HasPrefix(latest.Revision, "2-") ||
+		!slices.Equal(latest.Services, []string{"service1", "service2"}) {
+		t.Errorf("unexpected latest entry %+v", latest)
+	}
+	if backup.Name != "bundle-2025-01-01_10-00-00.tar.gz" || backup.Actor != "alice" || !strings.HasPrefix(backup.Revision, "1-") ||
+		!slices.Equal(backup.Services, []string{"service1"}) {
+		t.Errorf("unexpected backup entry %+v", backup)
+	}
+	if !latest.Timestamp.After(backup.Timestamp) {
+		t.Errorf("expected the latest entry to be more recent, got %v and %v", latest.Timestamp, backup.Timestamp)
+	}
+
+	// Rolling back to the backup records a new revision
+	restored, err := repo.Read(backup.Name)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	current, err := repo.Read(latest.Name)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	restored.PrepareRollback(current, backup.Name)
+	if err := restored.Stamp("carol"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := repo.Write("bundle-LATEST.tar.gz", *restored); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	entries, err = repo.History(ctx, "bundle-LATEST")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(entries) != 1 || !strings.HasPrefix(entries[0].Revision, "3-") || entries[0].RollbackOf != backup.Name ||
+		entries[0].Actor != "carol" || !slices.Equal(entries[0].Services, []string{"service1"}) {
+		t.Errorf("unexpected rollback entry %+v", entries)
+	}
+
+	// A later publication of the bundle is not a rollback anymore
+	reread, err := repo.Read("bundle-LATEST.tar.gz")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := reread.Stamp(""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := repo.Write("bundle-LATEST.tar.gz", *reread); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if entries, err := repo.History(ctx, "bundle-LATEST"); err != nil || entries[0].RollbackOf != "" {
+		t.Errorf("expected no rollback, got %+v %v", entries, err)
+	}
+}
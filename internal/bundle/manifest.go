@@ -0,0 +1,133 @@
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	opabundle "github.com/open-policy-agent/opa/v1/bundle"
+)
+
+// MainRoot is the root of the main policy and of the data shared by the services, such as the region hierarchy.
+const MainRoot = "teadal"
+
+// contentHashKey is the manifest metadata key of the hash of the modules and data of the bundle.
+const contentHashKey = "content_hash"
+
+// ServiceRoot returns the root of the namespace of a service, holding its packages and data, e.g. data.orders.
+func ServiceRoot(serviceName string) string {
+	return strings.ReplaceAll(serviceName, ".", "/")
+}
+
+// Roots returns the roots of the bundle: the main root followed by the root of each service.
+func (b *Bundle) Roots() ([]string, error) {
+	services, err := b.Services()
+	if err != nil {
+		return nil, err
+	}
+	roots := []string{MainRoot}
+	for _, service := range services {
+		roots = append(roots, ServiceRoot(service))
+	}
+	return roots, nil
+}
+
+// Revision returns the revision number and the content hash stamped by the last publication of the bundle, zero and
+// empty if it was never stamped.
+func (b *Bundle) Revision() (int, string) {
+	number, _, _ := strings.Cut(b.bundle.Manifest.Revision, "-")
+	revision, err := strconv.Atoi(number)
+	if err != nil {
+		revision = 0
+	}
+	hash, _ := b.bundle.Manifest.Metadata[contentHashKey].(string)
+	return revision, hash
+}
+
+// Stamp prepares the manifest of a bundle about to be published as the latest one: the roots are derived from the
+// services, so that OPA refuses policies outside of them, and the revision is incremented and suffixed by the content
+// hash, e.g. 3-4f2a9c1b7d0e, so that the OPA status reports tell which version of the policies is active. The actor
+// and the time of the publication are also recorded for the history. Copies of a bundle, such as a downloaded one,
+// are written without stamping, so that they keep the revision OPA reports.
+func (b *Bundle) Stamp(actor string) error {
+	if b.bundle.Manifest.Metadata == nil {
+		b.bundle.Manifest.Metadata = make(map[string]interface{})
+	}
+	if roots, err := b.Roots(); err == nil {
+		b.bundle.Manifest.Roots = &roots
+	}
+	hash, err := b.contentHash()
+	if err != nil {
+		return fmt.Errorf("failed to hash bundle content: %v", err)
+	}
+	revision, _ := b.Revision()
+	b.bundle.Manifest.Revision = fmt.Sprintf("%d-%s", revision+1, strings.TrimPrefix(hash, "sha256:")[:12])
+	b.bundle.Manifest.Metadata[contentHashKey] = hash
+	b.stampHistory(actor)
+	return nil
+}
+
+// contentHash returns the SHA-256 hash of the modules, sorted by path, and of the data of the bundle.
+func (b *Bundle) contentHash() (string, error) {
+	modules := slices.Clone(b.bundle.Modules)
+	slices.SortFunc(modules, func(a, b opabundle.ModuleFile) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	hash := sha256.New()
+	for _, module := range modules {
+		hash.Write([]byte(module.Path))
+		hash.Write([]byte{0})
+		hash.Write(module.Raw)
+		hash.Write([]byte{0})
+	}
+	// Maps are encoded with sorted keys, so equal data always has the same encoding
+	data, err := json.Marshal(b.bundle.Data)
+	if err != nil {
+		return "", err
+	}
+	hash.Write(data)
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// checkServiceRoot checks that the root of a new service does not overlap the roots of the bundle, and that the
+// packages of its modules are within its root.
+func (b *Bundle) checkServiceRoot(serviceName string, modules []opabundle.ModuleFile) error {
+	root := ServiceRoot(serviceName)
+	services, _ := b.Services()
+	if !slices.Contains(services, serviceName) {
+		roots, err := b.Roots()
+		if err != nil {
+			roots = []string{MainRoot}
+		}
+		for _, existing := range roots {
+			if rootsOverlap(root, existing) {
+				return fmt.Errorf("service %s collides with the root %s of the bundle", serviceName, existing)
+			}
+		}
+	}
+	for _, module := range modules {
+		path := packageRoot(module)
+		if path != root && !strings.HasPrefix(path, root+"/") {
+			return fmt.Errorf("module %s declares package %s outside of the root %s of service %s", module.Path, module.Parsed.Package.Path, root, serviceName)
+		}
+	}
+	return nil
+}
+
+// packageRoot returns the slash separated path of the package of a module, e.g. orders/oidc for data.orders.oidc.
+func packageRoot(module opabundle.ModuleFile) string {
+	keys := make([]string, 0, len(module.Parsed.Package.Path))
+	for _, term := range module.Parsed.Package.Path[1:] {
+		keys = append(keys, strings.Trim(term.String(), `"`))
+	}
+	return strings.Join(keys, "/")
+}
+
+// rootsOverlap reports whether one of the roots contains the other.
+func rootsOverlap(a string, b string) bool {
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
@@ -0,0 +1,69 @@
+package bundle
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStampManifest(t *testing.T) {
+	tempDir := t.TempDir()
+	repo := NewFileSystemRepository(tempDir)
+	b := newSigningTestBundle(t)
+	if revision, hash := b.Revision(); revision != 0 || hash != "" {
+		t.Fatalf("expected no revision before the first stamp, got %d %s", revision, hash)
+	}
+
+	if err := b.Stamp("alice"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := repo.Write("bundle.tar.gz", *b); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	first, err := repo.Read("bundle.tar.gz")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	revision, hash := first.Revision()
+	if revision != 1 || !strings.HasPrefix(hash, "sha256:") {
+		t.Fatalf("expected revision 1 with a content hash, got %d %s", revision, hash)
+	}
+	if !strings.HasPrefix(first.bundle.Manifest.Revision, "1-"+strings.TrimPrefix(hash, "sha256:")[:12]) {
+		t.Errorf("expected the revision to contain the content hash, got %s", first.bundle.Manifest.Revision)
+	}
+	if first.bundle.Manifest.Roots == nil || !slices.Equal(*first.bundle.Manifest.Roots, []string{"teadal", "service1"}) {
+		t.Errorf("expected the roots of the services, got %v", first.bundle.Manifest.Roots)
+	}
+
+	// Writing a copy of the bundle keeps its manifest, so that it matches the revision OPA reports
+	if err := repo.Write("copy.tar.gz", *first); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	copied, err := repo.Read("copy.tar.gz")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if copied.bundle.Manifest.Revision != first.bundle.Manifest.Revision ||
+		copied.bundle.Manifest.Metadata[writtenAtKey] != first.bundle.Manifest.Metadata[writtenAtKey] {
+		t.Errorf("expected the copy to keep manifest %v, got %v", first.bundle.Manifest, copied.bundle.Manifest)
+	}
+
+	// Stamping the same content again increments the revision but keeps the hash
+	if err := first.Stamp("alice"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if revision, secondHash := first.Revision(); revision != 2 || secondHash != hash {
+		t.Errorf("expected revision 2 with hash %s, got %d %s", hash, revision, secondHash)
+	}
+
+	// Changing the data changes the hash
+	if err := first.SetData("service1/config", map[string]interface{}{"enabled": false}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := first.Stamp("alice"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if revision, thirdHash := first.Revision(); revision != 3 || thirdHash == hash {
+		t.Errorf("expected revision 3 with a new hash, got %d %s", revision, thirdHash)
+	}
+}
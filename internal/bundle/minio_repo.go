@@ -1,6 +1,7 @@
 package bundle
 
 import (
+	"bytes"
 	"context"
 	"dspn-regogenerator/internal/config"
 	"fmt"
@@ -15,6 +16,8 @@ import (
 type MinioRepository struct {
 	client *minio.Client
 	bucket string
+	// Keys verifying the read bundles, if any
+	signingKeys *SigningKeys
 }
 
 // Read implements [Repository].
@@ -25,13 +28,40 @@ func (m *MinioRepository) Read(path string) (*Bundle, error) {
 	}
 	defer reader.Close()
 
-	if bundle, err := NewFromArchive(context.Background(), reader); err != nil {
+	verification, err := m.signingKeys.verificationConfig()
+	if err != nil {
+		return nil, err
+	}
+	if bundle, err := readArchive(reader, verification); err != nil {
 		return nil, err
 	} else {
 		return bundle, nil
 	}
 }
 
+// ReadArchive reads the archive of the bundle as stored, after checking that it is a valid bundle and verifying it
+// like [MinioRepository.Read], so that it can be copied byte for byte.
+func (m *MinioRepository) ReadArchive(path string) ([]byte, error) {
+	reader, err := m.client.GetObject(context.Background(), m.bucket, path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	archive, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	verification, err := m.signingKeys.verificationConfig()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := readArchive(bytes.NewReader(archive), verification); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
 // Write implements [Repository].
 func (m *MinioRepository) Write(path string, bundle Bundle) error {
 	reader, writer := io.Pipe()
@@ -72,15 +102,25 @@ func NewMinioRepository(endpoint, accessKey, secretKey string, secure bool, buck
 }
 
 // Create a bundle repository that uses Minio as the backend.
-// The Minio client is created using the package configuration.
+// The Minio client and the keys verifying the bundles are created using the package configuration.
 func NewMinioRepositoryFromConfig() (*MinioRepository, error) {
-	return NewMinioRepository(
+	repo, err := NewMinioRepository(
 		config.MinioEndpoint,
 		config.MinioAccessKey,
 		config.MinioSecretKey,
 		false,
 		config.MinioBucket,
 	)
+	if err != nil {
+		return nil, err
+	}
+	return repo.WithSigningKeys(NewSigningKeysFromConfig()), nil
+}
+
+// WithSigningKeys verifies the bundles read from the repository with the keys.
+func (m *MinioRepository) WithSigningKeys(signingKeys *SigningKeys) *MinioRepository {
+	m.signingKeys = signingKeys
+	return m
 }
 
 var _ Repository = &MinioRepository{}
@@ -1,10 +1,17 @@
 package bundle
 
+import "context"
+
 // Repository is an interface for writing bundle to a storage system.
 type Repository interface {
-	// Write a bundle to the repository, returning an error if it fails.
+	// Write a bundle to the repository as is, returning an error if it fails. Bundles being published must be stamped
+	// and signed first.
 	Write(path string, bundle Bundle) error
 
 	// Read reads the bundle from the repository, returning the bundle and an error if it fails.
 	Read(path string) (*Bundle, error)
+
+	// History describes the bundles whose name starts with the prefix, from the most recently written one, skipping
+	// the ones that cannot be read.
+	History(ctx context.Context, prefix string) ([]HistoryEntry, error)
 }
@@ -0,0 +1,72 @@
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// RetentionPolicy selects the backups of the bundle to keep: a backup is kept if it is one of the KeepLast most recent
+// ones, or if it was taken in the last KeepFor. A zero value does not limit, so every backup is kept if both are zero.
+type RetentionPolicy struct {
+	KeepLast int
+	KeepFor  time.Duration
+}
+
+// Backup is a backup of the latest bundle, stored with the name. Time is when the backup was taken, not when its
+// content was written, as a bundle left unchanged for long is still the only way back to the previous policies.
+type Backup struct {
+	Name string
+	Time time.Time
+}
+
+// Unlimited reports whether the policy keeps every backup.
+func (p RetentionPolicy) Unlimited() bool {
+	return p.KeepLast <= 0 && p.KeepFor <= 0
+}
+
+// Expired returns the backups not kept by the policy at the given time, from the most recent one.
+func (p RetentionPolicy) Expired(backups []Backup, now time.Time) []Backup {
+	expired := []Backup{}
+	if p.Unlimited() {
+		return expired
+	}
+	backups = slices.Clone(backups)
+	slices.SortStableFunc(backups, func(a, b Backup) int {
+		return b.Time.Compare(a.Time)
+	})
+	for index, backup := range backups {
+		if index < p.KeepLast || (p.KeepFor > 0 && now.Sub(backup.Time) <= p.KeepFor) {
+			continue
+		}
+		expired = append(expired, backup)
+	}
+	return expired
+}
+
+// ListBundles lists the bundles whose name starts with the prefix, with the time they were stored, from the object
+// listing only: the bundles are not read, so that an unreadable one cannot prevent the others from being pruned.
+func (m *MinioRepository) ListBundles(ctx context.Context, prefix string) ([]Backup, error) {
+	backups := []Backup{}
+	for object := range m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		if strings.HasSuffix(object.Key, ".tar.gz") {
+			backups = append(backups, Backup{Name: object.Key, Time: object.LastModified})
+		}
+	}
+	return backups, nil
+}
+
+// DeleteBundle deletes the bundle with the provided name from the bucket.
+func (m *MinioRepository) DeleteBundle(ctx context.Context, bundleName string) error {
+	if err := m.client.RemoveObject(ctx, m.bucket, bundleName, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("error deleting bundle %s: %v", bundleName, err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package bundle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyExpired(t *testing.T) {
+	now := time.Date(2025, 6, 30, 12, 0, 0, 0, time.UTC)
+	// One backup per day, from the most recent one, listed out of order
+	backups := []Backup{}
+	for _, day := range []int{3, 0, 5, 1, 4, 2} {
+		backups = append(backups, Backup{Name: string(rune('a' + day)), Time: now.AddDate(0, 0, -day)})
+	}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   string
+	}{
+		{name: "unlimited", policy: RetentionPolicy{}, want: ""},
+		{name: "keep last", policy: RetentionPolicy{KeepLast: 2}, want: "cdef"},
+		{name: "keep for", policy: RetentionPolicy{KeepFor: 3 * 24 * time.Hour}, want: "ef"},
+		{name: "keep last or for", policy: RetentionPolicy{KeepLast: 5, KeepFor: 24 * time.Hour}, want: "f"},
+		{name: "keep for or last", policy: RetentionPolicy{KeepLast: 1, KeepFor: 2 * 24 * time.Hour}, want: "def"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ""
+			for _, backup := range test.policy.Expired(backups, now) {
+				got += backup.Name
+			}
+			if got != test.want {
+				t.Errorf("got expired backups %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package bundle
+
+import (
+	"context"
+	"dspn-regogenerator/internal/config"
+	"fmt"
+	"io"
+
+	opabundle "github.com/open-policy-agent/opa/v1/bundle"
+	"github.com/open-policy-agent/opa/v1/keys"
+)
+
+// SigningKeys holds the keys signing the published bundles, in the OPA .signatures.json format, and verifying the
+// bundles read from a repository. The keys are either given inline or as the path of a file holding them.
+type SigningKeys struct {
+	// KeyID identifies the key in the signatures, and must match the key configured for the bundle in OPA
+	KeyID string
+	// Algorithm of the signatures, e.g. HS256 for an HMAC secret, RS256 or ES256 for RSA or ECDSA keys
+	Algorithm string
+	// SigningKey is the HMAC secret or the PEM encoded private key. Bundles are written unsigned if it is empty
+	SigningKey string
+	// VerificationKey is the HMAC secret or the PEM encoded public key. Bundles are read unverified if it is empty
+	VerificationKey string
+}
+
+// NewSigningKeysFromConfig returns the signing keys of the package configuration, or nil if no key is configured.
+// The HMAC secret verifies the bundles it signs, while RSA and ECDSA keys need the public key to verify them.
+func NewSigningKeysFromConfig() *SigningKeys {
+	if config.BundleSigningKey == "" && config.BundleVerificationKey == "" {
+		return nil
+	}
+	verificationKey := config.BundleVerificationKey
+	if verificationKey == "" && isHMAC(config.BundleSigningAlgorithm) {
+		verificationKey = config.BundleSigningKey
+	}
+	return &SigningKeys{
+		KeyID:           config.BundleKeyID,
+		Algorithm:       config.BundleSigningAlgorithm,
+		SigningKey:      config.BundleSigningKey,
+		VerificationKey: verificationKey,
+	}
+}
+
+func isHMAC(algorithm string) bool {
+	return algorithm == "HS256" || algorithm == "HS384" || algorithm == "HS512"
+}
+
+// Sign replaces the signatures of a bundle about to be published with a signature of its current content, or drops
+// them if there is no signing key, as they would not match the content anymore. It must follow [Bundle.Stamp], which
+// changes the manifest.
+func (b *Bundle) Sign(k *SigningKeys) error {
+	b.bundle.Signatures = opabundle.SignaturesConfig{}
+	if k == nil || k.SigningKey == "" {
+		return nil
+	}
+	if err := b.bundle.GenerateSignature(opabundle.NewSigningConfig(k.SigningKey, k.Algorithm, ""), k.KeyID, false); err != nil {
+		return fmt.Errorf("failed to sign bundle: %v", err)
+	}
+	return nil
+}
+
+// verificationConfig returns the configuration verifying the signatures of the bundles, or nil if there is no
+// verification key. As the key id is set, unsigned bundles are refused.
+func (k *SigningKeys) verificationConfig() (*opabundle.VerificationConfig, error) {
+	if k == nil || k.VerificationKey == "" {
+		return nil, nil
+	}
+	key, err := keys.NewKeyConfig(k.VerificationKey, k.Algorithm, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid verification key: %v", err)
+	}
+	return opabundle.NewVerificationConfig(map[string]*opabundle.KeyConfig{k.KeyID: key}, k.KeyID, "", nil), nil
+}
+
+// NewVerifiedFromArchive creates a new Bundle from an archive reader like NewFromArchive, verifying its signature with
+// the keys. Unsigned bundles and bundles whose content does not match the signature are refused.
+func NewVerifiedFromArchive(ctx context.Context, reader io.Reader, signingKeys *SigningKeys) (*Bundle, error) {
+	verification, err := signingKeys.verificationConfig()
+	if err != nil {
+		return nil, err
+	}
+	if verification == nil {
+		return nil, fmt.Errorf("no verification key")
+	}
+	return readArchive(reader, verification)
+}
@@ -0,0 +1,151 @@
+package bundle
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	opabundle "github.com/open-policy-agent/opa/v1/bundle"
+)
+
+// newSigningTestBundle returns a bundle with a single service module.
+func newSigningTestBundle(t *testing.T) *Bundle {
+	t.Helper()
+	tempDir := t.TempDir()
+	os.Mkdir(tempDir+"/service1", 0755)
+	os.WriteFile(tempDir+"/service1/policy.rego", []byte("package service1\n\nallow := true\n"), 0644)
+	b, err := NewFromFS(context.TODO(), os.DirFS(tempDir), "service1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := b.SetData("service1/config", map[string]interface{}{"enabled": true}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return b
+}
+
+func TestSignedFileSystemRepository(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	privateDER, err := x509.MarshalECPrivateKey(ecdsaKey)
+	if err != nil {
+		t.Fatalf("failed to encode private key: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&ecdsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to encode public key: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		keys *SigningKeys
+	}{
+		{name: "HMAC", keys: &SigningKeys{KeyID: "teadal", Algorithm: "HS256", SigningKey: "secret", VerificationKey: "secret"}},
+		{name: "ECDSA", keys: &SigningKeys{
+			KeyID:           "teadal",
+			Algorithm:       "ES256",
+			SigningKey:      string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateDER})),
+			VerificationKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			repo := NewFileSystemRepository(tempDir).WithSigningKeys(test.keys)
+			signed := newSigningTestBundle(t)
+			if err := signed.Sign(test.keys); err != nil {
+				t.Fatalf("expected no error signing the bundle, got %v", err)
+			}
+			if err := repo.Write("signed.tar.gz", *signed); err != nil {
+				t.Fatalf("expected no error writing the bundle, got %v", err)
+			}
+			loaded, err := repo.Read("signed.tar.gz")
+			if err != nil {
+				t.Fatalf("expected the signed bundle to be verified, got %v", err)
+			}
+			if len(loaded.bundle.Signatures.Signatures) != 1 {
+				t.Errorf("expected 1 signature, got %v", loaded.bundle.Signatures)
+			}
+			if value, ok := loaded.GetData("service1/config/enabled"); !ok || value != true {
+				t.Errorf("expected the data to be read, got %v", value)
+			}
+
+			// A bundle modified after signing keeps the signature of the original content
+			loaded.bundle.Modules[0].Raw = []byte("package service1\n\nallow := false\n")
+			tampered, err := os.Create(filepath.Join(tempDir, "tampered.tar.gz"))
+			if err != nil {
+				t.Fatalf("failed to create tampered bundle: %v", err)
+			}
+			if err := opabundle.NewWriter(tampered).Write(*loaded.bundle); err != nil {
+				t.Fatalf("failed to write tampered bundle: %v", err)
+			}
+			tampered.Close()
+			if _, err := repo.Read("tampered.tar.gz"); err == nil {
+				t.Errorf("expected the tampered bundle to be refused")
+			}
+
+			if err := NewFileSystemRepository(tempDir).Write("unsigned.tar.gz", *newSigningTestBundle(t)); err != nil {
+				t.Fatalf("expected no error writing the unsigned bundle, got %v", err)
+			}
+			if _, err := repo.Read("unsigned.tar.gz"); err == nil || !strings.Contains(err.Error(), "missing .signatures.json") {
+				t.Errorf("expected the unsigned bundle to be refused, got %v", err)
+			}
+			// Repositories without keys read the signed bundles without verifying them
+			if _, err := NewFileSystemRepository(tempDir).Read("signed.tar.gz"); err != nil {
+				t.Errorf("expected the signed bundle to be read without keys, got %v", err)
+			}
+
+			// A copy of the archive written by a repository without keys keeps the signatures
+			archive, err := os.ReadFile(filepath.Join(tempDir, "signed.tar.gz"))
+			if err != nil {
+				t.Fatalf("failed to read signed bundle: %v", err)
+			}
+			if err := NewFileSystemRepository(tempDir).WriteArchive("copy/signed.tar.gz", archive); err != nil {
+				t.Fatalf("expected no error copying the bundle, got %v", err)
+			}
+			if _, err := repo.Read("copy/signed.tar.gz"); err != nil {
+				t.Errorf("expected the copied bundle to be verified, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewVerifiedFromArchive(t *testing.T) {
+	tempDir := t.TempDir()
+	keys := &SigningKeys{KeyID: "teadal", Algorithm: "HS256", SigningKey: "secret", VerificationKey: "secret"}
+	signed := newSigningTestBundle(t)
+	if err := signed.Sign(keys); err != nil {
+		t.Fatalf("expected no error signing the bundle, got %v", err)
+	}
+	if err := NewFileSystemRepository(tempDir).Write("signed.tar.gz", *signed); err != nil {
+		t.Fatalf("expected no error writing the bundle, got %v", err)
+	}
+	open := func() *os.File {
+		file, err := os.Open(filepath.Join(tempDir, "signed.tar.gz"))
+		if err != nil {
+			t.Fatalf("failed to open bundle: %v", err)
+		}
+		t.Cleanup(func() { file.Close() })
+		return file
+	}
+
+	if _, err := NewVerifiedFromArchive(context.TODO(), open(), keys); err != nil {
+		t.Errorf("expected the bundle to be verified, got %v", err)
+	}
+	wrongKey := &SigningKeys{KeyID: "teadal", Algorithm: "HS256", VerificationKey: "other"}
+	if _, err := NewVerifiedFromArchive(context.TODO(), open(), wrongKey); err == nil {
+		t.Errorf("expected the bundle to be refused with another key")
+	}
+	if _, err := NewVerifiedFromArchive(context.TODO(), open(), nil); err == nil {
+		t.Errorf("expected an error without verification key")
+	}
+}
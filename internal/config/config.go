@@ -44,6 +44,44 @@ var (
 	// The timeout for MinIO operations in seconds.
 	// The default value is 5 seconds, load from environment variable MINIO_TIMEOUT.
 	MinioTimeout int
+
+	// The timeout for fetching the OIDC configuration and the keys of the identity providers in seconds.
+	// The default value is 10 seconds, load from environment variable KEYS_FETCH_TIMEOUT.
+	KeysFetchTimeout int
+
+	// URL of the quota service queried by the generated policies to enforce call limits.
+	// The default value is "http://localhost:8090/count", load from environment variable QUOTA_SERVICE_URL.
+	QuotaServiceURL string
+
+	// The HMAC secret or PEM encoded private key signing the bundles, or the path of a file holding it.
+	// Bundles are written unsigned if empty, the default, load from environment variable BUNDLE_SIGNING_KEY.
+	BundleSigningKey string
+
+	// The HMAC secret or PEM encoded public key verifying the bundles, or the path of a file holding it.
+	// The signing key is used for HMAC algorithms if empty, the default, load from environment variable BUNDLE_VERIFICATION_KEY.
+	BundleVerificationKey string
+
+	// The algorithm of the bundle signatures, e.g. HS256, RS256 or ES256.
+	// The default value is "RS256", load from environment variable BUNDLE_SIGNING_ALG.
+	BundleSigningAlgorithm string
+
+	// The id of the key signing the bundles, as configured in the OPA bundle verification.
+	// The default value is "teadal", load from environment variable BUNDLE_KEY_ID.
+	BundleKeyID string
+
+	// The number of most recent timestamped bundle backups kept in the bucket, 0 for no limit.
+	// The default value is 0, load from environment variable BUNDLE_RETENTION_COUNT.
+	BundleRetentionCount int
+
+	// The number of days the timestamped bundle backups are kept in the bucket, 0 for no limit.
+	// The default value is 0, load from environment variable BUNDLE_RETENTION_DAYS.
+	// Backups are kept if either the count or the days keep them, and all of them are kept if both are 0.
+	BundleRetentionDays int
+
+	// The path of a JSON file mapping each region to the regions directly containing it, written as region hierarchy
+	// of the bundle. If empty, the default, bundles with no hierarchy get the built-in one and the others keep theirs,
+	// load from environment variable REGIONS_FILE.
+	RegionsFile string
 )
 
 // ReloadConfig initializes or reloads the global variables based on the current environment variables. There is no need to call this function manually, as it is automatically called when the package is loaded.
@@ -57,12 +95,33 @@ func ReloadConfig() {
 	TagBundleName = func(tag string) string {
 		return MinioBundlePrefix + "-" + tag + ".tar.gz"
 	}
+	QuotaServiceURL = GetEnvOrDefault("QUOTA_SERVICE_URL", "http://localhost:8090/count")
+	BundleSigningKey = GetEnvOrDefault("BUNDLE_SIGNING_KEY", "")
+	BundleVerificationKey = GetEnvOrDefault("BUNDLE_VERIFICATION_KEY", "")
+	BundleSigningAlgorithm = GetEnvOrDefault("BUNDLE_SIGNING_ALG", "RS256")
+	BundleKeyID = GetEnvOrDefault("BUNDLE_KEY_ID", "teadal")
+	RegionsFile = GetEnvOrDefault("REGIONS_FILE", "")
 	var err error
 	MinioTimeout, err = strconv.Atoi(GetEnvOrDefault("MINIO_TIMEOUT", "5"))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing MINIO_TIMEOUT: %v\n", err)
 		MinioTimeout = 5
 	}
+	KeysFetchTimeout, err = strconv.Atoi(GetEnvOrDefault("KEYS_FETCH_TIMEOUT", "10"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing KEYS_FETCH_TIMEOUT: %v\n", err)
+		KeysFetchTimeout = 10
+	}
+	BundleRetentionCount, err = strconv.Atoi(GetEnvOrDefault("BUNDLE_RETENTION_COUNT", "0"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing BUNDLE_RETENTION_COUNT: %v\n", err)
+		BundleRetentionCount = 0
+	}
+	BundleRetentionDays, err = strconv.Atoi(GetEnvOrDefault("BUNDLE_RETENTION_DAYS", "0"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing BUNDLE_RETENTION_DAYS: %v\n", err)
+		BundleRetentionDays = 0
+	}
 }
 
 func init() {
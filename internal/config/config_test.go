@@ -24,6 +24,15 @@ func TestLoadDefaultConfig(t *testing.T) {
 	if TagBundleName("v1") != "teadal-policy-bundle-v1.tar.gz" {
 		t.Errorf("Expected TagBundleName('v1') to be 'teadal-policy-bundle-v1.tar.gz', got '%s'", TagBundleName("v1"))
 	}
+	if QuotaServiceURL != "http://localhost:8090/count" {
+		t.Errorf("Expected QuotaServiceURL to be 'http://localhost:8090/count', got '%s'", QuotaServiceURL)
+	}
+	if KeysFetchTimeout != 10 {
+		t.Errorf("Expected KeysFetchTimeout to be 10, got %d", KeysFetchTimeout)
+	}
+	if BundleRetentionCount != 0 || BundleRetentionDays != 0 {
+		t.Errorf("Expected no bundle retention limit, got %d backups and %d days", BundleRetentionCount, BundleRetentionDays)
+	}
 }
 
 func TestLoadEnvConfig(t *testing.T) {
@@ -32,6 +41,10 @@ func TestLoadEnvConfig(t *testing.T) {
 	t.Setenv("MINIO_SECRET_KEY", "test-secret-key")
 	t.Setenv("BUCKET_NAME", "test-bucket")
 	t.Setenv("MINIO_BUNDLE_PREFIX", "test-bundle-prefix")
+	t.Setenv("QUOTA_SERVICE_URL", "http://quota:8080/count")
+	t.Setenv("KEYS_FETCH_TIMEOUT", "3")
+	t.Setenv("BUNDLE_RETENTION_COUNT", "10")
+	t.Setenv("BUNDLE_RETENTION_DAYS", "30")
 	ReloadConfig()
 	if MinioEndpoint != "test-endpoint" {
 		t.Errorf("Expected MinioEndpoint to be 'test-endpoint', got '%s'", MinioEndpoint)
@@ -54,4 +67,16 @@ func TestLoadEnvConfig(t *testing.T) {
 	if TagBundleName("v1") != "test-bundle-prefix-v1.tar.gz" {
 		t.Errorf("Expected TagBundleName('v1') to be 'test-bundle-prefix-v1.tar.gz', got '%s'", TagBundleName("v1"))
 	}
+	if QuotaServiceURL != "http://quota:8080/count" {
+		t.Errorf("Expected QuotaServiceURL to be 'http://quota:8080/count', got '%s'", QuotaServiceURL)
+	}
+	if KeysFetchTimeout != 3 {
+		t.Errorf("Expected KeysFetchTimeout to be 3, got %d", KeysFetchTimeout)
+	}
+	if BundleRetentionCount != 10 {
+		t.Errorf("Expected BundleRetentionCount to be 10, got %d", BundleRetentionCount)
+	}
+	if BundleRetentionDays != 30 {
+		t.Errorf("Expected BundleRetentionDays to be 30, got %d", BundleRetentionDays)
+	}
 }
@@ -0,0 +1,78 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type AttributeKind string
+
+const (
+	// The attribute is read from a request header
+	AttributeHeader AttributeKind = "header"
+	// The attribute is read from a query parameter
+	AttributeQuery AttributeKind = "query"
+	// The attribute is read from a claim of the token payload, nested claims are separated by dots
+	AttributeClaim AttributeKind = "claim"
+)
+
+// AttributeSource identifies where the generated policies read a request attribute from.
+type AttributeSource struct {
+	Kind AttributeKind
+	Name string
+}
+
+// DefaultTimelinessSource is the attribute holding the data timestamp when the service does not specify one.
+var DefaultTimelinessSource = AttributeSource{Kind: AttributeHeader, Name: "x-data-timestamp"}
+
+// DefaultLocationSource is the attribute holding the request location when the service does not specify one.
+var DefaultLocationSource = AttributeSource{Kind: AttributeClaim, Name: "location"}
+
+// ParseAttributeSource parses an attribute source in the form <kind>:<name>, e.g. "header:x-data-timestamp" or "claim:organization.country".
+func ParseAttributeSource(value string) (AttributeSource, error) {
+	kind, name, found := strings.Cut(value, ":")
+	if !found || name == "" {
+		return AttributeSource{}, fmt.Errorf("invalid attribute source %q, expected <kind>:<name>", value)
+	}
+	source := AttributeSource{Kind: AttributeKind(kind), Name: name}
+	switch source.Kind {
+	case AttributeHeader:
+		// Envoy forwards header names in lower case
+		source.Name = strings.ToLower(name)
+	case AttributeQuery, AttributeClaim:
+	default:
+		return AttributeSource{}, fmt.Errorf("invalid attribute source kind %q, expected header, query or claim", kind)
+	}
+	return source, nil
+}
+
+// String returns the attribute source in the form accepted by ParseAttributeSource.
+func (s AttributeSource) String() string {
+	return string(s.Kind) + ":" + s.Name
+}
+
+// Rego returns the Rego reference to the attribute value in the service package.
+func (s AttributeSource) Rego() string {
+	switch s.Kind {
+	case AttributeHeader:
+		return "request.headers" + regoIndex(s.Name)
+	case AttributeQuery:
+		return "input.parsed_query" + regoIndex(s.Name) + "[0]"
+	case AttributeClaim:
+		ref := "token.payload"
+		for _, claim := range strings.Split(s.Name, ".") {
+			ref += regoIndex(claim)
+		}
+		return ref
+	}
+	return ""
+}
+
+func regoIndex(key string) string {
+	keyJson, err := json.Marshal(key)
+	if err != nil {
+		panic(err)
+	}
+	return "[" + string(keyJson) + "]"
+}
@@ -0,0 +1,46 @@
+package generator
+
+import "testing"
+
+func TestParseAttributeSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    AttributeSource
+		wantErr bool
+	}{
+		{name: "header", value: "header:X-Data-Timestamp", want: AttributeSource{Kind: AttributeHeader, Name: "x-data-timestamp"}},
+		{name: "query", value: "query:since", want: AttributeSource{Kind: AttributeQuery, Name: "since"}},
+		{name: "nested claim", value: "claim:organization.country", want: AttributeSource{Kind: AttributeClaim, Name: "organization.country"}},
+		{name: "missing name", value: "header:", wantErr: true},
+		{name: "missing kind", value: "timestamp", wantErr: true},
+		{name: "unknown kind", value: "cookie:timestamp", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseAttributeSource(test.value)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseAttributeSource(%q) error = %v, wantErr %v", test.value, err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("ParseAttributeSource(%q) = %v, want %v", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestAttributeSourceRego(t *testing.T) {
+	tests := []struct {
+		source AttributeSource
+		want   string
+	}{
+		{source: AttributeSource{Kind: AttributeHeader, Name: "x-data-timestamp"}, want: `request.headers["x-data-timestamp"]`},
+		{source: AttributeSource{Kind: AttributeQuery, Name: "since"}, want: `input.parsed_query["since"][0]`},
+		{source: AttributeSource{Kind: AttributeClaim, Name: "organization.country"}, want: `token.payload["organization"]["country"]`},
+	}
+	for _, test := range tests {
+		if got := test.source.Rego(); got != test.want {
+			t.Errorf("Rego() = %s, want %s", got, test.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// PinnedKeys holds the keys of the identity providers trusted by a service, embedded in the bundle data so that the
+// generated policies verify the tokens without sending requests to the providers.
+type PinnedKeys struct {
+	// OIDC discovery urls the keys are fetched from when they are refreshed
+	MetadataURLs []string `json:"metadata_urls"`
+	// JWKS of each identity provider, by issuer
+	Issuers map[string]interface{} `json:"issuers"`
+}
+
+// PinnedKeysDataPath returns the path of the pinned keys of a service in the bundle data, available to its policies
+// as data.<service>.pinned_keys.
+func PinnedKeysDataPath(serviceName string) string {
+	return serviceName + "/pinned_keys"
+}
+
+// FetchPinnedKeys fetches the OIDC configuration of each identity provider, then the JWKS it refers to.
+func FetchPinnedKeys(ctx context.Context, metadataURLs []string) (*PinnedKeys, error) {
+	keys := &PinnedKeys{MetadataURLs: metadataURLs, Issuers: make(map[string]interface{})}
+	for _, metadataURL := range metadataURLs {
+		var metadata struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := getJSON(ctx, metadataURL, &metadata); err != nil {
+			return nil, fmt.Errorf("failed to fetch OIDC configuration: %v", err)
+		}
+		if metadata.Issuer == "" || metadata.JWKSURI == "" {
+			return nil, fmt.Errorf("OIDC configuration at %s has no issuer or jwks_uri", metadataURL)
+		}
+		var jwks interface{}
+		if err := getJSON(ctx, metadata.JWKSURI, &jwks); err != nil {
+			return nil, fmt.Errorf("failed to fetch JWKS of %s: %v", metadata.Issuer, err)
+		}
+		keys.Issuers[metadata.Issuer] = jwks
+	}
+	if err := keys.validate(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// ParsePinnedKeys reads the keys of the identity providers from a JSON object mapping each issuer to its JWKS,
+// for deployments where the providers cannot be reached at generation time.
+func ParsePinnedKeys(data []byte, metadataURLs []string) (*PinnedKeys, error) {
+	keys := &PinnedKeys{MetadataURLs: metadataURLs}
+	if err := json.Unmarshal(data, &keys.Issuers); err != nil {
+		return nil, fmt.Errorf("invalid pinned keys: %v", err)
+	}
+	if err := keys.validate(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// validate checks that there is at least one issuer and that each JWKS holds at least one key.
+func (k *PinnedKeys) validate() error {
+	if len(k.Issuers) == 0 {
+		return fmt.Errorf("no pinned keys")
+	}
+	for issuer, jwks := range k.Issuers {
+		set, ok := jwks.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("JWKS of %s is not an object", issuer)
+		}
+		if keys, ok := set["keys"].([]interface{}); !ok || len(keys) == 0 {
+			return fmt.Errorf("JWKS of %s has no keys", issuer)
+		}
+	}
+	return nil
+}
+
+func getJSON(ctx context.Context, url string, value interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, response.Status)
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, value); err != nil {
+		return fmt.Errorf("invalid JSON from %s: %v", url, err)
+	}
+	return nil
+}
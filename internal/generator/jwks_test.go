@@ -0,0 +1,104 @@
+package generator
+
+import (
+	"context"
+	"dspn-regogenerator/internal/policy"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/util"
+)
+
+func TestFetchPinnedKeys(t *testing.T) {
+	provider := newTestIdentityProvider(t)
+
+	keys, err := FetchPinnedKeys(context.Background(), []string{provider.metadataURL})
+	if err != nil {
+		t.Fatalf("FetchPinnedKeys returned an error: %v", err)
+	}
+	if len(keys.MetadataURLs) != 1 || keys.MetadataURLs[0] != provider.metadataURL {
+		t.Errorf("Expected metadata urls [%s], got %v", provider.metadataURL, keys.MetadataURLs)
+	}
+	jwks, ok := keys.Issuers[provider.server.URL].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected the JWKS of issuer %s, got %v", provider.server.URL, keys.Issuers)
+	}
+	if len(jwks["keys"].([]interface{})) != 1 {
+		t.Errorf("Expected 1 key, got %v", jwks["keys"])
+	}
+
+	if _, err := FetchPinnedKeys(context.Background(), []string{provider.server.URL + "/missing"}); err == nil {
+		t.Errorf("Expected an error for an unreachable OIDC configuration")
+	}
+}
+
+func TestParsePinnedKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "valid", data: `{"https://idp.example.com/realms/teadal": {"keys": [{"kty": "RSA", "n": "AQAB", "e": "AQAB"}]}}`},
+		{name: "invalid JSON", data: `{`, wantErr: "invalid pinned keys"},
+		{name: "no issuers", data: `{}`, wantErr: "no pinned keys"},
+		{name: "not a JWKS", data: `{"https://idp.example.com": []}`, wantErr: "is not an object"},
+		{name: "no keys", data: `{"https://idp.example.com": {"keys": []}}`, wantErr: "has no keys"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys, err := ParsePinnedKeys([]byte(test.data), []string{"https://idp.example.com/.well-known/openid-configuration"})
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParsePinnedKeys returned an error: %v", err)
+				}
+				if len(keys.Issuers) != 1 || len(keys.MetadataURLs) != 1 {
+					t.Errorf("Unexpected pinned keys %+v", keys)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestGenerateServiceFolderPinnedKeys(t *testing.T) {
+	provider := newTestIdentityProvider(t)
+	keys, err := FetchPinnedKeys(context.Background(), []string{provider.metadataURL})
+	if err != nil {
+		t.Fatalf("FetchPinnedKeys returned an error: %v", err)
+	}
+	// The generated policies must verify the tokens without reaching the provider
+	provider.server.Close()
+
+	outputDir := t.TempDir()
+	options := ServiceOptions{ServiceName: "pinned", PinnedKeys: true}
+	if err := GenerateServiceFolder(options, outputDir, []string{provider.metadataURL}, &policy.GeneralPolicies{}); err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+
+	// Store the keys as the bundle would, at PinnedKeysDataPath
+	var value interface{} = keys
+	if err := util.RoundTrip(&value); err != nil {
+		t.Fatalf("Failed to convert pinned keys: %v", err)
+	}
+	data := map[string]interface{}{"pinned": map[string]interface{}{"pinned_keys": value}}
+	if PinnedKeysDataPath("pinned") != "pinned/pinned_keys" {
+		t.Fatalf("Unexpected data path %s", PinnedKeysDataPath("pinned"))
+	}
+
+	now := time.Now().Unix()
+	token := signToken(t, provider.key, map[string]interface{}{"iss": provider.server.URL, "exp": now + 300})
+	if !evalTokenValid(t, outputDir, "pinned", token, data) {
+		t.Errorf("Expected the token to be verified with the pinned keys")
+	}
+	untrusted := signToken(t, provider.key, map[string]interface{}{"iss": "https://other.example.com", "exp": now + 300})
+	if evalTokenValid(t, outputDir, "pinned", untrusted, data) {
+		t.Errorf("Expected the token of an issuer without pinned keys to be rejected")
+	}
+	if evalTokenValid(t, outputDir, "pinned", token, nil) {
+		t.Errorf("Expected the token to be rejected without pinned keys")
+	}
+}
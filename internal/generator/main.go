@@ -9,16 +9,40 @@ import (
 const ImportMarker = "# generator:import"
 const RuleMarker = "# generator:rule"
 
+// The main policy dispatches each request to exactly one service among the ones whose route matches it, so that the
+// policies of a service never decide on the requests of another one. The imports and the per service rules are
+// inserted at the markers.
 var mainTemplate = `package teadal
 %s
+# Services whose route matches the request are ranked by host, as the ones bound to the host of the request come first,
+# then by path prefix, the longest one first. Ties are broken by service name. The routes are referenced through data,
+# so that the policy stays valid when there are no services.
+route_rank(route) := [min([count(route.hosts), 1]), count(route.prefix)]
+
+best_rank := max({route_rank(route) | some route in data.teadal.routes})
+
+service := min({name | some name, route in data.teadal.routes; route_rank(route) == best_rank})
+
 default allow := false
 
+default reason := "request not routed to any service"
+
+reason := sprintf("request routed to service %%s", [service])
+
+# Envoy ext_authz response of the service the request is routed to. For the services that do not generate one, it is
+# built from allow, with the reason of the dispatch in the body of denied requests.
+result := data.teadal.service_result if {
+	data.teadal.service_result
+} else := {"allowed": true} if {
+	allow
+} else := {"allowed": false, "http_status": 403, "headers": {"content-type": "text/plain"}, "body": reason}
+
 %s`
 
 func generateImports(serviceNames []string) string {
 	imports := ""
 	for _, serviceName := range serviceNames {
-		imports += fmt.Sprintf(`import data.%s.allow as %s_allow`, serviceName, serviceName) + "\n"
+		imports += fmt.Sprintf(`import data.%s`, serviceName) + "\n"
 	}
 	imports += ImportMarker + "\n"
 	return imports
@@ -27,7 +51,16 @@ func generateImports(serviceNames []string) string {
 func generateRules(serviceNames []string) string {
 	rules := ""
 	for _, serviceName := range serviceNames {
-		rules += fmt.Sprintf(`allow if %s_allow`, serviceName) + "\n"
+		rules += fmt.Sprintf(`routes.%[1]s := %[1]s.route if %[1]s.route_matched
+
+allow if {
+	service == "%[1]s"
+	%[1]s.allow
+}
+
+service_result := %[1]s.result if service == "%[1]s"
+
+`, serviceName)
 	}
 	rules += RuleMarker + "\n"
 	return rules
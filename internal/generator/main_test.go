@@ -1,8 +1,14 @@
 package generator
 
 import (
+	"context"
+	"encoding/json"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/open-policy-agent/opa/v1/rego"
 )
 
 func TestGenerateNewMain(t *testing.T) {
@@ -20,44 +26,27 @@ func TestGenerateNewMain(t *testing.T) {
 		t.Fatalf("failed to read generated main.rego: %v", err)
 	}
 
-	expectedContent := `package teadal
-import data.service1.allow as service1_allow
-import data.service2.allow as service2_allow
-` + ImportMarker + `
-
-default allow := false
-
-allow if service1_allow
-allow if service2_allow
-` + RuleMarker + `
-`
-	if string(content) != expectedContent {
-		t.Fatalf("generated main.rego content does not match expected content:\n=== GOT\n%s\n === WANT\n%s", string(content), expectedContent)
+	expectedParts := []string{
+		"package teadal\nimport data.service1\nimport data.service2\n" + ImportMarker + "\n",
+		"default allow := false\n",
+		"routes.service1 := service1.route if service1.route_matched\n",
+		"allow if {\n\tservice == \"service2\"\n\tservice2.allow\n}\n\n",
+		"service_result := service2.result if service == \"service2\"\n\n" + RuleMarker + "\n",
+	}
+	for _, part := range expectedParts {
+		if !strings.Contains(string(content), part) {
+			t.Fatalf("generated main.rego does not contain expected content:\n=== GOT\n%s\n === WANT\n%s", string(content), part)
+		}
 	}
 }
 
 func TestUpdateMainFile(t *testing.T) {
-	serviceNames := []string{"service3", "service4"}
 	outputDir := t.TempDir()
-
-	// Create an initial main.rego file
-	initialContent := `package teadal
-import data.service1.allow as service1_allow
-import data.service2.allow as service2_allow
-` + ImportMarker + `
-
-default allow := false
-
-allow if service1_allow
-allow if service2_allow
-` + RuleMarker + `
-`
-	err := os.WriteFile(outputDir+"/main.rego", []byte(initialContent), 0644)
-	if err != nil {
+	if err := GenerateNewMain(outputDir, []string{"service1", "service2"}); err != nil {
 		t.Fatalf("failed to create initial main.rego: %v", err)
 	}
 
-	err = UpdateMainFile(outputDir, serviceNames)
+	err := UpdateMainFile(outputDir, []string{"service3", "service4"})
 	if err != nil {
 		t.Fatalf("failed to update main.rego: %v", err)
 	}
@@ -66,22 +55,152 @@ allow if service2_allow
 	if err != nil {
 		t.Fatalf("failed to read updated main.rego: %v", err)
 	}
-	expectedContent := `package teadal
-import data.service1.allow as service1_allow
-import data.service2.allow as service2_allow
-import data.service3.allow as service3_allow
-import data.service4.allow as service4_allow
-` + ImportMarker + `
+	// Updating the main policy must be equivalent to generating it with every service
+	expectedDir := t.TempDir()
+	if err := GenerateNewMain(expectedDir, []string{"service1", "service2", "service3", "service4"}); err != nil {
+		t.Fatalf("failed to generate expected main.rego: %v", err)
+	}
+	expectedContent, err := os.ReadFile(expectedDir + "/main.rego")
+	if err != nil {
+		t.Fatalf("failed to read expected main.rego: %v", err)
+	}
+	if string(content) != string(expectedContent) {
+		t.Fatalf("updated main.rego content does not match expected content:\n=== GOT\n%s\n === WANT\n%s", string(content), string(expectedContent))
+	}
+}
 
-default allow := false
+// stubService returns a service module with the given route, matched on the path and host of the input, allowing
+// every request routed to it if allow is set.
+func stubService(name string, prefix string, hosts string, allow bool) string {
+	module := "package " + name + "\n\n" +
+		"route := {\"prefix\": \"" + prefix + "\", \"hosts\": " + hosts + "}\n\n" +
+		"default route_matched := false\n\n" +
+		"route_matched if {\n\tstartswith(input.path, route.prefix)\n\thost_matched\n}\n\n" +
+		"host_matched if count(route.hosts) == 0\n\n" +
+		"host_matched if input.host in route.hosts\n\n" +
+		"default allow := false\n"
+	if allow {
+		module += "\nallow if route_matched\n"
+	}
+	return module
+}
+
+func TestMainDispatch(t *testing.T) {
+	outputDir := t.TempDir()
+	services := map[string]string{
+		// The root service matches every path, but denies every request
+		"root":   stubService("root", "", "[]", false),
+		"api":    stubService("api", "/api", "[]", true),
+		"apiv2":  stubService("apiv2", "/api/v2", "[]", false),
+		"hosted": stubService("hosted", "", `["a.teadal.eu"]`, true),
+	}
+	if err := GenerateNewMain(outputDir, []string{"root", "api", "apiv2", "hosted"}); err != nil {
+		t.Fatalf("failed to generate new main.rego: %v", err)
+	}
+	content, err := os.ReadFile(outputDir + "/main.rego")
+	if err != nil {
+		t.Fatalf("failed to read generated main.rego: %v", err)
+	}
 
-allow if service1_allow
-allow if service2_allow
-allow if service3_allow
-allow if service4_allow
-` + RuleMarker + `
-`
-	if string(content) != expectedContent {
-		t.Fatalf("updated main.rego content does not match expected content:\n=== GOT\n%s\n === WANT\n%s", string(content), expectedContent)
+	tests := []struct {
+		path        string
+		host        string
+		wantService interface{}
+		wantAllow   bool
+	}{
+		{path: "/api/data", wantService: "api", wantAllow: true},
+		// The longest prefix wins, so api cannot allow the requests of apiv2
+		{path: "/api/v2/data", wantService: "apiv2", wantAllow: false},
+		{path: "/other", wantService: "root", wantAllow: false},
+		// The host specific service wins over the path prefixes
+		{path: "/api/data", host: "a.teadal.eu", wantService: "hosted", wantAllow: true},
+	}
+	for _, test := range tests {
+		options := []func(*rego.Rego){
+			rego.Query("service := data.teadal.service; allow := data.teadal.allow; reason := data.teadal.reason"),
+			rego.Module("main.rego", string(content)),
+			rego.Input(map[string]interface{}{"path": test.path, "host": test.host}),
+		}
+		for name, module := range services {
+			options = append(options, rego.Module(name+".rego", module))
+		}
+		rs, err := rego.New(options...).Eval(context.Background())
+		if err != nil {
+			t.Fatalf("failed to evaluate main.rego: %v", err)
+		}
+		if len(rs) != 1 {
+			t.Fatalf("expected one result for %s%s, got %v", test.host, test.path, rs)
+		}
+		bindings := rs[0].Bindings
+		if bindings["service"] != test.wantService || bindings["allow"] != test.wantAllow {
+			t.Errorf("request %s%s dispatched to %v with allow %v, want %v with allow %v", test.host, test.path, bindings["service"], bindings["allow"], test.wantService, test.wantAllow)
+		}
+		if bindings["reason"] != "request routed to service "+test.wantService.(string) {
+			t.Errorf("unexpected reason %v", bindings["reason"])
+		}
+	}
+}
+
+func TestMainWithoutServices(t *testing.T) {
+	outputDir := t.TempDir()
+	if err := GenerateNewMain(outputDir, nil); err != nil {
+		t.Fatalf("failed to generate new main.rego: %v", err)
+	}
+	content, err := os.ReadFile(outputDir + "/main.rego")
+	if err != nil {
+		t.Fatalf("failed to read generated main.rego: %v", err)
+	}
+	rs, err := rego.New(
+		rego.Query("allow := data.teadal.allow; reason := data.teadal.reason"),
+		rego.Module("main.rego", string(content)),
+	).Eval(context.Background())
+	if err != nil {
+		t.Fatalf("failed to evaluate main.rego: %v", err)
+	}
+	if len(rs) != 1 || rs[0].Bindings["allow"] != false || rs[0].Bindings["reason"] != "request not routed to any service" {
+		t.Errorf("expected unrouted requests to be denied, got %v", rs)
+	}
+}
+
+func TestMainResult(t *testing.T) {
+	outputDir := t.TempDir()
+	if err := GenerateNewMain(outputDir, []string{"api", "plain"}); err != nil {
+		t.Fatalf("failed to generate new main.rego: %v", err)
+	}
+	content, err := os.ReadFile(outputDir + "/main.rego")
+	if err != nil {
+		t.Fatalf("failed to read generated main.rego: %v", err)
+	}
+	// Only the api service generates its ext_authz result
+	api := stubService("api", "/api", "[]", true) + "\nresult := {\"allowed\": true, \"headers\": {\"x-user\": \"alice\"}}\n"
+	plain := stubService("plain", "/plain", "[]", true)
+
+	tests := []struct {
+		path string
+		want map[string]interface{}
+	}{
+		{path: "/api/data", want: map[string]interface{}{"allowed": true, "headers": map[string]interface{}{"x-user": "alice"}}},
+		{path: "/plain/data", want: map[string]interface{}{"allowed": true}},
+		{path: "/other", want: map[string]interface{}{
+			"allowed":     false,
+			"http_status": json.Number("403"),
+			"headers":     map[string]interface{}{"content-type": "text/plain"},
+			"body":        "request not routed to any service",
+		}},
+	}
+	for _, test := range tests {
+		rs, err := rego.New(
+			rego.Query("data.teadal.result"),
+			rego.Module("main.rego", string(content)),
+			rego.Module("api.rego", api),
+			rego.Module("plain.rego", plain),
+			rego.Input(map[string]interface{}{"path": test.path}),
+		).Eval(context.Background())
+		if err != nil {
+			t.Fatalf("failed to evaluate main.rego: %v", err)
+		}
+		if len(rs) != 1 || !reflect.DeepEqual(rs[0].Expressions[0].Value, test.want) {
+			t.Errorf("result for %s = %v, want %v", test.path, rs, test.want)
+		}
 	}
 }
@@ -0,0 +1,91 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// RegionsDataPath is the path of the region hierarchy in the bundle data, available to policies as data.teadal.regions.
+const RegionsDataPath = "teadal/regions"
+
+// DefaultRegions is the built-in region hierarchy, shipped with the bundles having none. Each region is mapped to the regions directly
+// containing it, so that a location satisfies a storage location policy on any of its ancestors (e.g. "Milan" satisfies "Europe").
+var DefaultRegions = map[string][]string{
+	// Continents
+	"Europe":        {"World"},
+	"North America": {"World"},
+	"South America": {"World"},
+	"Asia":          {"World"},
+	"Africa":        {"World"},
+	"Oceania":       {"World"},
+	"World":         {},
+
+	// European Union members
+	"EU":          {"Europe"},
+	"Austria":     {"EU"},
+	"Belgium":     {"EU"},
+	"Bulgaria":    {"EU"},
+	"Croatia":     {"EU"},
+	"Cyprus":      {"EU"},
+	"Czechia":     {"EU"},
+	"Denmark":     {"EU"},
+	"Estonia":     {"EU"},
+	"Finland":     {"EU"},
+	"France":      {"EU"},
+	"Germany":     {"EU"},
+	"Greece":      {"EU"},
+	"Hungary":     {"EU"},
+	"Ireland":     {"EU"},
+	"Italy":       {"EU"},
+	"Latvia":      {"EU"},
+	"Lithuania":   {"EU"},
+	"Luxembourg":  {"EU"},
+	"Malta":       {"EU"},
+	"Netherlands": {"EU"},
+	"Poland":      {"EU"},
+	"Portugal":    {"EU"},
+	"Romania":     {"EU"},
+	"Slovakia":    {"EU"},
+	"Slovenia":    {"EU"},
+	"Spain":       {"EU"},
+	"Sweden":      {"EU"},
+
+	// Other European countries
+	"Norway":         {"Europe"},
+	"Switzerland":    {"Europe"},
+	"United Kingdom": {"Europe"},
+
+	// Other countries
+	"USA":    {"North America"},
+	"Canada": {"North America"},
+	"Mexico": {"North America"},
+	"Brazil": {"South America"},
+	"Japan":  {"Asia"},
+	"India":  {"Asia"},
+
+	// Cities
+	"Milan":     {"Italy"},
+	"Rome":      {"Italy"},
+	"Madrid":    {"Spain"},
+	"Barcelona": {"Spain"},
+	"Lisbon":    {"Portugal"},
+	"Prague":    {"Czechia"},
+	"Berlin":    {"Germany"},
+	"Paris":     {"France"},
+	"NYC":       {"USA"},
+}
+
+// LoadRegions reads the region hierarchy from the JSON file at path, mapping each region to the regions directly
+// containing it, e.g. {"Milan": ["Italy"], "Italy": ["EU"]}.
+func LoadRegions(path string) (map[string][]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read regions file: %v", err)
+	}
+	var regions map[string][]string
+	if err := json.Unmarshal(content, &regions); err != nil {
+		return nil, fmt.Errorf("failed to parse regions file %s: %v", path, err)
+	}
+	return regions, nil
+}
@@ -3,19 +3,26 @@ package generator
 import (
 	"bytes"
 	"dspn-regogenerator/internal/policy"
+	"encoding/json"
 	"fmt"
 	"os"
 	"text/template"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/format"
 )
 
-func GenerateServiceFolder(options ServiceOptions, outputDir string, IAMprovider string, policies *policy.GeneralPolicies) error {
+// GenerateServiceFolder generates the policies of a service, trusting the tokens issued by the identity providers
+// with the given OIDC discovery URLs.
+func GenerateServiceFolder(options ServiceOptions, outputDir string, IAMproviders []string, policies *policy.GeneralPolicies) error {
 	// Create the service directory
 	serviceDir := outputDir + "/" + options.ServiceName
 	if err := os.MkdirAll(serviceDir, 0755); err != nil {
 		return err
 	}
 	// create service specific files
-	if err := generateOIDCfile(options.ServiceName, serviceDir, IAMprovider); err != nil {
+	if err := generateOIDCfile(options, serviceDir, IAMproviders); err != nil {
 		return fmt.Errorf("failed to generate OIDC file: %v", err)
 	}
 	if err := generateServiceFile(options, serviceDir, policies); err != nil {
@@ -25,52 +32,135 @@ func GenerateServiceFolder(options ServiceOptions, outputDir string, IAMprovider
 	return nil
 }
 
-const oidcTemplate = `package %s.oidc
+const oidcTemplate = `package {{.ServiceName}}.oidc
 
 import rego.v1
 
 request := input.attributes.request.http
 
-# OIDC configuration discover url
-metadata_url := "%s"
+encoded := split(request.headers.authorization, " ")[1]
 
-# Generate code 
+# Claims of the token before verifying it, used to select the keys of its identity provider and the verification time
+claims := io.jwt.decode(encoded)[1]
 
-metadata := http.send({
-    "url": metadata_url,
-    "method": "GET",
-    "headers": {
-        "accept": "application/json"
-    },
-    "force_cache": true,
-    "force_cache_duration_seconds": 86400 # Cache response for 24 hours
-}).body
+issuer := claims.iss
+
+{{if .PinnedKeys -}}
+# Keys of the trusted identity providers by issuer, pinned in the bundle data so that no request is sent to them
+jwks := data.{{.ServiceName}}.pinned_keys.issuers[issuer]
+{{- else -}}
+# OIDC configuration discovery urls of the trusted identity providers
+metadata_urls := {{.MetadataURLs}}
+
+# OIDC configuration of each trusted identity provider, by issuer
+metadata[config.issuer] := config if {
+	some metadata_url in metadata_urls
+	config := http.send({
+		"url": metadata_url,
+		"method": "GET",
+		"headers": {"accept": "application/json"},
+		"force_cache": true,
+		"force_cache_duration_seconds": 86400 # Cache response for 24 hours
+	}).body
+}
 
-jwks_uri := metadata.jwks_uri
+jwks_uri := metadata[issuer].jwks_uri
 
 jwks := http.send({
-    "url": jwks_uri,
-    "method": "GET",
-    "headers": {
-        "accept": "application/json"
-    },
-    "force_cache": true,
-    "force_cache_duration_seconds": 3600 # Cache response for 1 hour
+	"url": jwks_uri,
+	"method": "GET",
+	"headers": {"accept": "application/json"},
+	"force_cache": true,
+	"force_cache_duration_seconds": 3600 # Cache response for 1 hour
 }).body
+{{- end}}
 
-encoded := split(request.headers.authorization, " ")[1]
+# Clock skew tolerated when checking the exp and nbf claims, in nanoseconds
+clock_skew := {{.ClockSkew}}
+
+now := time.now_ns()
+
+# Validity of the token in nanoseconds, unbounded when the nbf or exp claims are missing
+default not_before := 0
+
+not_before := claims.nbf * 1000000000 if is_number(claims.nbf)
+
+default expires := 9223372036854775807
 
-#token := {"valid": valid, "payload": payload} if {
-token := {"payload": payload} if {
-	[_, encoded] := split(request.headers.authorization, " ")
-    #[valid, _, payload] := io.jwt.decode_verify(encoded,{ "cert": json.marshal(jwks) })
-	[_, payload, _] := io.jwt.decode(encoded)
+expires := claims.exp * 1000000000 if is_number(claims.exp)
+
+# Time at which the token is verified: the current time, moved within the validity of the token if it is off by at most
+# the clock skew, so that io.jwt.decode_verify checks exp and nbf with the tolerance. It is kept a millisecond before
+# the expiry, as io.jwt.decode_verify compares the times in seconds as floating point numbers
+verification_time := min([max([now, not_before]), expires - 1000000]) if {
+	now + clock_skew >= not_before
+	now - clock_skew < expires
+} else := now
+
+{{if .Audience -}}
+# Audience the tokens must be issued for
+audience := {{.Audience}}
+{{- else -}}
+# No audience is required, but io.jwt.decode_verify rejects tokens with an aud claim when no audience is given,
+# so the audience of the token itself is accepted
+audience := claims.aud if is_string(claims.aud)
+
+audience := claims.aud[0] if is_array(claims.aud)
+{{- end}}
+
+audience_constraint := {"aud": audience}
+
+default audience_constraint := {}
+
+constraints := object.union(
+	{"cert": json.marshal(jwks), "iss": issuer, "time": verification_time},
+	audience_constraint,
+)
+
+token := {"valid": valid, "payload": payload} if {
+	[valid, _, payload] := io.jwt.decode_verify(encoded, constraints)
 }
 `
 
-func generateOIDCfile(serviceName string, outputDir string, url string) error {
-	data := fmt.Sprintf(oidcTemplate, serviceName, url)
-	return os.WriteFile(outputDir+"/oidc.rego", []byte(data), 0644)
+func generateOIDCfile(options ServiceOptions, outputDir string, urls []string) error {
+	if len(urls) == 0 {
+		return fmt.Errorf("no IAM provider")
+	}
+	metadataURLs, err := json.Marshal(urls)
+	if err != nil {
+		return fmt.Errorf("failed to encode IAM providers: %v", err)
+	}
+	audience := ""
+	if options.Audience != "" {
+		encoded, err := json.Marshal(options.Audience)
+		if err != nil {
+			return fmt.Errorf("failed to encode audience: %v", err)
+		}
+		audience = string(encoded)
+	}
+	t := template.Must(template.New("oidc").Parse(oidcTemplate))
+	buffer := &bytes.Buffer{}
+	err = t.Execute(buffer, struct {
+		ServiceName  string
+		MetadataURLs string
+		Audience     string
+		ClockSkew    int64
+		PinnedKeys   bool
+	}{
+		ServiceName:  options.ServiceName,
+		MetadataURLs: string(metadataURLs),
+		Audience:     audience,
+		ClockSkew:    options.ClockSkew.Nanoseconds(),
+		PinnedKeys:   options.PinnedKeys,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to execute template: %v", err)
+	}
+	data, err := format.SourceWithOpts("oidc.rego", buffer.Bytes(), format.Opts{RegoVersion: ast.RegoV1})
+	if err != nil {
+		return fmt.Errorf("failed to format OIDC module: %v", err)
+	}
+	return os.WriteFile(outputDir+"/oidc.rego", data, 0644)
 }
 
 const serviceTemplate = `package {{.ServiceName}}
@@ -83,26 +173,107 @@ request := input.attributes.request.http
 user := token.payload.preferred_username
 roles contains role if some role in token.payload.realm_access.roles
 
+# OAuth2 scopes granted to the token, from the space separated scope claim or from the scp claim, either a string or a list
+token_scopes contains scope if some scope in split(token.payload.scope, " ")
+
+token_scopes contains scope if {
+	is_string(token.payload.scp)
+	some scope in split(token.payload.scp, " ")
+}
+
+token_scopes contains scope if {
+	is_array(token.payload.scp)
+	some scope in token.payload.scp
+}
+
 {{ if .PathPrefix -}}
-path := trim_prefix(request.path, "{{.PathPrefix}}")
+path := trim_prefix(request.path, {{json .PathPrefix}})
 {{- else -}}
 path := request.path
 {{- end }}
 method := lower(request.method)
 
-default allow := false
-allow if {
-	print("Params: ", {
-		"request": request,
+# Route of the service, used by the main policy to dispatch each request to exactly one service
+route := {"prefix": {{json .PathPrefix}}, "hosts": {{if .Hosts}}{{json .Hosts}}{{else}}[]{{end}}}
+
+# The request is addressed to this service if its path is under the path prefix and its host is one of the service
+# hosts, so that services sharing a path prefix can be told apart by host
+default route_matched := false
+
+route_matched if {
+	path_matched
+	host_matched
+}
+
+{{ if .PathPrefix -}}
+path_matched if request.path == {{json .PathPrefix}}
+
+path_matched if startswith(request.path, {{json (print .PathPrefix "/")}})
+{{- else -}}
+path_matched := true
+{{- end }}
+
+{{ if .Hosts -}}
+# Host of the request without the port
+host := lower(split(request.host, ":")[0])
+
+host_matched if host in {{json .Hosts}}
+{{- else -}}
+host_matched := true
+{{- end }}
+
+# Number of calls performed by the user on this service in the current period, as reported by the quota service
+call_count(period) := http.send({
+	"url": {{json .QuotaServiceURL}},
+	"method": "POST",
+	"headers": {"content-type": "application/json"},
+	"body": {
+		"service": {{json .ServiceName}},
 		"user": user,
-		"roles": roles,
 		"path": path,
 		"method": method,
-		"allow_request": allow_request
-	})
+		"period": period
+	},
+	"raise_error": false
+}).body.count
+
+# Timestamp of the requested data in nanoseconds, used to enforce timeliness policies.
+# Accept both RFC 3339 strings and numeric UNIX timestamps in seconds, which headers and query parameters carry as strings.
+data_timestamp := time.parse_rfc3339_ns(timestamp) if {
+	timestamp := {{.Timeliness.Rego}}
+	is_string(timestamp)
+}
+
+data_timestamp := to_number(timestamp) * 1000000000 if {
+	timestamp := {{.Timeliness.Rego}}
+	is_string(timestamp)
+	not time.parse_rfc3339_ns(timestamp)
+}
+
+data_timestamp := timestamp * 1000000000 if {
+	timestamp := {{.Timeliness.Rego}}
+	is_number(timestamp)
+}
+
+# Location of the request, used to enforce storage location policies
+location := {{.Location.Rego}}
+
+# Regions containing the location according to the region hierarchy in the bundle data, including the location itself
+location_regions := graph.reachable(data.teadal.regions, {location}) | {location}
+
+default allow := false
+allow if {
+	# Check if the request is addressed to this service
+	route_matched
 
 	# Check if the user is authenticated
-	#token.valid
+	token.valid
+
+	# Deny rules take precedence over the access control policies
+	not deny
+
+	# Check the OAuth2 scopes required by the operation
+	scopes_granted
 
 	# Check if request is valid
 	allow_request
@@ -110,21 +281,111 @@ allow if {
 
 default allow_request := false
 
+default deny := false
+
+default scopes_required := false
+
+default scopes_granted := false
+
+scopes_granted if not scopes_required
+
+# Human readable reasons of the decision, completed by the generated policies with the failed checks of the access
+# clauses and with the deny clauses and scope requirements applying to the request
+reasons contains "request not addressed to the service" if not route_matched
+
+reasons contains "missing or invalid token" if not token.valid
+
+{{if .ExtAuthzResult -}}
+# Envoy ext_authz response: allowed requests are forwarded with the identity of the user in the headers, while denied
+# ones get the reason of the denial in the body
+reason := "request not addressed to the service" if {
+	not route_matched
+} else := "missing or invalid token" if {
+	not token.valid
+} else := "request denied by a deny policy" if {
+	deny
+} else := "token not granted the required OAuth2 scopes" if {
+	not scopes_granted
+} else := "no access policy allows the request" if {
+	not allow_request
+} else := "request allowed"
+
+identity_headers["x-user"] := user
+
+identity_headers["x-roles"] := concat(",", sort(roles))
+
+http_status := 401 if {
+	not token.valid
+} else := 403
+
+result := {"allowed": true, "headers": identity_headers} if {
+	allow
+} else := {"allowed": false, "http_status": http_status, "headers": {"content-type": "text/plain"}, "body": reason}
+{{- end}}
+
 # Generated access control policies
 `
 
 type ServiceOptions struct {
 	ServiceName string
-	PathPrefix  string
+	// Path prefix of the requests addressed to the service, trimmed before matching the OpenAPI paths
+	PathPrefix string
+	// Host names the requests must be addressed to, any host is accepted if empty
+	Hosts []string
+	// URL of the quota service used to enforce call policies
+	QuotaServiceURL string
+	// Attribute holding the data timestamp used to enforce timeliness policies, DefaultTimelinessSource if not set
+	Timeliness AttributeSource
+	// Attribute holding the location checked by storage location policies, DefaultLocationSource if not set
+	Location AttributeSource
+	// Audience the tokens must be issued for, any audience is accepted if not set
+	Audience string
+	// Clock skew tolerated when checking the expiration and not before times of the tokens
+	ClockSkew time.Duration
+	// Read the keys of the identity providers from the bundle data at PinnedKeysDataPath instead of fetching them
+	PinnedKeys bool
+	// Generate the Envoy ext_authz result object besides allow, forwarding the user and roles in the x-user and x-roles
+	// headers and giving the deny reason in the body
+	ExtAuthzResult bool
 }
 
 func generateServiceFile(serviceOptions ServiceOptions, outputDir string, policies *policy.GeneralPolicies) error {
-	t := template.Must(template.New("service").Parse(serviceTemplate))
+	if serviceOptions.Timeliness.Kind == "" {
+		serviceOptions.Timeliness = DefaultTimelinessSource
+	}
+	if serviceOptions.Location.Kind == "" {
+		serviceOptions.Location = DefaultLocationSource
+	}
+	t := template.Must(template.New("service").Funcs(template.FuncMap{"json": toJSON}).Parse(serviceTemplate))
 	buffer := &bytes.Buffer{}
 	err := t.Execute(buffer, serviceOptions)
 	if err != nil {
 		return fmt.Errorf("failed to execute template: %v", err)
 	}
-	data := buffer.String() + policies.ToRego()
-	return os.WriteFile(outputDir+"/service.rego", []byte(data), 0644)
+	rules, err := policies.ToRego()
+	if err != nil {
+		return fmt.Errorf("failed to generate policies: %v", err)
+	}
+	reasons, err := policies.ReasonsToRego()
+	if err != nil {
+		return fmt.Errorf("failed to generate reasons: %v", err)
+	}
+	if reasons != "" {
+		rules += "\n# Reasons of the denied requests\n" + reasons
+	}
+	// Format the whole module, so that the output is both valid and canonical
+	data, err := format.SourceWithOpts("service.rego", []byte(buffer.String()+rules), format.Opts{RegoVersion: ast.RegoV1})
+	if err != nil {
+		return fmt.Errorf("failed to format service module: %v", err)
+	}
+	return os.WriteFile(outputDir+"/service.rego", data, 0644)
+}
+
+// toJSON encodes a value as JSON, which is also a valid Rego term for strings and arrays.
+func toJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
 }
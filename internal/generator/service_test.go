@@ -1,11 +1,28 @@
 package generator
 
 import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
 	"dspn-regogenerator/internal/policy"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/rego"
+	"github.com/open-policy-agent/opa/v1/storage/inmem"
+	"github.com/open-policy-agent/opa/v1/util"
 )
 
 func TestGenerateServiceFolder(t *testing.T) {
@@ -23,7 +40,7 @@ func TestGenerateServiceFolder(t *testing.T) {
 	}
 
 	// Call the function
-	err = GenerateServiceFolder(options, outputDir, "http://localhost:8000/keykloack/realms/test", &policy.GeneralPolicies{
+	err = GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
 		Policies: []policy.PolicyClause{
 			{
 				UserPolicy: &policy.UserPolicy{
@@ -156,7 +173,7 @@ func TestGenerateServiceFolderWithPatPrefix(t *testing.T) {
 	}
 
 	// Call the function
-	err = GenerateServiceFolder(options, outputDir, "http://localhost:8000/keykloack/realms/test", &policy.GeneralPolicies{
+	err = GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
 		Policies: []policy.PolicyClause{
 			{
 				UserPolicy: &policy.UserPolicy{
@@ -185,3 +202,1050 @@ func TestGenerateServiceFolderWithPatPrefix(t *testing.T) {
 		t.Errorf("Service file content does not contain expected path prefix.\nGot:\n%s\nExpected:\n%s", string(content), expectedContent)
 	}
 }
+
+func TestGenerateServiceFolderEscapesStrings(t *testing.T) {
+	outputDir := t.TempDir()
+	prefix := `/api"); allow := true; x := ("`
+	options := ServiceOptions{
+		ServiceName:     "escapedService",
+		PathPrefix:      prefix,
+		QuotaServiceURL: `http://quota/"count`,
+	}
+	err := GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
+		Policies: []policy.PolicyClause{
+			{UserPolicy: &policy.UserPolicy{PolicyDetail: policy.PolicyDetail{Value: []string{"alice"}, Operator: "OR"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+
+	request := map[string]interface{}{
+		"attributes": map[string]interface{}{
+			"request": map[string]interface{}{
+				"http": map[string]interface{}{"path": prefix + "/data", "method": "GET"},
+			},
+		},
+	}
+	route, ok := evalService(t, outputDir, "escapedService", "route", map[string]interface{}{}, request).(map[string]interface{})
+	if !ok || route["prefix"] != prefix {
+		t.Errorf("Expected the route prefix to be %q, got %v", prefix, route)
+	}
+	if got := evalService(t, outputDir, "escapedService", "path", map[string]interface{}{}, request); got != "/data" {
+		t.Errorf("Expected the prefix to be trimmed, got %v", got)
+	}
+	if got := evalService(t, outputDir, "escapedService", "allow", map[string]interface{}{"preferred_username": "bob"}, request); got != false {
+		t.Errorf("Expected bob to be denied, got %v", got)
+	}
+}
+
+// evalService evaluates the rule of the generated service, replacing the OIDC package with a stub
+// that returns the provided token payload. The bundle data contains the default region hierarchy.
+func evalService(t *testing.T, outputDir string, serviceName string, rule string, payload map[string]interface{}, input map[string]interface{}) interface{} {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(outputDir, serviceName, "service.rego"))
+	if err != nil {
+		t.Fatalf("Failed to read service file: %v", err)
+	}
+	stubOIDC := "package " + serviceName + ".oidc\n\ntoken := {\"valid\": true, \"payload\": input.token_payload}\n"
+	input["token_payload"] = payload
+	var regions interface{} = DefaultRegions
+	if err := util.RoundTrip(&regions); err != nil {
+		t.Fatalf("Failed to convert regions: %v", err)
+	}
+	store := inmem.NewFromObject(map[string]interface{}{"teadal": map[string]interface{}{"regions": regions}})
+
+	rs, err := rego.New(
+		rego.Query("data."+serviceName+"."+rule),
+		rego.Module("service.rego", string(content)),
+		rego.Module("oidc.rego", stubOIDC),
+		rego.Input(input),
+		rego.Store(store),
+	).Eval(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to evaluate service policy: %v", err)
+	}
+	if len(rs) == 0 {
+		return nil
+	}
+	return rs[0].Expressions[0].Value
+}
+
+func TestGenerateServiceFolderCallQuota(t *testing.T) {
+	// Stub quota service returning a fixed number of calls for each user
+	calls := map[string]int{"alice": 5, "bob": 10}
+	var lastRequest map[string]interface{}
+	quota := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&lastRequest); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"count": calls[lastRequest["user"].(string)]})
+	}))
+	defer quota.Close()
+
+	outputDir := t.TempDir()
+	options := ServiceOptions{
+		ServiceName:     "quotaService",
+		QuotaServiceURL: quota.URL,
+	}
+	err := GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
+		Policies: []policy.PolicyClause{
+			{
+				CallPolicy: &policy.CallPolicy{
+					Value: []policy.CallLimit{{Max: "10", UnitOfMeasure: policy.CallFrequencyDaily}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+
+	request := func() map[string]interface{} {
+		return map[string]interface{}{
+			"attributes": map[string]interface{}{
+				"request": map[string]interface{}{
+					"http": map[string]interface{}{"path": "/data", "method": "GET"},
+				},
+			},
+		}
+	}
+
+	if got := evalService(t, outputDir, "quotaService", "allow", map[string]interface{}{"preferred_username": "alice"}, request()); got != true {
+		t.Errorf("Expected alice to be allowed under quota, got %v", got)
+	}
+	if lastRequest["service"] != "quotaService" || lastRequest["period"] != "call_per_day" || lastRequest["path"] != "/data" {
+		t.Errorf("Unexpected quota service request: %v", lastRequest)
+	}
+	if got := evalService(t, outputDir, "quotaService", "allow", map[string]interface{}{"preferred_username": "bob"}, request()); got != false {
+		t.Errorf("Expected bob to be denied over quota, got %v", got)
+	}
+}
+
+func TestGenerateServiceFolderTimeliness(t *testing.T) {
+	outputDir := t.TempDir()
+	options := ServiceOptions{
+		ServiceName: "timelyService",
+		Timeliness:  AttributeSource{Kind: AttributeClaim, Name: "data.issued_at"},
+	}
+	err := GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
+		Policies: []policy.PolicyClause{
+			{
+				TimelinessPolicy: &policy.TimelinessPolicy{
+					Value: []policy.TimelinessLimit{{Max: "7", UnitOfMeasure: policy.StorageDurationDay}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+
+	request := map[string]interface{}{
+		"attributes": map[string]interface{}{
+			"request": map[string]interface{}{
+				"http": map[string]interface{}{"path": "/data", "method": "GET"},
+			},
+		},
+	}
+	recent := time.Now().Add(-24 * time.Hour)
+	old := time.Now().Add(-8 * 24 * time.Hour)
+
+	payload := map[string]interface{}{"data": map[string]interface{}{"issued_at": recent.Format(time.RFC3339)}}
+	if got := evalService(t, outputDir, "timelyService", "allow", payload, request); got != true {
+		t.Errorf("Expected recent RFC 3339 timestamp to be allowed, got %v", got)
+	}
+	payload = map[string]interface{}{"data": map[string]interface{}{"issued_at": recent.Unix()}}
+	if got := evalService(t, outputDir, "timelyService", "allow", payload, request); got != true {
+		t.Errorf("Expected recent UNIX timestamp to be allowed, got %v", got)
+	}
+	payload = map[string]interface{}{"data": map[string]interface{}{"issued_at": old.Format(time.RFC3339)}}
+	if got := evalService(t, outputDir, "timelyService", "allow", payload, request); got != false {
+		t.Errorf("Expected old timestamp to be denied, got %v", got)
+	}
+	if got := evalService(t, outputDir, "timelyService", "allow", map[string]interface{}{}, request); got != false {
+		t.Errorf("Expected missing timestamp to be denied, got %v", got)
+	}
+}
+
+func TestGenerateServiceFolderTimelinessHeader(t *testing.T) {
+	outputDir := t.TempDir()
+	options := ServiceOptions{
+		ServiceName: "timelyService",
+		Timeliness:  AttributeSource{Kind: AttributeHeader, Name: "x-data-timestamp"},
+	}
+	err := GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
+		Policies: []policy.PolicyClause{
+			{
+				TimelinessPolicy: &policy.TimelinessPolicy{
+					Value: []policy.TimelinessLimit{{Max: "7", UnitOfMeasure: policy.StorageDurationDay}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+
+	request := func(timestamp string) map[string]interface{} {
+		return map[string]interface{}{
+			"attributes": map[string]interface{}{
+				"request": map[string]interface{}{
+					"http": map[string]interface{}{
+						"path":    "/data",
+						"method":  "GET",
+						"headers": map[string]interface{}{"x-data-timestamp": timestamp},
+					},
+				},
+			},
+		}
+	}
+	recent := time.Now().Add(-24 * time.Hour)
+	old := time.Now().Add(-8 * 24 * time.Hour)
+	payload := map[string]interface{}{}
+
+	if got := evalService(t, outputDir, "timelyService", "allow", payload, request(strconv.FormatInt(recent.Unix(), 10))); got != true {
+		t.Errorf("Expected recent numeric header to be allowed, got %v", got)
+	}
+	if got := evalService(t, outputDir, "timelyService", "allow", payload, request(recent.Format(time.RFC3339))); got != true {
+		t.Errorf("Expected recent RFC 3339 header to be allowed, got %v", got)
+	}
+	if got := evalService(t, outputDir, "timelyService", "allow", payload, request(strconv.FormatInt(old.Unix(), 10))); got != false {
+		t.Errorf("Expected old numeric header to be denied, got %v", got)
+	}
+	if got := evalService(t, outputDir, "timelyService", "allow", payload, request("yesterday")); got != false {
+		t.Errorf("Expected malformed header to be denied, got %v", got)
+	}
+}
+
+func TestGenerateServiceFolderStorageLocation(t *testing.T) {
+	outputDir := t.TempDir()
+	options := ServiceOptions{
+		ServiceName: "locatedService",
+		Location:    AttributeSource{Kind: AttributeHeader, Name: "x-location"},
+	}
+	err := GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
+		Policies: []policy.PolicyClause{
+			{
+				StorageLocationPolicy: &policy.StorageLocationPolicy{
+					PolicyDetail: policy.PolicyDetail{Value: []string{"Europe", "USA"}, Operator: policy.OperatorOr},
+				},
+			},
+		},
+		SpecializedPaths: map[string]policy.PathPolicies{
+			"/italian": {
+				Path: "/italian",
+				Policies: []policy.PolicyClause{
+					{
+						StorageLocationPolicy: &policy.StorageLocationPolicy{
+							PolicyDetail: policy.PolicyDetail{Value: []string{"EU", "Italy"}, Operator: policy.OperatorAnd},
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+
+	request := func(path string, location string) map[string]interface{} {
+		return map[string]interface{}{
+			"attributes": map[string]interface{}{
+				"request": map[string]interface{}{
+					"http": map[string]interface{}{
+						"path":    path,
+						"method":  "GET",
+						"headers": map[string]interface{}{"x-location": location},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		path     string
+		location string
+		want     bool
+	}{
+		{path: "/data", location: "Italy", want: true},
+		{path: "/data", location: "Milan", want: true},
+		{path: "/data", location: "NYC", want: true},
+		{path: "/data", location: "Japan", want: false},
+		{path: "/data", location: "Mars", want: false},
+		{path: "/italian", location: "Milan", want: true},
+		{path: "/italian", location: "Spain", want: false},
+	}
+	for _, test := range tests {
+		if got := evalService(t, outputDir, "locatedService", "allow", map[string]interface{}{}, request(test.path, test.location)); got != test.want {
+			t.Errorf("allow for %s from %s = %v, want %v", test.path, test.location, got, test.want)
+		}
+	}
+}
+
+func TestGenerateServiceFolderTemplatedPaths(t *testing.T) {
+	outputDir := t.TempDir()
+	options := ServiceOptions{ServiceName: "templatedService"}
+	err := GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
+		Policies: []policy.PolicyClause{
+			{
+				RolePolicy: &policy.RolePolicy{
+					PolicyDetail: policy.PolicyDetail{Value: []string{"admin"}, Operator: policy.OperatorOr},
+				},
+			},
+		},
+		SpecializedPaths: map[string]policy.PathPolicies{
+			"/drug_exposure/{drug_exposure_id}": {
+				Path: "/drug_exposure/{drug_exposure_id}",
+				Policies: []policy.PolicyClause{
+					{
+						PathParamsPolicy: &policy.PathParamsPolicy{
+							Value: map[string]string{"drug_exposure_id": "preferred_username"},
+						},
+					},
+				},
+			},
+			"/drug_exposure/summary": {
+				Path: "/drug_exposure/summary",
+				Policies: []policy.PolicyClause{
+					{
+						RolePolicy: &policy.RolePolicy{
+							PolicyDetail: policy.PolicyDetail{Value: []string{"analyst"}, Operator: policy.OperatorOr},
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+
+	request := func(path string) map[string]interface{} {
+		return map[string]interface{}{
+			"attributes": map[string]interface{}{
+				"request": map[string]interface{}{
+					"http": map[string]interface{}{"path": path, "method": "GET"},
+				},
+			},
+		}
+	}
+	admin := map[string]interface{}{"preferred_username": "root", "realm_access": map[string]interface{}{"roles": []string{"admin"}}}
+	owner := map[string]interface{}{"preferred_username": "alice", "realm_access": map[string]interface{}{"roles": []string{"admin"}}}
+	summary := map[string]interface{}{"preferred_username": "summary", "realm_access": map[string]interface{}{"roles": []string{"admin"}}}
+	analyst := map[string]interface{}{"preferred_username": "bob", "realm_access": map[string]interface{}{"roles": []string{"admin", "analyst"}}}
+
+	tests := []struct {
+		name    string
+		path    string
+		payload map[string]interface{}
+		want    bool
+	}{
+		{name: "admin on general path", path: "/other", payload: admin, want: true},
+		{name: "owner of the drug exposure", path: "/drug_exposure/alice", payload: owner, want: true},
+		{name: "admin not owner of the drug exposure", path: "/drug_exposure/alice", payload: admin, want: false},
+		{name: "empty parameter", path: "/drug_exposure/", payload: owner, want: true},
+		{name: "nested path", path: "/drug_exposure/alice/details", payload: owner, want: true},
+		{name: "exact path matching the template", path: "/drug_exposure/summary", payload: summary, want: false},
+		{name: "analyst on exact path", path: "/drug_exposure/summary", payload: analyst, want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := evalService(t, outputDir, "templatedService", "allow", test.payload, request(test.path)); got != test.want {
+				t.Errorf("allow for %s = %v, want %v", test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestGenerateServiceFolderClaims(t *testing.T) {
+	outputDir := t.TempDir()
+	options := ServiceOptions{ServiceName: "claimsService"}
+	err := GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
+		Policies: []policy.PolicyClause{
+			{
+				ClaimsPolicy: &policy.ClaimsPolicy{
+					Value: []policy.ClaimCondition{
+						{Claim: "organization.country", Operator: policy.ClaimOperatorIn, Value: []interface{}{"Italy", "Spain"}},
+						{Claim: "contract_id", Operator: policy.ClaimOperatorRegex, Value: "^C-[0-9]+$"},
+						{Claim: "clearance", Operator: policy.ClaimOperatorGreaterThan, Value: 2},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+
+	request := map[string]interface{}{
+		"attributes": map[string]interface{}{
+			"request": map[string]interface{}{
+				"http": map[string]interface{}{"path": "/contracts", "method": "GET"},
+			},
+		},
+	}
+	tests := []struct {
+		name    string
+		payload map[string]interface{}
+		want    bool
+	}{
+		{
+			name:    "all claims satisfied",
+			payload: map[string]interface{}{"organization": map[string]interface{}{"country": "Italy"}, "contract_id": "C-42", "clearance": 3},
+			want:    true,
+		},
+		{
+			name:    "country not allowed",
+			payload: map[string]interface{}{"organization": map[string]interface{}{"country": "France"}, "contract_id": "C-42", "clearance": 3},
+			want:    false,
+		},
+		{
+			name:    "contract id not matching",
+			payload: map[string]interface{}{"organization": map[string]interface{}{"country": "Spain"}, "contract_id": "X-42", "clearance": 3},
+			want:    false,
+		},
+		{
+			name:    "clearance not a number",
+			payload: map[string]interface{}{"organization": map[string]interface{}{"country": "Spain"}, "contract_id": "C-42", "clearance": "top"},
+			want:    false,
+		},
+		{
+			name:    "missing claims",
+			payload: map[string]interface{}{},
+			want:    false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := evalService(t, outputDir, "claimsService", "allow", test.payload, request); got != test.want {
+				t.Errorf("allow = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGenerateServiceFolderDeny(t *testing.T) {
+	outputDir := t.TempDir()
+	options := ServiceOptions{ServiceName: "denyService"}
+	err := GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
+		Policies: []policy.PolicyClause{
+			{
+				RolePolicy: &policy.RolePolicy{
+					PolicyDetail: policy.PolicyDetail{Value: []string{"doctor"}, Operator: policy.OperatorOr},
+				},
+			},
+		},
+		Deny: []policy.PolicyClause{
+			{
+				UserPolicy: &policy.UserPolicy{
+					PolicyDetail: policy.PolicyDetail{Value: []string{"mallory"}, Operator: policy.OperatorOr},
+				},
+			},
+		},
+		SpecializedPaths: map[string]policy.PathPolicies{
+			"/admin": {
+				Path: "/admin",
+				SpecializedMethods: map[string]policy.PathMethodPolicies{
+					"delete": {Method: "delete", Deny: []policy.PolicyClause{{}}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+
+	request := func(path string, method string) map[string]interface{} {
+		return map[string]interface{}{
+			"attributes": map[string]interface{}{
+				"request": map[string]interface{}{
+					"http": map[string]interface{}{"path": path, "method": method},
+				},
+			},
+		}
+	}
+	doctor := func(name string) map[string]interface{} {
+		return map[string]interface{}{"preferred_username": name, "realm_access": map[string]interface{}{"roles": []string{"doctor"}}}
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		method  string
+		payload map[string]interface{}
+		want    bool
+	}{
+		{name: "doctor allowed", path: "/drugs", method: "GET", payload: doctor("alice"), want: true},
+		{name: "denied user with allowed role", path: "/drugs", method: "GET", payload: doctor("mallory"), want: false},
+		{name: "doctor allowed on admin", path: "/admin", method: "GET", payload: doctor("alice"), want: true},
+		{name: "delete on admin never allowed", path: "/admin", method: "DELETE", payload: doctor("alice"), want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := evalService(t, outputDir, "denyService", "allow", test.payload, request(test.path, test.method)); got != test.want {
+				t.Errorf("allow for %s %s = %v, want %v", test.method, test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestGenerateServiceFolderNestedClauses(t *testing.T) {
+	outputDir := t.TempDir()
+	options := ServiceOptions{ServiceName: "nestedService"}
+	err := GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
+		Policies: []policy.PolicyClause{
+			{
+				AnyOf: []policy.PolicyClause{
+					{
+						RolePolicy: &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Value: []string{"A"}, Operator: policy.OperatorOr}},
+						UserPolicy: &policy.UserPolicy{PolicyDetail: policy.PolicyDetail{Value: []string{"alice", "bob"}, Operator: policy.OperatorOr}},
+					},
+					{
+						RolePolicy:            &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Value: []string{"B"}, Operator: policy.OperatorOr}},
+						StorageLocationPolicy: &policy.StorageLocationPolicy{PolicyDetail: policy.PolicyDetail{Value: []string{"Europe"}, Operator: policy.OperatorOr}},
+					},
+				},
+				Not: &policy.PolicyClause{
+					UserPolicy: &policy.UserPolicy{PolicyDetail: policy.PolicyDetail{Value: []string{"mallory"}, Operator: policy.OperatorOr}},
+				},
+			},
+		},
+		SpecializedPaths: map[string]policy.PathPolicies{
+			"/items/{owner}": {
+				Path: "/items/{owner}",
+				Policies: []policy.PolicyClause{
+					{
+						AnyOf: []policy.PolicyClause{
+							{RolePolicy: &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Value: []string{"admin"}, Operator: policy.OperatorOr}}},
+							{PathParamsPolicy: &policy.PathParamsPolicy{Value: map[string]string{"owner": "preferred_username"}}},
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+
+	request := func(path string) map[string]interface{} {
+		return map[string]interface{}{
+			"attributes": map[string]interface{}{
+				"request": map[string]interface{}{
+					"http": map[string]interface{}{"path": path, "method": "GET"},
+				},
+			},
+		}
+	}
+	payload := func(name string, location string, roles ...string) map[string]interface{} {
+		return map[string]interface{}{"preferred_username": name, "location": location, "realm_access": map[string]interface{}{"roles": roles}}
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		payload map[string]interface{}
+		want    bool
+	}{
+		{name: "role A and listed user", path: "/data", payload: payload("alice", "USA", "A"), want: true},
+		{name: "role A and unlisted user", path: "/data", payload: payload("carol", "Italy", "A"), want: false},
+		{name: "role B in Europe", path: "/data", payload: payload("carol", "Italy", "B"), want: true},
+		{name: "role B outside Europe", path: "/data", payload: payload("carol", "USA", "B"), want: false},
+		{name: "excluded user", path: "/data", payload: payload("mallory", "Italy", "B"), want: false},
+		{name: "owner of the item", path: "/items/carol", payload: payload("carol", "Italy", "B"), want: true},
+		{name: "admin on the item", path: "/items/carol", payload: payload("dave", "Italy", "B", "admin"), want: true},
+		{name: "other user on the item", path: "/items/carol", payload: payload("dave", "Italy", "B"), want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := evalService(t, outputDir, "nestedService", "allow", test.payload, request(test.path)); got != test.want {
+				t.Errorf("allow for %s = %v, want %v", test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestGenerateServiceFolderPolicyDefinitions(t *testing.T) {
+	outputDir := t.TempDir()
+	options := ServiceOptions{ServiceName: "definitionsService"}
+	err := GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
+		Definitions: map[string]policy.PolicyClause{
+			"management": {
+				RolePolicy: &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Value: []string{"admin", "top_management"}, Operator: policy.OperatorOr}},
+			},
+			"owner": {
+				PathParamsPolicy: &policy.PathParamsPolicy{Value: map[string]string{"owner": "preferred_username"}},
+			},
+		},
+		SpecializedPaths: map[string]policy.PathPolicies{
+			"/invoices": {Path: "/invoices", Policies: []policy.PolicyClause{{Use: "management"}}},
+			"/items/{owner}": {
+				Path:     "/items/{owner}",
+				Policies: []policy.PolicyClause{{Use: "management"}, {Ref: policy.DefinitionsRefPrefix + "owner"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+
+	request := func(path string) map[string]interface{} {
+		return map[string]interface{}{
+			"attributes": map[string]interface{}{
+				"request": map[string]interface{}{
+					"http": map[string]interface{}{"path": path, "method": "GET"},
+				},
+			},
+		}
+	}
+	payload := func(name string, roles ...string) map[string]interface{} {
+		return map[string]interface{}{"preferred_username": name, "realm_access": map[string]interface{}{"roles": roles}}
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		payload map[string]interface{}
+		want    bool
+	}{
+		{name: "manager on invoices", path: "/invoices", payload: payload("alice", "top_management"), want: true},
+		{name: "user on invoices", path: "/invoices", payload: payload("bob", "sales_user"), want: false},
+		{name: "manager on an item", path: "/items/bob", payload: payload("alice", "admin"), want: true},
+		{name: "owner of an item", path: "/items/bob", payload: payload("bob"), want: true},
+		{name: "other user on an item", path: "/items/bob", payload: payload("carol"), want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := evalService(t, outputDir, "definitionsService", "allow", test.payload, request(test.path)); got != test.want {
+				t.Errorf("allow for %s = %v, want %v", test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestGenerateServiceFolderMultipleIssuers(t *testing.T) {
+	// Stub identity providers, each serving its OIDC configuration and a key set named after it
+	newProvider := func(name string) *httptest.Server {
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/.well-known/openid-configuration":
+				json.NewEncoder(w).Encode(map[string]string{"issuer": server.URL, "jwks_uri": server.URL + "/jwks"})
+			case "/jwks":
+				json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{"kid": name}}})
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		return server
+	}
+	first, second := newProvider("first"), newProvider("second")
+	defer first.Close()
+	defer second.Close()
+
+	outputDir := t.TempDir()
+	options := ServiceOptions{ServiceName: "issuers"}
+	providers := []string{first.URL + "/.well-known/openid-configuration", second.URL + "/.well-known/openid-configuration"}
+	if err := GenerateServiceFolder(options, outputDir, providers, &policy.GeneralPolicies{}); err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(outputDir, "issuers", "oidc.rego"))
+	if err != nil {
+		t.Fatalf("Failed to read OIDC file: %v", err)
+	}
+
+	encode := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	for _, provider := range []*httptest.Server{first, second} {
+		token := encode(map[string]string{"alg": "RS256"}) + "." + encode(map[string]string{"iss": provider.URL}) + ".c2ln"
+		rs, err := rego.New(
+			rego.Query("data.issuers.oidc.jwks.keys[0].kid"),
+			rego.Module("oidc.rego", string(content)),
+			rego.Input(map[string]interface{}{"attributes": map[string]interface{}{"request": map[string]interface{}{"http": map[string]interface{}{
+				"headers": map[string]interface{}{"authorization": "Bearer " + token},
+			}}}}),
+		).Eval(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to evaluate OIDC policy: %v", err)
+		}
+		want := "first"
+		if provider == second {
+			want = "second"
+		}
+		if len(rs) == 0 || rs[0].Expressions[0].Value != want {
+			t.Errorf("Expected the key set of the %s provider, got %v", want, rs)
+		}
+	}
+}
+
+func TestGenerateServiceFolderScopes(t *testing.T) {
+	outputDir := t.TempDir()
+	options := ServiceOptions{ServiceName: "scopesService"}
+	err := GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
+		Policies: []policy.PolicyClause{
+			{RolePolicy: &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Value: []string{"doctor"}, Operator: policy.OperatorOr}}},
+		},
+		Scopes: []policy.ScopeRequirement{
+			{Path: "/drugs/{id}", Method: "get", Alternatives: [][]string{{"read:drugs"}, {"admin"}}},
+			{Path: "/drugs/recalled", Method: "get", Alternatives: [][]string{{"recall:drugs"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+
+	request := func(path string) map[string]interface{} {
+		return map[string]interface{}{
+			"attributes": map[string]interface{}{
+				"request": map[string]interface{}{
+					"http": map[string]interface{}{"path": path, "method": "GET"},
+				},
+			},
+		}
+	}
+	doctor := func(claims map[string]interface{}) map[string]interface{} {
+		claims["realm_access"] = map[string]interface{}{"roles": []string{"doctor"}}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		payload map[string]interface{}
+		want    bool
+	}{
+		{name: "scope claim", path: "/drugs/1", payload: doctor(map[string]interface{}{"scope": "openid read:drugs"}), want: true},
+		{name: "scp list", path: "/drugs/1", payload: doctor(map[string]interface{}{"scp": []string{"admin"}}), want: true},
+		{name: "scp string", path: "/drugs/1", payload: doctor(map[string]interface{}{"scp": "profile read:drugs"}), want: true},
+		{name: "missing scope", path: "/drugs/1", payload: doctor(map[string]interface{}{"scope": "openid write:drugs"}), want: false},
+		{name: "no scopes", path: "/drugs/1", payload: doctor(map[string]interface{}{}), want: false},
+		{name: "scope without role", path: "/drugs/1", payload: map[string]interface{}{"scope": "read:drugs"}, want: false},
+		{name: "no scopes required", path: "/patients", payload: doctor(map[string]interface{}{}), want: true},
+		{name: "scope of exact path", path: "/drugs/recalled", payload: doctor(map[string]interface{}{"scope": "recall:drugs"}), want: true},
+		{name: "scope of templated path on exact path", path: "/drugs/recalled", payload: doctor(map[string]interface{}{"scope": "read:drugs"}), want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := evalService(t, outputDir, "scopesService", "allow", test.payload, request(test.path)); got != test.want {
+				t.Errorf("allow for %s = %v, want %v", test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestGenerateServiceFolderReasons(t *testing.T) {
+	outputDir := t.TempDir()
+	options := ServiceOptions{ServiceName: "reasonsService"}
+	err := GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
+		Deny: []policy.PolicyClause{
+			{UserPolicy: &policy.UserPolicy{PolicyDetail: policy.PolicyDetail{Value: []string{"mallory"}, Operator: policy.OperatorOr}}},
+		},
+		SpecializedPaths: map[string]policy.PathPolicies{
+			"/drugs": {
+				Path: "/drugs",
+				SpecializedMethods: map[string]policy.PathMethodPolicies{
+					"get": {Method: "get", Policies: []policy.PolicyClause{
+						{RolePolicy: &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Value: []string{"doctors"}, Operator: policy.OperatorOr}}},
+					}},
+				},
+			},
+			"/patients/{owner}": {
+				Path: "/patients/{owner}",
+				Policies: []policy.PolicyClause{
+					{PathParamsPolicy: &policy.PathParamsPolicy{Value: map[string]string{"owner": "preferred_username"}}},
+				},
+			},
+		},
+		Scopes: []policy.ScopeRequirement{
+			{Path: "/drugs", Method: "get", Alternatives: [][]string{{"read"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+
+	request := func(path string, method string) map[string]interface{} {
+		return map[string]interface{}{
+			"attributes": map[string]interface{}{
+				"request": map[string]interface{}{
+					"http": map[string]interface{}{"path": path, "method": method},
+				},
+			},
+		}
+	}
+	user := func(name string, role string) map[string]interface{} {
+		return map[string]interface{}{"preferred_username": name, "scope": "read", "realm_access": map[string]interface{}{"roles": []string{role}}}
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		method  string
+		payload map[string]interface{}
+		want    []interface{}
+	}{
+		{name: "allowed", path: "/drugs", method: "GET", payload: user("alice", "doctors"), want: []interface{}{}},
+		{name: "missing role", path: "/drugs", method: "GET", payload: user("alice", "nurses"), want: []interface{}{"role doctors required on GET /drugs"}},
+		{name: "denied user", path: "/drugs", method: "GET", payload: user("mallory", "doctors"), want: []interface{}{"request denied to user mallory on GET /drugs"}},
+		{name: "missing scope", path: "/drugs", method: "GET", payload: map[string]interface{}{"preferred_username": "alice", "realm_access": map[string]interface{}{"roles": []string{"doctors"}}}, want: []interface{}{"OAuth2 scopes read required on GET /drugs"}},
+		{name: "method without policy", path: "/drugs", method: "POST", payload: user("alice", "doctors"), want: []interface{}{"no access policy on POST /drugs"}},
+		{name: "path parameter", path: "/patients/bob", method: "GET", payload: user("alice", "doctors"), want: []interface{}{"path parameter owner equal to claim preferred_username required on GET /patients/{owner}"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := evalService(t, outputDir, "reasonsService", "reasons", test.payload, request(test.path, test.method)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("reasons for %s %s = %v, want %v", test.method, test.path, got, test.want)
+			}
+		})
+	}
+}
+
+// testIdentityProvider is a stub identity provider serving its OIDC configuration and the public key of its signing
+// key in a JWKS, at the discovery url metadataURL.
+type testIdentityProvider struct {
+	server      *httptest.Server
+	key         *rsa.PrivateKey
+	metadataURL string
+}
+
+func newTestIdentityProvider(t *testing.T) *testIdentityProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	provider := &testIdentityProvider{key: key}
+	provider.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": provider.server.URL, "jwks_uri": provider.server.URL + "/jwks"})
+		case "/jwks":
+			json.NewEncoder(w).Encode(provider.jwks())
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(provider.server.Close)
+	provider.metadataURL = provider.server.URL + "/.well-known/openid-configuration"
+	return provider
+}
+
+func (p *testIdentityProvider) jwks() map[string]interface{} {
+	return map[string]interface{}{"keys": []interface{}{map[string]interface{}{
+		"kty": "RSA",
+		"kid": "test",
+		"alg": "RS256",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+	}}}
+}
+
+// signToken returns a RS256 token with the given claims, signed by key.
+func signToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "test"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// evalTokenValid evaluates whether the generated OIDC module of the service accepts the token, with the given data.
+func evalTokenValid(t *testing.T, outputDir string, serviceName string, token string, data map[string]interface{}) bool {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(outputDir, serviceName, "oidc.rego"))
+	if err != nil {
+		t.Fatalf("Failed to read OIDC file: %v", err)
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	rs, err := rego.New(
+		rego.Query("data."+serviceName+".oidc.token.valid"),
+		rego.Module("oidc.rego", string(content)),
+		rego.Store(inmem.NewFromObject(data)),
+		rego.Input(map[string]interface{}{"attributes": map[string]interface{}{"request": map[string]interface{}{"http": map[string]interface{}{
+			"headers": map[string]interface{}{"authorization": "Bearer " + token},
+		}}}}),
+	).Eval(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to evaluate OIDC policy: %v", err)
+	}
+	return len(rs) > 0 && rs[0].Expressions[0].Value == true
+}
+
+func TestGenerateServiceFolderTokenVerification(t *testing.T) {
+	provider := newTestIdentityProvider(t)
+	forgedKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	key := provider.key
+	sign := func(key *rsa.PrivateKey, claims map[string]interface{}) string {
+		return signToken(t, key, claims)
+	}
+	now := time.Now().Unix()
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{"iss": provider.server.URL, "aud": "teadal", "iat": now, "exp": now + 300, "preferred_username": "alice"}
+		for k, v := range extra {
+			claims[k] = v
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		options ServiceOptions
+		token   string
+		want    bool
+	}{
+		{name: "valid", token: sign(key, claims(nil)), want: true},
+		{name: "forged signature", token: sign(forgedKey, claims(nil)), want: false},
+		{name: "untrusted issuer", token: sign(key, claims(map[string]interface{}{"iss": "http://evil.example.com"})), want: false},
+		{name: "expired", token: sign(key, claims(map[string]interface{}{"exp": now - 10})), want: false},
+		{name: "expired within clock skew", options: ServiceOptions{ClockSkew: 30 * time.Second}, token: sign(key, claims(map[string]interface{}{"exp": now - 10})), want: true},
+		{name: "not yet valid", token: sign(key, claims(map[string]interface{}{"nbf": now + 10})), want: false},
+		{name: "not yet valid within clock skew", options: ServiceOptions{ClockSkew: 30 * time.Second}, token: sign(key, claims(map[string]interface{}{"nbf": now + 10})), want: true},
+		{name: "not yet valid beyond clock skew", options: ServiceOptions{ClockSkew: 30 * time.Second}, token: sign(key, claims(map[string]interface{}{"nbf": now + 60})), want: false},
+		{name: "expected audience", options: ServiceOptions{Audience: "teadal"}, token: sign(key, claims(map[string]interface{}{"aud": []string{"account", "teadal"}})), want: true},
+		{name: "wrong audience", options: ServiceOptions{Audience: "teadal"}, token: sign(key, claims(map[string]interface{}{"aud": "account"})), want: false},
+		{name: "missing audience", options: ServiceOptions{Audience: "teadal"}, token: sign(key, claims(map[string]interface{}{"aud": nil})), want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			options := test.options
+			options.ServiceName = "verification"
+			if err := GenerateServiceFolder(options, outputDir, []string{provider.metadataURL}, &policy.GeneralPolicies{}); err != nil {
+				t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+			}
+			got := evalTokenValid(t, outputDir, "verification", test.token, nil)
+			if got != test.want {
+				t.Errorf("token valid = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGenerateServiceFolderRoute(t *testing.T) {
+	outputDir := t.TempDir()
+	options := ServiceOptions{
+		ServiceName: "routedService",
+		PathPrefix:  "/api/v1",
+		Hosts:       []string{"a.teadal.eu", "b.teadal.eu"},
+	}
+	err := GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
+		Policies: []policy.PolicyClause{
+			{
+				UserPolicy: &policy.UserPolicy{
+					PolicyDetail: policy.PolicyDetail{Value: []string{"alice"}, Operator: "OR"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+
+	tests := []struct {
+		host string
+		path string
+		want bool
+	}{
+		{host: "a.teadal.eu", path: "/api/v1/data", want: true},
+		{host: "B.teadal.eu:8443", path: "/api/v1", want: true},
+		{host: "c.teadal.eu", path: "/api/v1/data", want: false},
+		{host: "a.teadal.eu", path: "/api/v2/data", want: false},
+		{host: "a.teadal.eu", path: "/api/v10/data", want: false},
+	}
+	for _, test := range tests {
+		input := map[string]interface{}{
+			"attributes": map[string]interface{}{
+				"request": map[string]interface{}{
+					"http": map[string]interface{}{"host": test.host, "path": test.path, "method": "GET"},
+				},
+			},
+		}
+		if got := evalService(t, outputDir, "routedService", "allow", map[string]interface{}{"preferred_username": "alice"}, input); got != test.want {
+			t.Errorf("allow for %s%s = %v, want %v", test.host, test.path, got, test.want)
+		}
+	}
+
+	// The route is exposed to the main policy, which dispatches the requests
+	route := evalService(t, outputDir, "routedService", "route", nil, map[string]interface{}{})
+	want := map[string]interface{}{"prefix": "/api/v1", "hosts": []interface{}{"a.teadal.eu", "b.teadal.eu"}}
+	if !reflect.DeepEqual(route, want) {
+		t.Errorf("route = %v, want %v", route, want)
+	}
+}
+
+func TestGenerateServiceFolderExtAuthzResult(t *testing.T) {
+	outputDir := t.TempDir()
+	options := ServiceOptions{
+		ServiceName:    "authzService",
+		ExtAuthzResult: true,
+	}
+	err := GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{
+		Policies: []policy.PolicyClause{
+			{
+				UserPolicy: &policy.UserPolicy{
+					PolicyDetail: policy.PolicyDetail{Value: []string{"alice"}, Operator: "OR"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+
+	request := func() map[string]interface{} {
+		return map[string]interface{}{
+			"attributes": map[string]interface{}{
+				"request": map[string]interface{}{
+					"http": map[string]interface{}{"path": "/data", "method": "GET"},
+				},
+			},
+		}
+	}
+	alice := map[string]interface{}{"preferred_username": "alice", "realm_access": map[string]interface{}{"roles": []string{"viewer", "admin"}}}
+	want := map[string]interface{}{
+		"allowed": true,
+		"headers": map[string]interface{}{"x-user": "alice", "x-roles": "admin,viewer"},
+	}
+	if got := evalService(t, outputDir, "authzService", "result", alice, request()); !reflect.DeepEqual(got, want) {
+		t.Errorf("result for alice = %v, want %v", got, want)
+	}
+
+	want = map[string]interface{}{
+		"allowed":     false,
+		"http_status": json.Number("403"),
+		"headers":     map[string]interface{}{"content-type": "text/plain"},
+		"body":        "no access policy allows the request",
+	}
+	if got := evalService(t, outputDir, "authzService", "result", map[string]interface{}{"preferred_username": "bob"}, request()); !reflect.DeepEqual(got, want) {
+		t.Errorf("result for bob = %v, want %v", got, want)
+	}
+
+	// Without the option, only allow is generated
+	options = ServiceOptions{ServiceName: "plainService"}
+	if err := GenerateServiceFolder(options, outputDir, []string{"http://localhost:8000/keykloack/realms/test"}, &policy.GeneralPolicies{}); err != nil {
+		t.Fatalf("GenerateServiceFolder returned an error: %v", err)
+	}
+	if got := evalService(t, outputDir, "plainService", "result", alice, request()); got != nil {
+		t.Errorf("Expected no result without the ext_authz option, got %v", got)
+	}
+}
@@ -70,3 +70,29 @@ func GenerateStaticFolders(outputDir string) {
 		fmt.Printf("Error walking the path %s: %v\n", sourceDir, err)
 	}
 }
+
+// StaticServiceFiles reads the files of a static service from PROJECT_ROOT/static, keyed by their path in the bundle,
+// e.g. /rego/minio/service.rego.
+func StaticServiceFiles(serviceName string) (map[string][]byte, error) {
+	sourceDir := filepath.Join("./static", serviceName)
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(sourceDir, func(sourcePath string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relativePath, err := filepath.Rel("./static", sourcePath)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(sourcePath)
+		if err != nil {
+			return err
+		}
+		files["/rego/"+filepath.ToSlash(relativePath)] = content
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read static service %s: %v", serviceName, err)
+	}
+	return files, nil
+}
@@ -2,14 +2,23 @@ package policy
 
 import (
 	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/ast"
 )
 
 type Operator string
 
 type Policy interface {
-	// ToRego converts the policy to a Rego expression.
-	ToRego() string
+	// ToRego converts the policy to the Rego expressions to be added to a rule body.
+	ToRego() ([]*ast.Expr, error)
+	// Describe returns a human readable description of the condition checked by the policy, e.g. role doctors.
+	Describe() string
 }
 
 const (
@@ -27,25 +36,24 @@ type UserPolicy struct {
 	PolicyDetail `yaml:",inline"`
 }
 
-// ToRego converts the UserPolicy to a Rego expression.
-// It generates a Rego rule that checks if the user is in the allowed list or matches the specified values.
+// ToRego converts the UserPolicy to Rego expressions.
+// It generates the expressions that check if the user is in the allowed list or matches the specified values.
 // If the operator is AND, it checks for equality with each value.
 // If the operator is OR, it checks if the user is in the list of values.
-// The generated Rego rule is returned as a string.
-func (p *UserPolicy) ToRego() string {
-	var result string
+func (p *UserPolicy) ToRego() ([]*ast.Expr, error) {
 	if p.Operator == OperatorAnd {
+		exprs := make([]*ast.Expr, 0, len(p.Value))
 		for _, v := range p.Value {
-			result += "user == " + v + "\n"
-		}
-	} else {
-		values, err := json.Marshal(p.Value)
-		if err != nil {
-			panic(err)
+			exprs = append(exprs, ast.Equal.Expr(ast.VarTerm("user"), ast.StringTerm(v)))
 		}
-		result = "user in " + string(values) + "\n"
+		return exprs, nil
 	}
-	return result
+	return []*ast.Expr{ast.Member.Expr(ast.VarTerm("user"), stringArrayTerm(p.Value))}, nil
+}
+
+// Describe returns the users checked by the policy, e.g. user alice or bob.
+func (p *UserPolicy) Describe() string {
+	return "user " + joinValues(p.Value, p.Operator)
 }
 
 // RolePolicy represents a policy that checks if a user has a specific role (AND) or if the user has any of the roles in a list (OR).
@@ -53,30 +61,23 @@ type RolePolicy struct {
 	PolicyDetail `yaml:",inline"`
 }
 
-// ToRego converts the RolePolicy to a Rego expression.
-// It generates a Rego rule that checks if the user has the specified role or matches any of the roles in the list.
+// ToRego converts the RolePolicy to Rego expressions.
+// It generates the expression that checks if the user has the specified role or matches any of the roles in the list.
 // If the operator is AND, it checks that all roles required are present.
 // If the operator is OR, it checks if the user has any of the roles in the list.
-func (p *RolePolicy) ToRego() string {
-	var result string
+func (p *RolePolicy) ToRego() ([]*ast.Expr, error) {
 	if len(p.Value) == 0 {
-		return result
-	}
-
-	roleJson, err := json.Marshal(p.Value)
-	if err != nil {
-		panic(err)
+		return []*ast.Expr{}, nil
 	}
-	roleJsonSet := string(roleJson)
-	roleJsonSet = strings.Replace(roleJsonSet, "[", "{", 1)
-	roleJsonSet = strings.Replace(roleJsonSet, "]", "}", 1)
+	return []*ast.Expr{setMatchExpr(p.Value, p.Operator, ast.VarTerm("roles"))}, nil
+}
 
-	if p.Operator == OperatorAnd {
-		result = "count(" + roleJsonSet + "-roles) == 0\n"
-	} else {
-		result = "count(" + roleJsonSet + "&roles) != 0\n"
+// Describe returns the roles checked by the policy, e.g. role doctors or nurses.
+func (p *RolePolicy) Describe() string {
+	if p.Operator == OperatorAnd && len(p.Value) > 1 {
+		return "roles " + joinValues(p.Value, p.Operator)
 	}
-	return result
+	return "role " + joinValues(p.Value, p.Operator)
 }
 
 // StorageLocationPolicy represents a policy that checks if a storage location is in a list of allowed locations (OR) or if the location is equal to a specific list of values (AND).
@@ -84,8 +85,20 @@ type StorageLocationPolicy struct {
 	PolicyDetail `yaml:",inline"`
 }
 
-func (p *StorageLocationPolicy) ToRego() string {
-	return ""
+// ToRego converts the StorageLocationPolicy to Rego expressions.
+// It generates a check on location_regions, the set of regions containing the request location defined by the service.
+// If the operator is AND, the location must be within all the regions in the list.
+// If the operator is OR, the location must be within any of the regions in the list.
+func (p *StorageLocationPolicy) ToRego() ([]*ast.Expr, error) {
+	if len(p.Value) == 0 {
+		return []*ast.Expr{}, nil
+	}
+	return []*ast.Expr{setMatchExpr(p.Value, p.Operator, ast.VarTerm("location_regions"))}, nil
+}
+
+// Describe returns the regions checked by the policy, e.g. location in Europe.
+func (p *StorageLocationPolicy) Describe() string {
+	return "location in " + joinValues(p.Value, p.Operator)
 }
 
 type CallFrequency string
@@ -94,38 +107,356 @@ const (
 	CallFrequencyDaily   CallFrequency = "call_per_day"
 	CallFrequencyWeekly  CallFrequency = "call_per_week"
 	CallFrequencyMonthly CallFrequency = "call_per_month"
+	CallFrequencyYearly  CallFrequency = "call_per_year"
 )
 
+// Valid reports whether the frequency is one of the supported units of measure.
+func (f CallFrequency) Valid() bool {
+	switch f {
+	case CallFrequencyDaily, CallFrequencyWeekly, CallFrequencyMonthly, CallFrequencyYearly:
+		return true
+	}
+	return false
+}
+
+// CallLimit is a single quota of a CallPolicy, e.g. at most 1000 calls per month.
+type CallLimit struct {
+	Max           string
+	UnitOfMeasure CallFrequency `yaml:"unit_of_measure"`
+}
+
 // CallPolicy represents a policy that checks the maximum number of calls allowed in a given time period.
 type CallPolicy struct {
-	Value []struct {
-		Max           string
-		UnitOfMeasure CallFrequency `yaml:"unit_of_measure"`
+	Value []CallLimit
+}
+
+// ToRego converts the CallPolicy to Rego expressions.
+// Each limit generates a check against the call_count function defined by the service, which asks the quota
+// service how many calls the user already performed in the period. The request is allowed only if the count
+// is below the maximum. Limits without a maximum do not generate any check.
+func (call *CallPolicy) ToRego() ([]*ast.Expr, error) {
+	exprs := make([]*ast.Expr, 0, len(call.Value))
+	for _, limit := range call.Value {
+		if limit.Max == "" {
+			continue
+		}
+		maxCalls, err := strconv.Atoi(limit.Max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid call max %q: %w", limit.Max, err)
+		}
+		callCount := ast.CallTerm(ast.VarTerm("call_count"), ast.StringTerm(string(limit.UnitOfMeasure)))
+		exprs = append(exprs, ast.LessThan.Expr(callCount, ast.IntNumberTerm(maxCalls)))
 	}
+	return exprs, nil
 }
 
-func (call *CallPolicy) ToRego() string {
-	// TODO(anyone): Understand how to implement this in Rego
-	return ""
+// Describe returns the limits checked by the policy, e.g. fewer than 100 calls per day.
+func (call *CallPolicy) Describe() string {
+	limits := make([]string, 0, len(call.Value))
+	for _, limit := range call.Value {
+		if limit.Max == "" {
+			continue
+		}
+		limits = append(limits, fmt.Sprintf("fewer than %s calls per %s", limit.Max, strings.TrimPrefix(string(limit.UnitOfMeasure), "call_per_")))
+	}
+	return strings.Join(limits, " and ")
 }
 
 type StorageDuration string
 
 const (
-	StorageDurationDay   StorageDuration = "days"
-	StorageDurationWeek  StorageDuration = "weeks"
-	StorageDurationMonth StorageDuration = "months"
+	StorageDurationMinute StorageDuration = "minutes"
+	StorageDurationHour   StorageDuration = "hours"
+	StorageDurationDay    StorageDuration = "days"
+	StorageDurationWeek   StorageDuration = "weeks"
+	StorageDurationMonth  StorageDuration = "months"
+	StorageDurationYear   StorageDuration = "years"
 )
 
+// storageDurations maps each supported unit of measure to its length. Months and years have a fixed length of 30 and 365 days.
+var storageDurations = map[StorageDuration]time.Duration{
+	StorageDurationMinute: time.Minute,
+	StorageDurationHour:   time.Hour,
+	StorageDurationDay:    24 * time.Hour,
+	StorageDurationWeek:   7 * 24 * time.Hour,
+	StorageDurationMonth:  30 * 24 * time.Hour,
+	StorageDurationYear:   365 * 24 * time.Hour,
+}
+
+// Valid reports whether the duration is one of the supported units of measure.
+func (d StorageDuration) Valid() bool {
+	_, ok := storageDurations[d]
+	return ok
+}
+
+// Nanoseconds returns the length of amount units of measure in nanoseconds, the unit used by Rego time functions.
+func (d StorageDuration) Nanoseconds(amount int) int64 {
+	return int64(amount) * storageDurations[d].Nanoseconds()
+}
+
+// TimelinessLimit is a single bound of a TimelinessPolicy, e.g. data at most 7 days old.
+type TimelinessLimit struct {
+	Max           string
+	Min           string
+	UnitOfMeasure StorageDuration `yaml:"unit_of_measure"`
+}
+
 // TimelinessPolicy represents a policy that checks the maximum time allowed for data persistence.
 type TimelinessPolicy struct {
-	Value []struct {
-		Max           string
-		UnitOfMeasure StorageDuration `yaml:"unit_of_measure"`
+	Value []TimelinessLimit
+}
+
+// ToRego converts the TimelinessPolicy to Rego expressions.
+// It generates a check on the age of the requested data, computed from the data_timestamp defined by the service.
+// The maximum is an upper bound on the age, the minimum a lower bound.
+func (timeliness *TimelinessPolicy) ToRego() ([]*ast.Expr, error) {
+	exprs := make([]*ast.Expr, 0, len(timeliness.Value))
+	age := ast.Minus.Call(ast.NowNanos.Call(), ast.VarTerm("data_timestamp"))
+	for _, limit := range timeliness.Value {
+		if limit.Max != "" {
+			maxAge, err := strconv.Atoi(limit.Max)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeliness max %q: %w", limit.Max, err)
+			}
+			exprs = append(exprs, ast.LessThanEq.Expr(age, int64Term(limit.UnitOfMeasure.Nanoseconds(maxAge))))
+		}
+		if limit.Min != "" {
+			minAge, err := strconv.Atoi(limit.Min)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeliness min %q: %w", limit.Min, err)
+			}
+			exprs = append(exprs, ast.GreaterThanEq.Expr(age, int64Term(limit.UnitOfMeasure.Nanoseconds(minAge))))
+		}
+	}
+	return exprs, nil
+}
+
+// Describe returns the bounds checked by the policy, e.g. data at most 7 days old.
+func (timeliness *TimelinessPolicy) Describe() string {
+	bounds := make([]string, 0, len(timeliness.Value))
+	for _, limit := range timeliness.Value {
+		if limit.Max != "" {
+			bounds = append(bounds, fmt.Sprintf("data at most %s %s old", limit.Max, limit.UnitOfMeasure))
+		}
+		if limit.Min != "" {
+			bounds = append(bounds, fmt.Sprintf("data at least %s %s old", limit.Min, limit.UnitOfMeasure))
+		}
+	}
+	return strings.Join(bounds, " and ")
+}
+
+// PathParamsPolicy represents a policy that checks that the parameters of a templated path are equal to claims of the token,
+// e.g. an owner_id path parameter equal to the preferred_username claim. Nested claims are separated by dots.
+type PathParamsPolicy struct {
+	Value map[string]string `yaml:"value"`
+}
+
+// ToRego converts the PathParamsPolicy to Rego expressions.
+// It generates an equality check between each parameter in path_params, bound by the path condition, and the token claim.
+func (p *PathParamsPolicy) ToRego() ([]*ast.Expr, error) {
+	exprs := make([]*ast.Expr, 0, len(p.Value))
+	for _, param := range slices.Sorted(maps.Keys(p.Value)) {
+		pathParam := ast.RefTerm(ast.VarTerm("path_params"), ast.StringTerm(param))
+		exprs = append(exprs, ast.Equal.Expr(pathParam, ClaimRef(p.Value[param])))
+	}
+	return exprs, nil
+}
+
+// Describe returns the parameters checked by the policy, e.g. path parameter owner equal to claim preferred_username.
+func (p *PathParamsPolicy) Describe() string {
+	params := make([]string, 0, len(p.Value))
+	for _, param := range slices.Sorted(maps.Keys(p.Value)) {
+		params = append(params, fmt.Sprintf("path parameter %s equal to claim %s", param, p.Value[param]))
+	}
+	return strings.Join(params, " and ")
+}
+
+type ClaimOperator string
+
+const (
+	ClaimOperatorEqual          ClaimOperator = "eq"
+	ClaimOperatorNotEqual       ClaimOperator = "neq"
+	ClaimOperatorIn             ClaimOperator = "in"
+	ClaimOperatorContains       ClaimOperator = "contains"
+	ClaimOperatorRegex          ClaimOperator = "regex"
+	ClaimOperatorLessThan       ClaimOperator = "lt"
+	ClaimOperatorLessOrEqual    ClaimOperator = "lte"
+	ClaimOperatorGreaterThan    ClaimOperator = "gt"
+	ClaimOperatorGreaterOrEqual ClaimOperator = "gte"
+)
+
+// claimComparisons maps the numeric operators to the Rego comparison operators.
+var claimComparisons = map[ClaimOperator]*ast.Builtin{
+	ClaimOperatorLessThan:       ast.LessThan,
+	ClaimOperatorLessOrEqual:    ast.LessThanEq,
+	ClaimOperatorGreaterThan:    ast.GreaterThan,
+	ClaimOperatorGreaterOrEqual: ast.GreaterThanEq,
+}
+
+// claimOperatorDescriptions holds the wording of each claim operator in the descriptions of the conditions.
+var claimOperatorDescriptions = map[ClaimOperator]string{
+	ClaimOperatorEqual:          "equal to",
+	ClaimOperatorNotEqual:       "not equal to",
+	ClaimOperatorIn:             "in",
+	ClaimOperatorContains:       "containing",
+	ClaimOperatorRegex:          "matching",
+	ClaimOperatorLessThan:       "less than",
+	ClaimOperatorLessOrEqual:    "at most",
+	ClaimOperatorGreaterThan:    "greater than",
+	ClaimOperatorGreaterOrEqual: "at least",
+}
+
+// Valid reports whether the operator is one of the supported claim operators, or is omitted, meaning equal.
+func (o ClaimOperator) Valid() bool {
+	switch o {
+	case ClaimOperatorEqual, "", ClaimOperatorNotEqual, ClaimOperatorIn, ClaimOperatorContains, ClaimOperatorRegex:
+		return true
+	}
+	_, ok := claimComparisons[o]
+	return ok
+}
+
+// Numeric reports whether the operator compares numbers.
+func (o ClaimOperator) Numeric() bool {
+	_, ok := claimComparisons[o]
+	return ok
+}
+
+// ClaimCondition is a single condition of a ClaimsPolicy on a claim of the token payload, e.g. organization.country equal to Italy.
+type ClaimCondition struct {
+	// Claim of the token payload, nested claims are separated by dots
+	Claim    string        `yaml:"claim"`
+	Operator ClaimOperator `yaml:"operator"`
+	// Value compared with the claim: a list for in, a regular expression for regex and a number for numeric operators
+	Value interface{} `yaml:"value"`
+}
+
+// ToRego converts the condition to a Rego expression on the claim.
+func (c *ClaimCondition) ToRego() ([]*ast.Expr, error) {
+	if c.Claim == "" {
+		return nil, fmt.Errorf("missing claim name")
+	}
+	claim := ClaimRef(c.Claim)
+	value, err := ast.InterfaceToValue(c.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for claim %s: %w", c.Claim, err)
+	}
+	valueTerm := ast.NewTerm(value)
+	switch c.Operator {
+	case ClaimOperatorEqual, "":
+		return []*ast.Expr{ast.Equal.Expr(claim, valueTerm)}, nil
+	case ClaimOperatorNotEqual:
+		return []*ast.Expr{ast.NotEqual.Expr(claim, valueTerm)}, nil
+	case ClaimOperatorIn:
+		if _, ok := value.(*ast.Array); !ok {
+			return nil, fmt.Errorf("operator in on claim %s requires a list of values", c.Claim)
+		}
+		return []*ast.Expr{ast.Member.Expr(claim, valueTerm)}, nil
+	case ClaimOperatorContains:
+		return []*ast.Expr{ast.Member.Expr(valueTerm, claim)}, nil
+	case ClaimOperatorRegex:
+		if _, ok := value.(ast.String); !ok {
+			return nil, fmt.Errorf("operator regex on claim %s requires a string pattern", c.Claim)
+		}
+		return []*ast.Expr{ast.RegexMatch.Expr(valueTerm, claim)}, nil
+	}
+	comparison, ok := claimComparisons[c.Operator]
+	if !ok {
+		return nil, fmt.Errorf("unsupported operator %q on claim %s", c.Operator, c.Claim)
+	}
+	if _, ok := value.(ast.Number); !ok {
+		return nil, fmt.Errorf("operator %s on claim %s requires a number", c.Operator, c.Claim)
+	}
+	// Rego orders values of different types, so the claim must be checked to be a number
+	return []*ast.Expr{ast.IsNumber.Expr(claim), comparison.Expr(claim, valueTerm)}, nil
+}
+
+// Describe returns the condition on the claim, e.g. claim organization.country equal to "Italy".
+func (c *ClaimCondition) Describe() string {
+	operator, ok := claimOperatorDescriptions[c.Operator]
+	if !ok {
+		operator = claimOperatorDescriptions[ClaimOperatorEqual]
+	}
+	value, err := json.Marshal(c.Value)
+	if err != nil {
+		value = []byte(fmt.Sprint(c.Value))
+	}
+	return fmt.Sprintf("claim %s %s %s", c.Claim, operator, value)
+}
+
+// ClaimsPolicy represents a policy that checks arbitrary claims of the token payload. All the conditions must hold.
+type ClaimsPolicy struct {
+	Value []ClaimCondition `yaml:"value"`
+}
+
+// ToRego converts the ClaimsPolicy to Rego expressions, one or more for each condition.
+func (p *ClaimsPolicy) ToRego() ([]*ast.Expr, error) {
+	exprs := make([]*ast.Expr, 0, len(p.Value))
+	for _, condition := range p.Value {
+		conditionExprs, err := condition.ToRego()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, conditionExprs...)
+	}
+	return exprs, nil
+}
+
+// Describe returns the conditions of the policy, e.g. claim organization.country equal to "Italy".
+func (p *ClaimsPolicy) Describe() string {
+	conditions := make([]string, 0, len(p.Value))
+	for _, condition := range p.Value {
+		conditions = append(conditions, condition.Describe())
+	}
+	return strings.Join(conditions, " and ")
+}
+
+// ClaimRef returns the reference to a claim of the token payload. Nested claims are separated by dots, e.g. organization.country.
+func ClaimRef(claim string) *ast.Term {
+	ref := ast.Ref{ast.VarTerm("token"), ast.StringTerm("payload")}
+	for _, key := range strings.Split(claim, ".") {
+		ref = append(ref, ast.StringTerm(key))
+	}
+	return ast.NewTerm(ref)
+}
+
+// setMatchExpr returns the expression checking the values against a set variable.
+// If the operator is AND, all the values must be in the set, otherwise at least one of them.
+func setMatchExpr(values []string, operator Operator, set *ast.Term) *ast.Expr {
+	if operator == OperatorAnd {
+		return ast.Equal.Expr(ast.Count.Call(ast.Minus.Call(stringSetTerm(values), set)), ast.IntNumberTerm(0))
+	}
+	return ast.NotEqual.Expr(ast.Count.Call(ast.And.Call(stringSetTerm(values), set)), ast.IntNumberTerm(0))
+}
+
+// joinValues joins the values of a policy with "and" if the operator is AND, otherwise with "or", e.g. a, b or c.
+func joinValues(values []string, operator Operator) string {
+	conjunction := " or "
+	if operator == OperatorAnd {
+		conjunction = " and "
+	}
+	if len(values) <= 1 {
+		return strings.Join(values, "")
+	}
+	return strings.Join(values[:len(values)-1], ", ") + conjunction + values[len(values)-1]
+}
+
+func stringArrayTerm(values []string) *ast.Term {
+	terms := make([]*ast.Term, len(values))
+	for i, v := range values {
+		terms[i] = ast.StringTerm(v)
+	}
+	return ast.ArrayTerm(terms...)
+}
+
+func stringSetTerm(values []string) *ast.Term {
+	terms := make([]*ast.Term, len(values))
+	for i, v := range values {
+		terms[i] = ast.StringTerm(v)
 	}
+	return ast.SetTerm(terms...)
 }
 
-func (timeliness *TimelinessPolicy) ToRego() string {
-	// TODO(anyone): Understand how to implement this in Rego
-	return ""
+func int64Term(value int64) *ast.Term {
+	return ast.NumberTerm(json.Number(strconv.FormatInt(value, 10)))
 }
@@ -2,7 +2,11 @@ package policy_test
 
 import (
 	"dspn-regogenerator/internal/policy"
+	"strings"
 	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/format"
 )
 
 type testCase struct {
@@ -11,6 +15,19 @@ type testCase struct {
 	want string
 }
 
+// formatExprs returns the canonical Rego source of the expressions, one per line.
+func formatExprs(t *testing.T, exprs []*ast.Expr) string {
+	t.Helper()
+	if len(exprs) == 0 {
+		return ""
+	}
+	source, err := format.AstWithOpts(ast.NewBody(exprs...), format.Opts{RegoVersion: ast.RegoV1})
+	if err != nil {
+		t.Fatalf("failed to format expressions: %v", err)
+	}
+	return strings.TrimRight(string(source), "\n") + "\n"
+}
+
 func TestUserPolicy(t *testing.T) {
 	tests := []testCase{
 		{
@@ -21,7 +38,7 @@ func TestUserPolicy(t *testing.T) {
 					Operator: policy.OperatorAnd,
 				},
 			},
-			want: "user == user1\nuser == user2\n",
+			want: "user == \"user1\"\nuser == \"user2\"\n",
 		},
 		{
 			name: "Test with OR",
@@ -31,7 +48,7 @@ func TestUserPolicy(t *testing.T) {
 					Operator: policy.OperatorOr,
 				},
 			},
-			want: "user in [\"user1\",\"user2\"]\n",
+			want: "user in [\"user1\", \"user2\"]\n",
 		},
 		{
 			name: "Test with AND and empty user list",
@@ -57,7 +74,11 @@ func TestUserPolicy(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got := test.pol.ToRego()
+			exprs, err := test.pol.ToRego()
+			if err != nil {
+				t.Fatalf("ToRego() error = %v", err)
+			}
+			got := formatExprs(t, exprs)
 			if got != test.want {
 				t.Errorf("ToRego() = %v, want %v", got, test.want)
 			}
@@ -75,7 +96,7 @@ func TestRolePolicy(t *testing.T) {
 					Operator: policy.OperatorAnd,
 				},
 			},
-			want: `count({"role1","role2"}-roles) == 0` + "\n",
+			want: `count({"role1", "role2"} - roles) == 0` + "\n",
 		},
 		{
 			name: "Test with OR",
@@ -85,7 +106,7 @@ func TestRolePolicy(t *testing.T) {
 					Operator: policy.OperatorOr,
 				},
 			},
-			want: `count({"role1","role2"}&roles) != 0` + "\n",
+			want: `count({"role1", "role2"} & roles) != 0` + "\n",
 		},
 		{
 			name: "Test with AND and empty user list",
@@ -111,10 +132,285 @@ func TestRolePolicy(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got := test.pol.ToRego()
+			exprs, err := test.pol.ToRego()
+			if err != nil {
+				t.Fatalf("ToRego() error = %v", err)
+			}
+			got := formatExprs(t, exprs)
+			if got != test.want {
+				t.Errorf("ToRego() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCallPolicy(t *testing.T) {
+	tests := []testCase{
+		{
+			name: "Test with one limit",
+			pol: &policy.CallPolicy{
+				Value: []policy.CallLimit{
+					{Max: "100", UnitOfMeasure: policy.CallFrequencyDaily},
+				},
+			},
+			want: `call_count("call_per_day") < 100` + "\n",
+		},
+		{
+			name: "Test with multiple limits",
+			pol: &policy.CallPolicy{
+				Value: []policy.CallLimit{
+					{Max: "100", UnitOfMeasure: policy.CallFrequencyDaily},
+					{Max: "50000", UnitOfMeasure: policy.CallFrequencyYearly},
+				},
+			},
+			want: `call_count("call_per_day") < 100` + "\n" + `call_count("call_per_year") < 50000` + "\n",
+		},
+		{
+			name: "Test without max",
+			pol: &policy.CallPolicy{
+				Value: []policy.CallLimit{
+					{UnitOfMeasure: policy.CallFrequencyWeekly},
+				},
+			},
+			want: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exprs, err := test.pol.ToRego()
+			if err != nil {
+				t.Fatalf("ToRego() error = %v", err)
+			}
+			got := formatExprs(t, exprs)
 			if got != test.want {
 				t.Errorf("ToRego() = %v, want %v", got, test.want)
 			}
 		})
 	}
 }
+
+func TestTimelinessPolicy(t *testing.T) {
+	tests := []testCase{
+		{
+			name: "Test with max",
+			pol: &policy.TimelinessPolicy{
+				Value: []policy.TimelinessLimit{
+					{Max: "7", UnitOfMeasure: policy.StorageDurationDay},
+				},
+			},
+			want: "time.now_ns() - data_timestamp <= 604800000000000\n",
+		},
+		{
+			name: "Test with min and max",
+			pol: &policy.TimelinessPolicy{
+				Value: []policy.TimelinessLimit{
+					{Min: "10", Max: "60", UnitOfMeasure: policy.StorageDurationMinute},
+				},
+			},
+			want: "time.now_ns() - data_timestamp <= 3600000000000\ntime.now_ns() - data_timestamp >= 600000000000\n",
+		},
+		{
+			name: "Test with empty limit",
+			pol: &policy.TimelinessPolicy{
+				Value: []policy.TimelinessLimit{
+					{UnitOfMeasure: policy.StorageDurationWeek},
+				},
+			},
+			want: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exprs, err := test.pol.ToRego()
+			if err != nil {
+				t.Fatalf("ToRego() error = %v", err)
+			}
+			got := formatExprs(t, exprs)
+			if got != test.want {
+				t.Errorf("ToRego() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStorageLocationPolicy(t *testing.T) {
+	tests := []testCase{
+		{
+			name: "Test with AND",
+			pol: &policy.StorageLocationPolicy{
+				PolicyDetail: policy.PolicyDetail{
+					Value:    []string{"Europe", "Italy"},
+					Operator: policy.OperatorAnd,
+				},
+			},
+			want: `count({"Europe", "Italy"} - location_regions) == 0` + "\n",
+		},
+		{
+			name: "Test with OR",
+			pol: &policy.StorageLocationPolicy{
+				PolicyDetail: policy.PolicyDetail{
+					Value:    []string{"Europe", "USA"},
+					Operator: policy.OperatorOr,
+				},
+			},
+			want: `count({"Europe", "USA"} & location_regions) != 0` + "\n",
+		},
+		{
+			name: "Test with empty location list",
+			pol: &policy.StorageLocationPolicy{
+				PolicyDetail: policy.PolicyDetail{
+					Value:    []string{},
+					Operator: policy.OperatorOr,
+				},
+			},
+			want: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exprs, err := test.pol.ToRego()
+			if err != nil {
+				t.Fatalf("ToRego() error = %v", err)
+			}
+			got := formatExprs(t, exprs)
+			if got != test.want {
+				t.Errorf("ToRego() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPathParamsPolicy(t *testing.T) {
+	tests := []testCase{
+		{
+			name: "Test with one parameter",
+			pol: &policy.PathParamsPolicy{
+				Value: map[string]string{"owner_id": "preferred_username"},
+			},
+			want: `path_params.owner_id == token.payload.preferred_username` + "\n",
+		},
+		{
+			name: "Test with nested claim",
+			pol: &policy.PathParamsPolicy{
+				Value: map[string]string{"org": "organization.id", "country": "organization.country"},
+			},
+			want: `path_params.country == token.payload.organization.country` + "\n" +
+				`path_params.org == token.payload.organization.id` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exprs, err := test.pol.ToRego()
+			if err != nil {
+				t.Fatalf("ToRego() error = %v", err)
+			}
+			got := formatExprs(t, exprs)
+			if got != test.want {
+				t.Errorf("ToRego() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCallPolicyInvalidMax(t *testing.T) {
+	pol := &policy.CallPolicy{
+		Value: []policy.CallLimit{
+			{Max: "many", UnitOfMeasure: policy.CallFrequencyDaily},
+		},
+	}
+	if _, err := pol.ToRego(); err == nil {
+		t.Errorf("ToRego() expected an error for a non numeric max")
+	}
+}
+
+func TestUserPolicyQuoting(t *testing.T) {
+	pol := &policy.UserPolicy{
+		PolicyDetail: policy.PolicyDetail{
+			Value:    []string{`john "the admin"`},
+			Operator: policy.OperatorAnd,
+		},
+	}
+	exprs, err := pol.ToRego()
+	if err != nil {
+		t.Fatalf("ToRego() error = %v", err)
+	}
+	want := `user == "john \"the admin\""` + "\n"
+	if got := formatExprs(t, exprs); got != want {
+		t.Errorf("ToRego() = %v, want %v", got, want)
+	}
+}
+
+func TestClaimsPolicy(t *testing.T) {
+	tests := []testCase{
+		{
+			name: "Test with equality on nested claim",
+			pol: &policy.ClaimsPolicy{
+				Value: []policy.ClaimCondition{
+					{Claim: "organization.country", Operator: policy.ClaimOperatorEqual, Value: "Italy"},
+				},
+			},
+			want: `token.payload.organization.country == "Italy"` + "\n",
+		},
+		{
+			name: "Test with membership",
+			pol: &policy.ClaimsPolicy{
+				Value: []policy.ClaimCondition{
+					{Claim: "contract_id", Operator: policy.ClaimOperatorIn, Value: []interface{}{"c1", "c2"}},
+					{Claim: "groups", Operator: policy.ClaimOperatorContains, Value: "researchers"},
+				},
+			},
+			want: `token.payload.contract_id in ["c1", "c2"]` + "\n" + `"researchers" in token.payload.groups` + "\n",
+		},
+		{
+			name: "Test with regex",
+			pol: &policy.ClaimsPolicy{
+				Value: []policy.ClaimCondition{
+					{Claim: "email", Operator: policy.ClaimOperatorRegex, Value: `@teadal\.eu$`},
+				},
+			},
+			want: `regex.match("@teadal\\.eu$", token.payload.email)` + "\n",
+		},
+		{
+			name: "Test with numeric comparison",
+			pol: &policy.ClaimsPolicy{
+				Value: []policy.ClaimCondition{
+					{Claim: "clearance", Operator: policy.ClaimOperatorGreaterOrEqual, Value: 3},
+				},
+			},
+			want: "is_number(token.payload.clearance)\ntoken.payload.clearance >= 3\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exprs, err := test.pol.ToRego()
+			if err != nil {
+				t.Fatalf("ToRego() error = %v", err)
+			}
+			got := formatExprs(t, exprs)
+			if got != test.want {
+				t.Errorf("ToRego() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestClaimsPolicyInvalidValue(t *testing.T) {
+	conditions := []policy.ClaimCondition{
+		{Claim: "country", Operator: policy.ClaimOperatorIn, Value: "Italy"},
+		{Claim: "clearance", Operator: policy.ClaimOperatorLessThan, Value: "high"},
+		{Claim: "email", Operator: policy.ClaimOperatorRegex, Value: 3},
+		{Claim: "country", Operator: "like", Value: "Italy"},
+		{Operator: policy.ClaimOperatorEqual, Value: "Italy"},
+	}
+	for _, condition := range conditions {
+		pol := &policy.ClaimsPolicy{Value: []policy.ClaimCondition{condition}}
+		if _, err := pol.ToRego(); err == nil {
+			t.Errorf("ToRego() expected an error for %v", condition)
+		}
+	}
+}
@@ -2,19 +2,35 @@ package policy_test
 
 import (
 	"dspn-regogenerator/internal/policy"
+	"maps"
+	"strings"
 	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
 )
 
 type groupTestCase struct {
 	name string
 	pol  interface {
-		ToRego() []string
+		ToRego(helpers *policy.Helpers) ([]ast.Body, error)
 	}
 	want []string
 }
 
+type clauseTestCase struct {
+	name string
+	pol  *policy.PolicyClause
+	want string
+}
+
+type generalTestCase struct {
+	name string
+	pol  *policy.GeneralPolicies
+	want string
+}
+
 func TestPolicyClause(t *testing.T) {
-	tests := []testCase{
+	tests := []clauseTestCase{
 		{
 			name: "empty",
 			pol:  &policy.PolicyClause{},
@@ -30,7 +46,7 @@ func TestPolicyClause(t *testing.T) {
 					},
 				},
 			},
-			want: "user in [\"user1\",\"user2\"]\n",
+			want: "user in [\"user1\", \"user2\"]\n",
 		},
 		{
 			name: "role policy",
@@ -42,7 +58,7 @@ func TestPolicyClause(t *testing.T) {
 					},
 				},
 			},
-			want: `count({"role1","role2"}-roles) == 0` + "\n",
+			want: `count({"role1", "role2"} - roles) == 0` + "\n",
 		},
 		{
 			name: "user and role policy",
@@ -60,13 +76,17 @@ func TestPolicyClause(t *testing.T) {
 					},
 				},
 			},
-			want: "user in [\"user1\",\"user2\"]\n" + `count({"role1","role2"}-roles) == 0` + "\n",
+			want: "user in [\"user1\", \"user2\"]\n" + `count({"role1", "role2"} - roles) == 0` + "\n",
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got := test.pol.ToRego()
+			exprs, err := test.pol.ToRego(policy.NewHelpers())
+			if err != nil {
+				t.Fatalf("ToRego() error = %v", err)
+			}
+			got := formatExprs(t, exprs)
 			if got != test.want {
 				t.Errorf("got %q, want %q", got, test.want)
 			}
@@ -75,7 +95,7 @@ func TestPolicyClause(t *testing.T) {
 }
 
 func TestGeneralPolicies(t *testing.T) {
-	tests := []testCase{
+	tests := []generalTestCase{
 		{
 			name: "empty",
 			pol:  &policy.GeneralPolicies{},
@@ -101,7 +121,7 @@ func TestGeneralPolicies(t *testing.T) {
 					},
 				},
 			},
-			want: "allow if {\nuser in [\"user1\",\"user2\"]\n" + `count({"role1","role2"}-roles) == 0` + "\n" + "}\n",
+			want: "allow_request if {\n\tuser in [\"user1\", \"user2\"]\n\tcount({\"role1\", \"role2\"} - roles) == 0\n}\n",
 		},
 		{
 			name: "two clauses",
@@ -132,7 +152,7 @@ func TestGeneralPolicies(t *testing.T) {
 				},
 			},
 			// Two clauses should generate separate allow statements (OR condition)
-			want: "allow if {\nuser in [\"user1\",\"user2\"]\n" + `count({"role1","role2"}-roles) == 0` + "\n" + "}\n\nallow if {\nuser in [\"user3\",\"user4\"]\n}\n",
+			want: "allow_request if {\n\tuser in [\"user1\", \"user2\"]\n\tcount({\"role1\", \"role2\"} - roles) == 0\n}\n\nallow_request if user in [\"user3\", \"user4\"]\n",
 		},
 		{
 			name: "with excluded paths",
@@ -169,7 +189,7 @@ func TestGeneralPolicies(t *testing.T) {
 					},
 				},
 			},
-			want: "allow if {\nuser in [\"user1\",\"user2\"]\n" + `count({"role1","role2"}-roles) == 0` + "\n" + "not request.path in [\"/path1\"]\n}\n\nallow if {\nuser in [\"user1\",\"user2\"]\n" + `count({"role1","role2"}-roles) == 0` + "\n" + "request.path == \"/path1\"\nuser in [\"user3\",\"user4\"]\n}\n",
+			want: "allow_request if {\n\tuser in [\"user1\", \"user2\"]\n\tcount({\"role1\", \"role2\"} - roles) == 0\n\tnot path in [\"/path1\"]\n}\n\nallow_request if {\n\tuser in [\"user1\", \"user2\"]\n\tcount({\"role1\", \"role2\"} - roles) == 0\n\tpath == \"/path1\"\n\tuser in [\"user3\", \"user4\"]\n}\n",
 		},
 		{
 			name: "only specialized paths",
@@ -190,13 +210,16 @@ func TestGeneralPolicies(t *testing.T) {
 					},
 				},
 			},
-			want: "allow if {\nrequest.path == \"/path1\"\nuser in [\"user3\",\"user4\"]\n}\n",
+			want: "allow_request if {\n\tpath == \"/path1\"\n\tuser in [\"user3\", \"user4\"]\n}\n",
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got := test.pol.ToRego()
+			got, err := test.pol.ToRego()
+			if err != nil {
+				t.Fatalf("ToRego() error = %v", err)
+			}
 			if got != test.want {
 				t.Errorf("got %q, want %q", got, test.want)
 			}
@@ -227,7 +250,7 @@ func TestPathPolicies(t *testing.T) {
 				Path: "/path1",
 			},
 			// This should generate the policies with a path condition
-			want: []string{"request.path == \"/path1\"\nuser in [\"user1\",\"user2\"]\n"},
+			want: []string{"path == \"/path1\"\nuser in [\"user1\", \"user2\"]\n"},
 		},
 		{
 			name: "two clauses",
@@ -253,8 +276,8 @@ func TestPathPolicies(t *testing.T) {
 
 				Path: "/path1",
 			},
-			want: []string{"request.path == \"/path1\"\nuser in [\"user1\",\"user2\"]\n",
-				"request.path == \"/path1\"\nuser in [\"user3\",\"user4\"]\n"},
+			want: []string{"path == \"/path1\"\nuser in [\"user1\", \"user2\"]\n",
+				"path == \"/path1\"\nuser in [\"user3\", \"user4\"]\n"},
 		},
 		{
 			name: "with specialized methods",
@@ -288,8 +311,8 @@ func TestPathPolicies(t *testing.T) {
 					},
 				},
 			},
-			want: []string{"request.path == \"/path1\"\nuser in [\"user1\",\"user2\"]\nnot request.method in [\"GET\"]\n",
-				"request.path == \"/path1\"\nuser in [\"user1\",\"user2\"]\nrequest.method == \"GET\"\nuser in [\"user5\",\"user6\"]\n"},
+			want: []string{"path == \"/path1\"\nuser in [\"user1\", \"user2\"]\nnot method in [\"GET\"]\n",
+				"path == \"/path1\"\nuser in [\"user1\", \"user2\"]\nmethod == \"GET\"\nuser in [\"user5\", \"user6\"]\n"},
 		},
 		{
 			name: "only specialized methods",
@@ -324,8 +347,8 @@ func TestPathPolicies(t *testing.T) {
 				},
 				Path: "/path1",
 			},
-			want: []string{"request.path == \"/path1\"\nrequest.method == \"GET\"\nuser in [\"user5\",\"user6\"]\n",
-				"request.path == \"/path1\"\nrequest.method == \"POST\"\nuser in [\"user7\",\"user8\"]\n"},
+			want: []string{"path == \"/path1\"\nmethod == \"GET\"\nuser in [\"user5\", \"user6\"]\n",
+				"path == \"/path1\"\nmethod == \"POST\"\nuser in [\"user7\", \"user8\"]\n"},
 		},
 		{
 			name: "two clauses with two specialized methods",
@@ -378,21 +401,27 @@ func TestPathPolicies(t *testing.T) {
 				},
 				Path: "/path1",
 			},
-			want: []string{"request.path == \"/path1\"\nuser in [\"user1\",\"user2\"]\nnot request.method in [\"GET\",\"POST\"]\n",
-				"request.path == \"/path1\"\nuser in [\"user1\",\"user2\"]\nrequest.method == \"GET\"\n" + `count({"role1","role2"}&roles) != 0` + "\n",
-				"request.path == \"/path1\"\nuser in [\"user1\",\"user2\"]\nrequest.method == \"POST\"\n" + `count({"role3","role4"}&roles) != 0` + "\n",
-				"request.path == \"/path1\"\nuser in [\"user3\",\"user4\"]\nnot request.method in [\"GET\",\"POST\"]\n",
-				"request.path == \"/path1\"\nuser in [\"user3\",\"user4\"]\nrequest.method == \"GET\"\n" + `count({"role1","role2"}&roles) != 0` + "\n",
-				"request.path == \"/path1\"\nuser in [\"user3\",\"user4\"]\nrequest.method == \"POST\"\n" + `count({"role3","role4"}&roles) != 0` + "\n",
+			want: []string{"path == \"/path1\"\nuser in [\"user1\", \"user2\"]\nnot method in [\"GET\", \"POST\"]\n",
+				"path == \"/path1\"\nuser in [\"user1\", \"user2\"]\nmethod == \"GET\"\n" + `count({"role1", "role2"} & roles) != 0` + "\n",
+				"path == \"/path1\"\nuser in [\"user1\", \"user2\"]\nmethod == \"POST\"\n" + `count({"role3", "role4"} & roles) != 0` + "\n",
+				"path == \"/path1\"\nuser in [\"user3\", \"user4\"]\nnot method in [\"GET\", \"POST\"]\n",
+				"path == \"/path1\"\nuser in [\"user3\", \"user4\"]\nmethod == \"GET\"\n" + `count({"role1", "role2"} & roles) != 0` + "\n",
+				"path == \"/path1\"\nuser in [\"user3\", \"user4\"]\nmethod == \"POST\"\n" + `count({"role3", "role4"} & roles) != 0` + "\n",
 			},
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got := test.pol.ToRego()
-			for i, g := range got {
-				if g != test.want[i] {
+			bodies, err := test.pol.ToRego(policy.NewHelpers())
+			if err != nil {
+				t.Fatalf("ToRego() error = %v", err)
+			}
+			if len(bodies) != len(test.want) {
+				t.Fatalf("got %d policies, want %d", len(bodies), len(test.want))
+			}
+			for i, body := range bodies {
+				if g := formatExprs(t, body); g != test.want[i] {
 					t.Errorf("policy %d:got %q, want %q", i, g, test.want[i])
 				}
 			}
@@ -423,7 +452,7 @@ func TestPathMethodPolicies(t *testing.T) {
 				Method: "GET",
 				Path:   "/path1",
 			},
-			want: []string{"request.method == \"GET\"\nuser in [\"user1\",\"user2\"]\n"},
+			want: []string{"method == \"GET\"\nuser in [\"user1\", \"user2\"]\n"},
 		},
 		{
 			name: "two clauses",
@@ -449,19 +478,302 @@ func TestPathMethodPolicies(t *testing.T) {
 				Method: "POST",
 				Path:   "/path1",
 			},
-			want: []string{"request.method == \"POST\"\nuser in [\"user1\",\"user2\"]\n",
-				"request.method == \"POST\"\nuser in [\"user3\",\"user4\"]\n"},
+			want: []string{"method == \"POST\"\nuser in [\"user1\", \"user2\"]\n",
+				"method == \"POST\"\nuser in [\"user3\", \"user4\"]\n"},
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			got := test.pol.ToRego()
-			for i, g := range got {
-				if g != test.want[i] {
+			bodies, err := test.pol.ToRego(policy.NewHelpers())
+			if err != nil {
+				t.Fatalf("ToRego() error = %v", err)
+			}
+			if len(bodies) != len(test.want) {
+				t.Fatalf("got %d policies, want %d", len(bodies), len(test.want))
+			}
+			for i, body := range bodies {
+				if g := formatExprs(t, body); g != test.want[i] {
 					t.Errorf("got %q, want %q", g, test.want[i])
 				}
 			}
 		})
 	}
 }
+
+func TestPathCondition(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{
+			name: "exact path",
+			path: "/path1",
+			want: "path == \"/path1\"\n",
+		},
+		{
+			name: "one parameter",
+			path: "/drug_exposure/{drug_exposure_id}",
+			want: "glob.match(\"/drug_exposure/?*\", [\"/\"], path)\npath_params := {\"drug_exposure_id\": split(path, \"/\")[2]}\n",
+		},
+		{
+			name: "two parameters",
+			path: "/basic-auth/{user}/{passwd}",
+			want: "glob.match(\"/basic-auth/?*/?*\", [\"/\"], path)\npath_params := {\"passwd\": split(path, \"/\")[3], \"user\": split(path, \"/\")[2]}\n",
+		},
+		{
+			name: "parameter inside a segment",
+			path: "/files/{name}.json",
+			want: "glob.match(\"/files/?*.json\", [\"/\"], path)\n",
+		},
+		{
+			name: "glob special characters",
+			path: "/search*/{term}",
+			want: "glob.match(\"/search\\\\*/?*\", [\"/\"], path)\npath_params := {\"term\": split(path, \"/\")[2]}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := formatExprs(t, policy.PathCondition(test.path))
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDenyPolicies(t *testing.T) {
+	tests := []generalTestCase{
+		{
+			name: "general deny",
+			pol: &policy.GeneralPolicies{
+				Policies: []policy.PolicyClause{
+					{
+						RolePolicy: &policy.RolePolicy{
+							PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"role1"}},
+						},
+					},
+				},
+				Deny: []policy.PolicyClause{
+					{
+						UserPolicy: &policy.UserPolicy{
+							PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"user1"}},
+						},
+					},
+				},
+			},
+			want: "allow_request if count({\"role1\"} & roles) != 0\n\ndeny if user in [\"user1\"]\n",
+		},
+		{
+			name: "unconditional method deny",
+			pol: &policy.GeneralPolicies{
+				SpecializedPaths: map[string]policy.PathPolicies{
+					"/admin": {
+						Path: "/admin",
+						SpecializedMethods: map[string]policy.PathMethodPolicies{
+							"delete": {
+								Method: "delete",
+								Deny:   []policy.PolicyClause{{}},
+							},
+						},
+					},
+				},
+			},
+			want: "deny if {\n\tpath == \"/admin\"\n\tmethod == \"delete\"\n}\n",
+		},
+		{
+			name: "path with only deny keeps general policies",
+			pol: &policy.GeneralPolicies{
+				Policies: []policy.PolicyClause{
+					{
+						UserPolicy: &policy.UserPolicy{
+							PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"user1", "user2"}},
+						},
+					},
+				},
+				SpecializedPaths: map[string]policy.PathPolicies{
+					"/path1": {
+						Path: "/path1",
+						Deny: []policy.PolicyClause{
+							{
+								UserPolicy: &policy.UserPolicy{
+									PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"user2"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			want: "allow_request if user in [\"user1\", \"user2\"]\n\ndeny if {\n\tpath == \"/path1\"\n\tuser in [\"user2\"]\n}\n",
+		},
+		{
+			name: "templated path deny skips exact siblings",
+			pol: &policy.GeneralPolicies{
+				SpecializedPaths: map[string]policy.PathPolicies{
+					"/items/{id}": {
+						Path: "/items/{id}",
+						Deny: []policy.PolicyClause{{}},
+					},
+					"/items/export": {
+						Path: "/items/export",
+						Policies: []policy.PolicyClause{
+							{
+								UserPolicy: &policy.UserPolicy{
+									PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"user1"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			want: "allow_request if {\n\tpath == \"/items/export\"\n\tuser in [\"user1\"]\n}\n\ndeny if {\n\tglob.match(\"/items/?*\", [\"/\"], path)\n\tpath_params := {\"id\": split(path, \"/\")[2]}\n\tnot path in [\"/items/export\"]\n}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.pol.ToRego()
+			if err != nil {
+				t.Fatalf("ToRego() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNestedClauses(t *testing.T) {
+	roleA := policy.PolicyClause{
+		RolePolicy: &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"A"}}},
+		UserPolicy: &policy.UserPolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"user1", "user2"}}},
+	}
+	roleB := policy.PolicyClause{
+		RolePolicy:            &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"B"}}},
+		StorageLocationPolicy: &policy.StorageLocationPolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"Europe"}}},
+	}
+	tests := []generalTestCase{
+		{
+			name: "any of",
+			pol: &policy.GeneralPolicies{
+				Policies: []policy.PolicyClause{{AnyOf: []policy.PolicyClause{roleA, roleB}}},
+			},
+			want: "allow_request if any_of_1\n\n" +
+				"any_of_1 if {\n\tuser in [\"user1\", \"user2\"]\n\tcount({\"A\"} & roles) != 0\n}\n\n" +
+				"any_of_1 if {\n\tcount({\"B\"} & roles) != 0\n\tcount({\"Europe\"} & location_regions) != 0\n}\n",
+		},
+		{
+			name: "all of and not",
+			pol: &policy.GeneralPolicies{
+				Policies: []policy.PolicyClause{{AllOf: []policy.PolicyClause{roleB}, Not: &policy.PolicyClause{UserPolicy: roleA.UserPolicy}}},
+			},
+			want: "allow_request if {\n\tcount({\"B\"} & roles) != 0\n\tcount({\"Europe\"} & location_regions) != 0\n\tnot clause_1\n}\n\n" +
+				"clause_1 if user in [\"user1\", \"user2\"]\n",
+		},
+		{
+			name: "shared helper",
+			pol: &policy.GeneralPolicies{
+				Policies: []policy.PolicyClause{{AnyOf: []policy.PolicyClause{roleA, roleB}}},
+				Deny:     []policy.PolicyClause{{Not: &policy.PolicyClause{AnyOf: []policy.PolicyClause{roleA, roleB}}}},
+			},
+			want: "allow_request if any_of_1\n\n" +
+				"deny if not clause_1\n\n" +
+				"any_of_1 if {\n\tuser in [\"user1\", \"user2\"]\n\tcount({\"A\"} & roles) != 0\n}\n\n" +
+				"any_of_1 if {\n\tcount({\"B\"} & roles) != 0\n\tcount({\"Europe\"} & location_regions) != 0\n}\n\n" +
+				"clause_1 if any_of_1\n",
+		},
+		{
+			name: "path parameters",
+			pol: &policy.GeneralPolicies{
+				SpecializedPaths: map[string]policy.PathPolicies{
+					"/items/{owner}": {
+						Path: "/items/{owner}",
+						Policies: []policy.PolicyClause{
+							{AnyOf: []policy.PolicyClause{roleB, {PathParamsPolicy: &policy.PathParamsPolicy{Value: map[string]string{"owner": "preferred_username"}}}}},
+						},
+					},
+				},
+			},
+			want: "allow_request if {\n\tglob.match(\"/items/?*\", [\"/\"], path)\n\tpath_params := {\"owner\": split(path, \"/\")[2]}\n\tany_of_1(path_params)\n}\n\n" +
+				"any_of_1(path_params) if {\n\tcount({\"B\"} & roles) != 0\n\tcount({\"Europe\"} & location_regions) != 0\n}\n\n" +
+				"any_of_1(path_params) if path_params.owner == token.payload.preferred_username\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.pol.ToRego()
+			if err != nil {
+				t.Fatalf("ToRego() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPolicyDefinitions(t *testing.T) {
+	definitions := map[string]policy.PolicyClause{
+		"management": {
+			RolePolicy: &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"admin", "top_management"}}},
+		},
+		"logistics": {
+			AnyOf: []policy.PolicyClause{
+				{Use: "management"},
+				{RolePolicy: &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"logistic_user"}}}},
+			},
+		},
+		"sales-team": {
+			RolePolicy: &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"sales_user"}}},
+		},
+	}
+	tests := []generalTestCase{
+		{
+			name: "use and ref",
+			pol: &policy.GeneralPolicies{
+				Definitions: definitions,
+				SpecializedPaths: map[string]policy.PathPolicies{
+					"/invoices": {Path: "/invoices", Policies: []policy.PolicyClause{{Use: "management"}}},
+					"/orders":   {Path: "/orders", Policies: []policy.PolicyClause{{Ref: policy.DefinitionsRefPrefix + "logistics"}, {Use: "sales-team"}}},
+				},
+			},
+			want: "allow_request if {\n\tpath == \"/invoices\"\n\tpolicy_management\n}\n\n" +
+				"allow_request if {\n\tpath == \"/orders\"\n\tpolicy_logistics\n}\n\n" +
+				"allow_request if {\n\tpath == \"/orders\"\n\tpolicy_sales_team\n}\n\n" +
+				"policy_management if count({\"admin\", \"top_management\"} & roles) != 0\n\n" +
+				"any_of_1 if policy_management\n\n" +
+				"any_of_1 if count({\"logistic_user\"} & roles) != 0\n\n" +
+				"policy_logistics if any_of_1\n\n" +
+				"policy_sales_team if count({\"sales_user\"} & roles) != 0\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.pol.ToRego()
+			if err != nil {
+				t.Fatalf("ToRego() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	for _, clause := range []policy.PolicyClause{{Use: "missing"}, {Ref: "#/components/schemas/Order"}} {
+		pol := &policy.GeneralPolicies{Definitions: definitions, Policies: []policy.PolicyClause{clause}}
+		if _, err := pol.ToRego(); err == nil {
+			t.Errorf("ToRego() expected an error for %v", clause)
+		}
+	}
+
+	colliding := maps.Clone(definitions)
+	colliding["sales_team"] = policy.PolicyClause{UserPolicy: &policy.UserPolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"bob"}}}}
+	pol := &policy.GeneralPolicies{Definitions: colliding, Policies: []policy.PolicyClause{{Use: "sales-team"}, {Use: "sales_team"}}}
+	if _, err := pol.ToRego(); err == nil || !strings.Contains(err.Error(), "policy_sales_team") {
+		t.Errorf("ToRego() expected an error for colliding definitions, got %v", err)
+	}
+}
@@ -1,10 +1,21 @@
 package policy
 
 import (
-	"encoding/json"
+	"fmt"
 	"maps"
+	"regexp"
 	"slices"
 	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/format"
+)
+
+const (
+	// AllowRuleName is the name of the rules generated for the access policies.
+	AllowRuleName = "allow_request"
+	// DenyRuleName is the name of the rules generated for the deny policies, which override the access policies.
+	DenyRuleName = "deny"
 )
 
 // Represent a policy clauses, which can contains at most one of each type of policy
@@ -14,157 +25,635 @@ type PolicyClause struct {
 	StorageLocationPolicy *StorageLocationPolicy `yaml:"storage_location"`
 	CallPolicy            *CallPolicy            `yaml:"call"`
 	TimelinessPolicy      *TimelinessPolicy      `yaml:"timeliness"`
+	PathParamsPolicy      *PathParamsPolicy      `yaml:"path_params"`
+	ClaimsPolicy          *ClaimsPolicy          `yaml:"claims"`
+	// Nested clauses, which must all be satisfied
+	AllOf []PolicyClause `yaml:"all_of"`
+	// Nested clauses, at least one of which must be satisfied
+	AnyOf []PolicyClause `yaml:"any_of"`
+	// Nested clause, which must not be satisfied
+	Not *PolicyClause `yaml:"not"`
+	// Name of a policy definition that must be satisfied
+	Use string `yaml:"use"`
+	// JSON pointer to a policy definition that must be satisfied, e.g. #/components/x-teadal-policy-definitions/management
+	Ref string `yaml:"$ref"`
+}
+
+// DefinitionsRefPrefix is the JSON pointer prefix of the references to policy definitions.
+const DefinitionsRefPrefix = "#/components/x-teadal-policy-definitions/"
+
+// DefinitionName returns the name of the policy definition the clause refers to with use or $ref, empty if none.
+func (p *PolicyClause) DefinitionName() (string, error) {
+	if p.Ref == "" {
+		return p.Use, nil
+	}
+	if !strings.HasPrefix(p.Ref, DefinitionsRefPrefix) || strings.Contains(p.Ref[len(DefinitionsRefPrefix):], "/") {
+		return "", fmt.Errorf("invalid policy definition reference %q, expected %s<name>", p.Ref, DefinitionsRefPrefix)
+	}
+	// Unescape the JSON pointer token
+	name := strings.NewReplacer("~1", "/", "~0", "~").Replace(p.Ref[len(DefinitionsRefPrefix):])
+	if p.Use != "" && p.Use != name {
+		return "", fmt.Errorf("clause refers to both policy definitions %q and %q", p.Use, name)
+	}
+	return name, nil
 }
 
-func (p *PolicyClause) ToRego() string {
-	var result string
+// policies returns the policies set in the clause, in the order they are added to the rule body.
+func (p *PolicyClause) policies() []Policy {
+	policies := make([]Policy, 0, 7)
 	if p.UserPolicy != nil {
-		result += p.UserPolicy.ToRego()
+		policies = append(policies, p.UserPolicy)
 	}
 	if p.RolePolicy != nil {
-		result += p.RolePolicy.ToRego()
+		policies = append(policies, p.RolePolicy)
 	}
 	if p.StorageLocationPolicy != nil {
-		result += p.StorageLocationPolicy.ToRego()
+		policies = append(policies, p.StorageLocationPolicy)
 	}
 	if p.CallPolicy != nil {
-		result += p.CallPolicy.ToRego()
+		policies = append(policies, p.CallPolicy)
 	}
 	if p.TimelinessPolicy != nil {
-		result += p.TimelinessPolicy.ToRego()
+		policies = append(policies, p.TimelinessPolicy)
+	}
+	if p.PathParamsPolicy != nil {
+		policies = append(policies, p.PathParamsPolicy)
 	}
-	return result
+	if p.ClaimsPolicy != nil {
+		policies = append(policies, p.ClaimsPolicy)
+	}
+	return policies
+}
+
+// check is a condition of a clause, with the expressions that must all hold and their description.
+type check struct {
+	exprs       []*ast.Expr
+	description string
+}
+
+// ToRego converts the clause to the conjunction of the expressions of its policies and nested clauses.
+// The all_of clauses are added to the same expressions, while the any_of and not clauses are added to helpers as
+// helper rules and checked by name.
+func (p *PolicyClause) ToRego(helpers *Helpers) ([]*ast.Expr, error) {
+	checks, err := p.checks(helpers)
+	if err != nil {
+		return nil, err
+	}
+	exprs := make([]*ast.Expr, 0)
+	for _, check := range checks {
+		exprs = append(exprs, check.exprs...)
+	}
+	return exprs, nil
+}
+
+// checks returns the checks of the clause in the order their expressions are added to the rule body: one for each
+// policy, for the definition used, for each check of the all_of clauses and one for the any_of and not clauses.
+func (p *PolicyClause) checks(helpers *Helpers) ([]check, error) {
+	checks := make([]check, 0)
+	for _, policy := range p.policies() {
+		policyExprs, err := policy.ToRego()
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, check{exprs: policyExprs, description: policy.Describe()})
+	}
+	name, err := p.DefinitionName()
+	if err != nil {
+		return nil, err
+	}
+	if name != "" {
+		expr, err := helpers.Use(name)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, check{exprs: []*ast.Expr{expr}, description: "policy " + name})
+	}
+	for i, clause := range p.AllOf {
+		clauseChecks, err := clause.checks(helpers)
+		if err != nil {
+			return nil, fmt.Errorf("all_of %d: %v", i, err)
+		}
+		checks = append(checks, clauseChecks...)
+	}
+	if len(p.AnyOf) > 0 {
+		bodies := make([]ast.Body, 0, len(p.AnyOf))
+		usesPathParams := false
+		for i, clause := range p.AnyOf {
+			clauseExprs, err := clause.ToRego(helpers)
+			if err != nil {
+				return nil, fmt.Errorf("any_of %d: %v", i, err)
+			}
+			bodies = append(bodies, NewBody(clauseExprs))
+			usesPathParams = usesPathParams || helpers.usesPathParams(&clause)
+		}
+		expr := helpers.Add("any_of", bodies, usesPathParams)
+		checks = append(checks, check{exprs: []*ast.Expr{expr}, description: describeAnyOf(p.AnyOf)})
+	}
+	if p.Not != nil {
+		clauseExprs, err := p.Not.ToRego(helpers)
+		if err != nil {
+			return nil, fmt.Errorf("not: %v", err)
+		}
+		expr := helpers.Add("clause", []ast.Body{NewBody(clauseExprs)}, helpers.usesPathParams(p.Not)).Complement()
+		checks = append(checks, check{exprs: []*ast.Expr{expr}, description: "not (" + p.Not.Describe() + ")"})
+	}
+	return checks, nil
+}
+
+// Describe returns a human readable description of the conditions of the clause, e.g. role doctors and user alice.
+// An empty clause is described as any request.
+func (p *PolicyClause) Describe() string {
+	descriptions := make([]string, 0)
+	for _, policy := range p.policies() {
+		descriptions = append(descriptions, policy.Describe())
+	}
+	if name, err := p.DefinitionName(); err == nil && name != "" {
+		descriptions = append(descriptions, "policy "+name)
+	}
+	for _, clause := range p.AllOf {
+		if description := clause.Describe(); description != "any request" {
+			descriptions = append(descriptions, description)
+		}
+	}
+	if len(p.AnyOf) > 0 {
+		descriptions = append(descriptions, describeAnyOf(p.AnyOf))
+	}
+	if p.Not != nil {
+		descriptions = append(descriptions, "not ("+p.Not.Describe()+")")
+	}
+	if len(descriptions) == 0 {
+		return "any request"
+	}
+	return strings.Join(descriptions, " and ")
+}
+
+// describeAnyOf returns the description of the alternatives of an any_of clause, e.g. any of (role A) or (role B).
+func describeAnyOf(clauses []PolicyClause) string {
+	alternatives := make([]string, 0, len(clauses))
+	for _, clause := range clauses {
+		alternatives = append(alternatives, "("+clause.Describe()+")")
+	}
+	return "any of " + strings.Join(alternatives, " or ")
 }
 
 // GeneralPolicies represents a collection of policy clauses that should applied to all paths and endpoints
 // It applies the policies to all endpoints, but it can be extended (AND) with specialized policies for specific paths
+// Deny clauses are applied to all endpoints regardless of the specialized paths, and override any allowing clause
+// Definitions are named clauses that any clause can refer to, generated as named helper rules
+// Scopes are the OAuth2 scopes required by the operations, checked in addition (AND) to the policies
 type GeneralPolicies struct {
 	Policies         []PolicyClause
+	Deny             []PolicyClause
 	SpecializedPaths map[string]PathPolicies
+	Definitions      map[string]PolicyClause
+	Scopes           []ScopeRequirement
 }
 
 func NewGeneralPolicies() *GeneralPolicies {
 	return &GeneralPolicies{
 		Policies:         make([]PolicyClause, 0),
+		Deny:             make([]PolicyClause, 0),
 		SpecializedPaths: make(map[string]PathPolicies),
+		Definitions:      make(map[string]PolicyClause),
+	}
+}
+
+// Rules converts the policies to allow_request rules, one for each combination of general, path and method clauses,
+// followed by the deny rules, one for each deny clause, by the scope rules of the operations and by the helper rules
+// of the nested clauses.
+func (p *GeneralPolicies) Rules() ([]*ast.Rule, error) {
+	helpers := NewHelpers()
+	helpers.definitions = p.Definitions
+	rules, err := p.policyRules(helpers)
+	if err != nil {
+		return nil, err
+	}
+	return append(rules, helpers.Rules()...), nil
+}
+
+// policyRules returns the allow_request, deny and scope rules, adding the helper rules they use to helpers.
+func (p *GeneralPolicies) policyRules(helpers *Helpers) ([]*ast.Rule, error) {
+	rules, err := p.allowRules(helpers)
+	if err != nil {
+		return nil, err
+	}
+	denyBodies, err := p.denyRules(helpers)
+	if err != nil {
+		return nil, err
 	}
+	for _, body := range denyBodies {
+		rules = append(rules, NewRule(DenyRuleName, body))
+	}
+	scopePaths := make([]string, 0, len(p.Scopes))
+	for _, requirement := range p.Scopes {
+		scopePaths = append(scopePaths, requirement.Path)
+	}
+	for _, requirement := range p.Scopes {
+		requirement.siblings = exactSiblings(requirement.Path, scopePaths)
+		rules = append(rules, requirement.Rules()...)
+	}
+	return rules, nil
 }
 
-func (p *GeneralPolicies) ToRego() string {
-	// Handle excludedPaths
-	rules := make([]string, 0, len(p.Policies)+len(p.SpecializedPaths))
+func (p *GeneralPolicies) allowRules(helpers *Helpers) ([]*ast.Rule, error) {
+	bodies := make([]ast.Body, 0, len(p.Policies)+len(p.SpecializedPaths))
 	if len(p.Policies) > 0 {
-		rules = append(rules, p.buildGeneralRules()...)
+		generalBodies, err := p.buildGeneralRules(helpers)
+		if err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, generalBodies...)
 	}
 	if len(p.SpecializedPaths) > 0 {
-		rules = append(rules, p.buildPathsRules()...)
+		pathBodies, err := p.buildPathsRules(helpers)
+		if err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, pathBodies...)
 	}
-	for i, rule := range rules {
-		rules[i] = "allow_request if {\n" + rule + "}\n"
+	rules := make([]*ast.Rule, 0, len(bodies))
+	for _, body := range bodies {
+		rules = append(rules, NewRule(AllowRuleName, body))
 	}
-	// Return
-	return strings.Join(rules, "\n")
+	return rules, nil
 }
 
-func (p *GeneralPolicies) buildGeneralRules() []string {
-	rules := make([]string, 0, len(p.Policies))
-	excludedPaths := slices.Collect(maps.Keys(p.SpecializedPaths))
-	excludedPathsJson, err := json.Marshal(excludedPaths)
+// ToRego converts the policies to the formatted Rego source of their rules.
+func (p *GeneralPolicies) ToRego() (string, error) {
+	rules, err := p.Rules()
 	if err != nil {
-		panic(err)
+		return "", err
+	}
+	return FormatRules(rules)
+}
+
+func (p *GeneralPolicies) buildGeneralRules(helpers *Helpers) ([]ast.Body, error) {
+	// Exact paths are excluded with a single membership check, templated paths need their own pattern check
+	excludedPaths := make([]string, 0, len(p.SpecializedPaths))
+	exclusions := make([]*ast.Expr, 0)
+	for _, path := range slices.Sorted(maps.Keys(p.SpecializedPaths)) {
+		pathPolicies := p.SpecializedPaths[path]
+		if !pathPolicies.hasAccessPolicies() {
+			// Paths with only deny clauses keep the general access policies
+			continue
+		}
+		if IsTemplatedPath(path) {
+			exclusions = append(exclusions, pathGlobMatch(path).Complement())
+		} else {
+			excludedPaths = append(excludedPaths, path)
+		}
+	}
+	if len(excludedPaths) > 0 {
+		exclusions = append([]*ast.Expr{ast.Member.Expr(ast.VarTerm("path"), stringArrayTerm(excludedPaths)).Complement()}, exclusions...)
 	}
-	for _, policy := range p.Policies {
-		rule := policy.ToRego()
-		if len(excludedPaths) > 0 {
-			rule += "not path in " + string(excludedPathsJson) + "\n"
+	bodies := make([]ast.Body, 0, len(p.Policies))
+	for i, policy := range p.Policies {
+		exprs, err := policy.ToRego(helpers)
+		if err != nil {
+			return nil, fmt.Errorf("general clause %d: %v", i, err)
 		}
-		rules = append(rules, rule)
+		bodies = append(bodies, NewBody(exprs, exclusions))
 	}
-	return rules
+	return bodies, nil
 }
 
-func (p *GeneralPolicies) buildPathsRules() []string {
-	pathRules := make([]string, 0, len(p.SpecializedPaths))
-	for _, path := range p.SpecializedPaths {
-		pathRules = append(pathRules, path.ToRego()...)
+// accessPaths returns the paths with access clauses. Exact paths among them take precedence over the templated paths
+// matching them, whose access, deny and reason rules exclude them.
+func (p *GeneralPolicies) accessPaths() []string {
+	accessPaths := make([]string, 0, len(p.SpecializedPaths))
+	for path, pathPolicies := range p.SpecializedPaths {
+		if pathPolicies.hasAccessPolicies() {
+			accessPaths = append(accessPaths, path)
+		}
+	}
+	return accessPaths
+}
+
+func (p *GeneralPolicies) buildPathsRules(helpers *Helpers) ([]ast.Body, error) {
+	accessPaths := p.accessPaths()
+	pathBodies := make([]ast.Body, 0, len(p.SpecializedPaths))
+	for _, key := range slices.Sorted(maps.Keys(p.SpecializedPaths)) {
+		path := p.SpecializedPaths[key]
+		path.siblings = exactSiblings(path.Path, accessPaths)
+		bodies, err := path.ToRego(helpers)
+		if err != nil {
+			return nil, err
+		}
+		pathBodies = append(pathBodies, bodies...)
 	}
 	// No general policies, return only specialized ones
 	if len(p.Policies) == 0 {
-		return pathRules
+		return pathBodies, nil
 	}
 	// Add general policies to specialized ones
-	rules := make([]string, 0, len(p.Policies)*len(pathRules))
-	for _, policy := range p.Policies {
-		rule := policy.ToRego()
-		for _, pathRule := range pathRules {
-			rules = append(rules, rule+pathRule)
+	bodies := make([]ast.Body, 0, len(p.Policies)*len(pathBodies))
+	for i, policy := range p.Policies {
+		exprs, err := policy.ToRego(helpers)
+		if err != nil {
+			return nil, fmt.Errorf("general clause %d: %v", i, err)
+		}
+		for _, pathBody := range pathBodies {
+			bodies = append(bodies, NewBody(exprs, pathBody))
 		}
 	}
-	return rules
+	return bodies, nil
+}
+
+func (p *GeneralPolicies) denyRules(helpers *Helpers) ([]ast.Body, error) {
+	bodies, err := denyBodies(p.Deny, helpers)
+	if err != nil {
+		return nil, fmt.Errorf("general deny: %v", err)
+	}
+	accessPaths := p.accessPaths()
+	for _, key := range slices.Sorted(maps.Keys(p.SpecializedPaths)) {
+		path := p.SpecializedPaths[key]
+		path.siblings = exactSiblings(path.Path, accessPaths)
+		pathBodies, err := path.DenyRego(helpers)
+		if err != nil {
+			return nil, err
+		}
+		bodies = append(bodies, pathBodies...)
+	}
+	return bodies, nil
 }
 
 // PathPolicies represents a collection of policy clauses that should applied to a specific path.
 type PathPolicies struct {
 	Policies           []PolicyClause
+	Deny               []PolicyClause
 	Path               string
 	SpecializedMethods map[string]PathMethodPolicies
+	// siblings holds the exact paths matched by the templated path, which are excluded from its access, deny and reason rules
+	siblings []string
 }
 
-func (p *PathPolicies) ToRego() []string {
-	if len(p.Policies) == 0 && len(p.SpecializedMethods) == 0 {
-		return []string{}
+// hasAccessPolicies reports whether the path or any of its methods has access clauses, which replace the general ones.
+func (p *PathPolicies) hasAccessPolicies() bool {
+	return len(p.Policies) > 0 || len(p.accessMethods()) > 0
+}
+
+// accessMethods returns the sorted methods of the path with access clauses.
+func (p *PathPolicies) accessMethods() []string {
+	methods := make([]string, 0, len(p.SpecializedMethods))
+	for _, method := range slices.Sorted(maps.Keys(p.SpecializedMethods)) {
+		if len(p.SpecializedMethods[method].Policies) > 0 {
+			methods = append(methods, method)
+		}
 	}
-	pathJson, err := json.Marshal(p.Path)
-	if err != nil {
-		panic(err)
+	return methods
+}
+
+// ToRego converts the path policies to rule bodies. Each body starts with the path condition, followed by the
+// path clause and, for the specialized methods, by the method clause. Requests with a method that is not specialized
+// are checked against the path clauses alone. A path with only specialized methods allows just those methods.
+// Requests to the exact sibling paths of a templated path are left to the rules of those paths.
+func (p *PathPolicies) ToRego(helpers *Helpers) ([]ast.Body, error) {
+	if !p.hasAccessPolicies() {
+		return []ast.Body{}, nil
 	}
-	specializedMethods := slices.Collect(maps.Keys(p.SpecializedMethods))
-	specializedMethodsJson, err := json.Marshal(specializedMethods)
-	if err != nil {
-		panic(err)
+	pathCode := append(PathCondition(p.Path), pathExclusion(p.siblings)...)
+	specializedMethods := p.accessMethods()
+	methodBodies := make([]ast.Body, 0, len(specializedMethods))
+	for _, method := range specializedMethods {
+		methodPolicies := p.SpecializedMethods[method]
+		bodies, err := methodPolicies.ToRego(helpers)
+		if err != nil {
+			return nil, fmt.Errorf("path %s: %v", p.Path, err)
+		}
+		methodBodies = append(methodBodies, bodies...)
 	}
-	blocks := make([]string, 0, len(p.Policies)+len(p.SpecializedMethods))
-	for _, policy := range p.Policies {
+
+	if len(p.Policies) == 0 {
+		blocks := make([]ast.Body, 0, len(methodBodies))
+		for _, methodBody := range methodBodies {
+			blocks = append(blocks, NewBody(pathCode, methodBody))
+		}
+		return blocks, nil
+	}
+
+	blocks := make([]ast.Body, 0, len(p.Policies)*(len(methodBodies)+1))
+	for i, policy := range p.Policies {
+		exprs, err := policy.ToRego(helpers)
+		if err != nil {
+			return nil, fmt.Errorf("path %s: clause %d: %v", p.Path, i, err)
+		}
 		// Add general path rules
-		policyCode := "path == " + string(pathJson) + "\n"
-		policyCode += policy.ToRego()
+		var methodExclusion []*ast.Expr
 		if len(specializedMethods) > 0 {
-			policyCode += "not method in " + string(specializedMethodsJson) + "\n"
+			methodExclusion = []*ast.Expr{ast.Member.Expr(ast.VarTerm("method"), stringArrayTerm(specializedMethods)).Complement()}
 		}
-		blocks = append(blocks, policyCode)
+		blocks = append(blocks, NewBody(pathCode, exprs, methodExclusion))
 
 		// Add specialized methods rules
-		for _, method := range p.SpecializedMethods {
-			policyCode := "path == " + string(pathJson) + "\n"
-			policyCode += policy.ToRego()
-			for _, methodPolicy := range method.ToRego() {
-				blocks = append(blocks, policyCode+methodPolicy)
-			}
+		for _, methodBody := range methodBodies {
+			blocks = append(blocks, NewBody(pathCode, exprs, methodBody))
+		}
+	}
+	return blocks, nil
+}
+
+// DenyRego converts the deny clauses of the path and of its methods to rule bodies, each starting with the path condition.
+// As for the access rules, requests to the exact sibling paths of a templated path are left to the rules of those paths.
+func (p *PathPolicies) DenyRego(helpers *Helpers) ([]ast.Body, error) {
+	bodies, err := denyBodies(p.Deny, helpers)
+	if err != nil {
+		return nil, fmt.Errorf("path %s deny: %v", p.Path, err)
+	}
+	for _, method := range slices.Sorted(maps.Keys(p.SpecializedMethods)) {
+		methodPolicies := p.SpecializedMethods[method]
+		methodBodies, err := methodPolicies.DenyRego(helpers)
+		if err != nil {
+			return nil, fmt.Errorf("path %s: %v", p.Path, err)
+		}
+		bodies = append(bodies, methodBodies...)
+	}
+	pathCode := append(PathCondition(p.Path), pathExclusion(p.siblings)...)
+	for i, body := range bodies {
+		bodies[i] = NewBody(pathCode, body)
+	}
+	return bodies, nil
+}
+
+// IsTemplatedPath reports whether the OpenAPI path contains templated parameters, e.g. /drug_exposure/{drug_exposure_id}.
+func IsTemplatedPath(path string) bool {
+	return strings.Contains(path, "{")
+}
+
+// exactSiblings returns the sorted exact paths matched by the templated path, e.g. /items/admin for /items/{id}.
+// As in OpenAPI, a request to one of them resolves to the exact path rather than to the templated one.
+func exactSiblings(path string, paths []string) []string {
+	if !IsTemplatedPath(path) {
+		return nil
+	}
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, segment := range strings.SplitAfter(path, "}") {
+		literal, param, _ := strings.Cut(segment, "{")
+		pattern.WriteString(regexp.QuoteMeta(literal))
+		if param != "" {
+			pattern.WriteString("[^/]+")
+		}
+	}
+	pattern.WriteString("$")
+	matcher := regexp.MustCompile(pattern.String())
+	siblings := make([]string, 0)
+	for _, other := range paths {
+		if !IsTemplatedPath(other) && matcher.MatchString(other) && !slices.Contains(siblings, other) {
+			siblings = append(siblings, other)
 		}
+	}
+	slices.Sort(siblings)
+	return siblings
+}
+
+// pathExclusion returns the expression excluding the given exact paths, none if there are no paths.
+func pathExclusion(paths []string) []*ast.Expr {
+	if len(paths) == 0 {
+		return nil
+	}
+	return []*ast.Expr{ast.Member.Expr(ast.VarTerm("path"), stringArrayTerm(paths)).Complement()}
+}
+
+// PathParams returns the names of the parameters spanning a whole segment of the OpenAPI path, indexed by segment position
+// in the path split by "/". Only these parameters are bound to path_params by the generated rules.
+func PathParams(path string) map[int]string {
+	params := make(map[int]string)
+	for i, segment := range strings.Split(path, "/") {
+		if len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") && !strings.ContainsAny(segment[1:len(segment)-1], "{}") {
+			params[i] = segment[1 : len(segment)-1]
+		}
+	}
+	return params
+}
 
+// PathCondition returns the Rego expressions matching the request path against the OpenAPI path.
+// Exact paths are compared for equality. Templated paths are matched segment by segment with glob.match, where each
+// parameter matches a non empty string without "/", and the parameters spanning a whole segment are bound to the
+// path_params object so that the following expressions can refer to them, e.g. path_params.drug_exposure_id.
+func PathCondition(path string) []*ast.Expr {
+	if !IsTemplatedPath(path) {
+		return []*ast.Expr{ast.Equal.Expr(ast.VarTerm("path"), ast.StringTerm(path))}
 	}
-	return blocks
+	exprs := []*ast.Expr{pathGlobMatch(path)}
+	params := PathParams(path)
+	if len(params) > 0 {
+		bindings := make([][2]*ast.Term, 0, len(params))
+		for _, index := range slices.Sorted(maps.Keys(params)) {
+			segment := ast.RefTerm(ast.Split.Call(ast.VarTerm("path"), ast.StringTerm("/")), ast.IntNumberTerm(index))
+			bindings = append(bindings, ast.Item(ast.StringTerm(params[index]), segment))
+		}
+		exprs = append(exprs, ast.Assign.Expr(ast.VarTerm("path_params"), ast.ObjectTerm(bindings...)))
+	}
+	return exprs
+}
+
+// pathGlobMatch returns the glob.match call matching the request path against the templated OpenAPI path.
+func pathGlobMatch(path string) *ast.Expr {
+	var pattern strings.Builder
+	inParam := false
+	for _, c := range path {
+		switch {
+		case c == '{':
+			inParam = true
+			pattern.WriteString("?*")
+		case c == '}' && inParam:
+			inParam = false
+		case inParam:
+		case strings.ContainsRune(`*?[]{}\!`, c):
+			pattern.WriteRune('\\')
+			pattern.WriteRune(c)
+		default:
+			pattern.WriteRune(c)
+		}
+	}
+	return ast.GlobMatch.Expr(ast.StringTerm(pattern.String()), ast.ArrayTerm(ast.StringTerm("/")), ast.VarTerm("path"))
 }
 
 type PathMethodPolicies struct {
 	Policies []PolicyClause
+	Deny     []PolicyClause
 	Path     string
 	Method   string
 }
 
-func (p *PathMethodPolicies) ToRego() []string {
+// ToRego converts the method policies to rule bodies, each starting with the method condition.
+func (p *PathMethodPolicies) ToRego(helpers *Helpers) ([]ast.Body, error) {
 	if len(p.Policies) == 0 {
-		return []string{}
+		return []ast.Body{}, nil
+	}
+	methodCode := []*ast.Expr{ast.Equal.Expr(ast.VarTerm("method"), ast.StringTerm(p.Method))}
+	blocks := make([]ast.Body, 0, len(p.Policies))
+	for i, policy := range p.Policies {
+		exprs, err := policy.ToRego(helpers)
+		if err != nil {
+			return nil, fmt.Errorf("method %s: clause %d: %v", p.Method, i, err)
+		}
+		blocks = append(blocks, NewBody(methodCode, exprs))
 	}
-	methodJson, err := json.Marshal(p.Method)
+	return blocks, nil
+}
+
+// DenyRego converts the deny clauses of the method to rule bodies, each starting with the method condition.
+func (p *PathMethodPolicies) DenyRego(helpers *Helpers) ([]ast.Body, error) {
+	bodies, err := denyBodies(p.Deny, helpers)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("method %s deny: %v", p.Method, err)
+	}
+	methodCode := []*ast.Expr{ast.Equal.Expr(ast.VarTerm("method"), ast.StringTerm(p.Method))}
+	for i, body := range bodies {
+		bodies[i] = NewBody(methodCode, body)
+	}
+	return bodies, nil
+}
+
+// denyBodies converts each deny clause to a rule body. An empty clause denies unconditionally.
+func denyBodies(clauses []PolicyClause, helpers *Helpers) ([]ast.Body, error) {
+	bodies := make([]ast.Body, 0, len(clauses))
+	for i, clause := range clauses {
+		exprs, err := clause.ToRego(helpers)
+		if err != nil {
+			return nil, fmt.Errorf("clause %d: %v", i, err)
+		}
+		bodies = append(bodies, NewBody(exprs))
+	}
+	return bodies, nil
+}
+
+// NewBody returns a rule body with a copy of the given expressions, leaving out the ones that are always true.
+// An empty body is always true.
+func NewBody(exprs ...[]*ast.Expr) ast.Body {
+	body := ast.NewBody()
+	for _, group := range exprs {
+		for _, expr := range group {
+			if term, ok := expr.Terms.(*ast.Term); ok && !expr.Negated && term.Equal(ast.BooleanTerm(true)) {
+				continue
+			}
+			body.Append(expr.Copy())
+		}
+	}
+	if len(body) == 0 {
+		body.Append(ast.NewExpr(ast.BooleanTerm(true)))
 	}
-	blocks := make([]string, 0, len(p.Policies))
-	for _, policy := range p.Policies {
-		policyCode := "method == " + string(methodJson) + "\n"
-		policyCode += policy.ToRego()
-		blocks = append(blocks, policyCode)
+	return body
+}
+
+// NewRule returns a rule named name that is true when the body is satisfied.
+func NewRule(name string, body ast.Body) *ast.Rule {
+	return &ast.Rule{
+		Head: ast.NewHead(ast.Var(name), nil, ast.BooleanTerm(true)),
+		Body: body,
+	}
+}
+
+// FormatRules returns the canonical Rego source of the rules, separated by a blank line.
+func FormatRules(rules []*ast.Rule) (string, error) {
+	blocks := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		block, err := format.AstWithOpts(rule, format.Opts{RegoVersion: ast.RegoV1})
+		if err != nil {
+			return "", fmt.Errorf("failed to format rule %s: %v", rule.Head.Name, err)
+		}
+		blocks = append(blocks, strings.TrimRight(string(block), "\n")+"\n")
 	}
-	return blocks
+	return strings.Join(blocks, "\n"), nil
 }
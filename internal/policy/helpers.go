@@ -0,0 +1,145 @@
+package policy
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// Helpers collects the helper rules generated for nested clauses and policy definitions, so that the rules using
+// them stay readable. Equal helpers are generated once and shared by every rule using them.
+type Helpers struct {
+	rules []*ast.Rule
+	// names maps the key of each helper to its name
+	names map[string]string
+	// count holds the number of helpers generated for each kind, used to name them
+	count map[string]int
+	// definitions holds the named clauses that can be used by name
+	definitions map[string]PolicyClause
+	// defining holds the definitions being generated, to detect cycles
+	defining []string
+}
+
+func NewHelpers() *Helpers {
+	return &Helpers{
+		rules: make([]*ast.Rule, 0),
+		names: make(map[string]string),
+		count: make(map[string]int),
+	}
+}
+
+// Add adds a helper rule with one definition for each body, which is true if any of the bodies is satisfied,
+// and returns the expression checking it. The helper is named after its kind, e.g. any_of_1.
+// Helpers using path parameters are generated as functions of path_params, which is bound by the path condition of
+// the calling rule.
+func (h *Helpers) Add(kind string, bodies []ast.Body, usesPathParams bool) *ast.Expr {
+	keys := make([]string, len(bodies))
+	for i, body := range bodies {
+		keys[i] = body.String()
+	}
+	key := fmt.Sprintf("%s(%t):%s", kind, usesPathParams, strings.Join(keys, "|"))
+	name, ok := h.names[key]
+	if !ok {
+		h.count[kind]++
+		name = fmt.Sprintf("%s_%d", kind, h.count[kind])
+		h.names[key] = name
+		for _, body := range bodies {
+			rule := NewRule(name, body)
+			if usesPathParams {
+				rule.Head.Args = ast.Args{ast.VarTerm("path_params")}
+			}
+			h.rules = append(h.rules, rule)
+		}
+	}
+	if usesPathParams {
+		return ast.NewExpr(ast.CallTerm(ast.VarTerm(name), ast.VarTerm("path_params")))
+	}
+	return ast.NewExpr(ast.VarTerm(name))
+}
+
+// Use returns the expression checking the policy definition with the given name, adding its helper rule the first
+// time it is used. The rule is named after the definition with a policy_ prefix, e.g. policy_management.
+func (h *Helpers) Use(name string) (*ast.Expr, error) {
+	definition, ok := h.definitions[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined policy definition %q", name)
+	}
+	ruleName := DefinitionRuleName(name)
+	usesPathParams := h.usesPathParams(&definition)
+	key := "definition:" + name
+	if _, ok := h.names[key]; !ok {
+		if slices.Contains(h.defining, name) {
+			return nil, fmt.Errorf("policy definition %q refers to itself", name)
+		}
+		for other := range h.definitions {
+			if other != name && DefinitionRuleName(other) == ruleName {
+				return nil, fmt.Errorf("policy definitions %q and %q both generate rule %s", min(name, other), max(name, other), ruleName)
+			}
+		}
+		h.defining = append(h.defining, name)
+		exprs, err := definition.ToRego(h)
+		h.defining = h.defining[:len(h.defining)-1]
+		if err != nil {
+			return nil, fmt.Errorf("definition %s: %v", name, err)
+		}
+		h.names[key] = ruleName
+		rule := NewRule(ruleName, NewBody(exprs))
+		if usesPathParams {
+			rule.Head.Args = ast.Args{ast.VarTerm("path_params")}
+		}
+		h.rules = append(h.rules, rule)
+	}
+	if usesPathParams {
+		return ast.NewExpr(ast.CallTerm(ast.VarTerm(ruleName), ast.VarTerm("path_params"))), nil
+	}
+	return ast.NewExpr(ast.VarTerm(ruleName)), nil
+}
+
+// DefinitionRuleName returns the name of the helper rule of a policy definition.
+// Characters that are not valid in a Rego variable name are replaced by underscores, so different definitions, such as
+// sales-team and sales_team, can have the same rule name.
+func DefinitionRuleName(name string) string {
+	var ruleName strings.Builder
+	ruleName.WriteString("policy_")
+	for _, c := range name {
+		if c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			ruleName.WriteRune(c)
+		} else {
+			ruleName.WriteRune('_')
+		}
+	}
+	return ruleName.String()
+}
+
+// usesPathParams reports whether the clause, its nested clauses or the definitions they use refer to path parameters.
+func (h *Helpers) usesPathParams(clause *PolicyClause) bool {
+	if clause.PathParamsPolicy != nil {
+		return true
+	}
+	for _, nested := range slices.Concat(clause.AllOf, clause.AnyOf) {
+		if h.usesPathParams(&nested) {
+			return true
+		}
+	}
+	if clause.Not != nil && h.usesPathParams(clause.Not) {
+		return true
+	}
+	name, err := clause.DefinitionName()
+	if err != nil || name == "" || slices.Contains(h.defining, name) {
+		return false
+	}
+	definition, ok := h.definitions[name]
+	if !ok {
+		return false
+	}
+	h.defining = append(h.defining, name)
+	defer func() { h.defining = h.defining[:len(h.defining)-1] }()
+	return h.usesPathParams(&definition)
+}
+
+// Rules returns the helper rules in the order they were added.
+func (h *Helpers) Rules() []*ast.Rule {
+	return h.rules
+}
@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pb33f/libopenapi/index"
+	"gopkg.in/yaml.v3"
+)
+
+type Severity string
+
+const (
+	// SeverityError marks problems that make the spec invalid
+	SeverityError Severity = "error"
+	// SeverityWarning marks problems that do not prevent the generation, such as ignored keys
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a problem found in the spec, located by the JSON pointer of the offending node and, when known,
+// by its line and column in the source document.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	Pointer  string   `json:"pointer,omitempty"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+}
+
+// String formats the diagnostic as line:column: severity: pointer: message, omitting the parts that are not known.
+func (d Diagnostic) String() string {
+	var s strings.Builder
+	if d.Line > 0 {
+		s.WriteString(strconv.Itoa(d.Line) + ":" + strconv.Itoa(d.Column) + ": ")
+	}
+	s.WriteString(string(d.Severity) + ": ")
+	if d.Pointer != "" {
+		s.WriteString(d.Pointer + ": ")
+	}
+	s.WriteString(d.Message)
+	return s.String()
+}
+
+// Diagnostics collects every problem found while parsing a spec, so that they can be reported at once.
+// It is an error when it holds at least one diagnostic with error severity.
+type Diagnostics []Diagnostic
+
+// HasErrors reports whether any of the diagnostics is an error.
+func (d Diagnostics) HasErrors() bool {
+	for _, diagnostic := range d {
+		if diagnostic.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the diagnostics as an error if they hold any error, nil otherwise.
+func (d Diagnostics) Err() error {
+	if !d.HasErrors() {
+		return nil
+	}
+	return d
+}
+
+func (d Diagnostics) Error() string {
+	messages := make([]string, 0, len(d))
+	for _, diagnostic := range d {
+		if diagnostic.Severity == SeverityError {
+			messages = append(messages, diagnostic.String())
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// add appends a diagnostic located at node, which can be nil when the position in the source is not known.
+func (d *Diagnostics) add(severity Severity, node *yaml.Node, pointer string, format string, args ...interface{}) {
+	diagnostic := Diagnostic{Severity: severity, Message: fmt.Sprintf(format, args...), Pointer: pointer}
+	if node != nil {
+		diagnostic.Line = node.Line
+		diagnostic.Column = node.Column
+	}
+	*d = append(*d, diagnostic)
+}
+
+func (d *Diagnostics) errorf(node *yaml.Node, pointer string, format string, args ...interface{}) {
+	d.add(SeverityError, node, pointer, format, args...)
+}
+
+func (d *Diagnostics) warnf(node *yaml.Node, pointer string, format string, args ...interface{}) {
+	d.add(SeverityWarning, node, pointer, format, args...)
+}
+
+// addDocumentErrors reports the errors returned by libopenapi, located by the node they refer to when available.
+// Circular references are valid in OpenAPI and do not prevent building the model, so they are only warnings.
+func (d *Diagnostics) addDocumentErrors(errs []error) {
+	for _, err := range errs {
+		var resolvingErr *index.ResolvingError
+		if errors.As(err, &resolvingErr) {
+			severity := SeverityError
+			if resolvingErr.CircularReference != nil {
+				severity = SeverityWarning
+			}
+			d.add(severity, resolvingErr.Node, "", "%v", resolvingErr)
+			continue
+		}
+		d.errorf(nil, "", "%v", err)
+	}
+}
+
+// childNode returns the value of a mapping node by key, or the item of a sequence node by index.
+func childNode(node *yaml.Node, token string) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == token {
+				return node.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		i, err := strconv.Atoi(token)
+		if err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
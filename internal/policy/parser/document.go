@@ -0,0 +1,270 @@
+package parser
+
+import (
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pb33f/libopenapi"
+	"github.com/pb33f/libopenapi/datamodel"
+	"github.com/pb33f/libopenapi/datamodel/high/base"
+	v2 "github.com/pb33f/libopenapi/datamodel/high/v2"
+	v3 "github.com/pb33f/libopenapi/datamodel/high/v3"
+	"github.com/pb33f/libopenapi/orderedmap"
+	"gopkg.in/yaml.v3"
+)
+
+type extensions = *orderedmap.Map[string, *yaml.Node]
+
+// specDocument is the part of an OpenAPI document read by the parser, independent of the version of the spec.
+type specDocument struct {
+	// pathsExtensions holds the extensions of the paths object, where the general policies are declared
+	pathsExtensions extensions
+	paths           []specPath
+	// definitions holds the policy definitions extension, if any, located at definitionsPointer
+	definitions        *yaml.Node
+	definitionsPointer string
+	securitySchemes    []specSecurityScheme
+	// security holds the security requirements applied to the operations that do not declare their own
+	security []*base.SecurityRequirement
+	// securitySchemesPointer locates the security schemes, which are under components in OpenAPI 3 and under
+	// securityDefinitions in Swagger 2.0
+	securitySchemesPointer string
+	servers                []specServer
+}
+
+type specPath struct {
+	path       string
+	extensions extensions
+	operations []specOperation
+}
+
+type specOperation struct {
+	method     string
+	extensions extensions
+	// security holds the security requirements of the operation, nil if it uses the ones of the document
+	security []*base.SecurityRequirement
+}
+
+type specSecurityScheme struct {
+	name string
+	// kind is the type of the scheme, e.g. http, oauth2 or openIdConnect
+	kind string
+	// bearer reports whether the scheme sends a bearer token in the authorization header
+	bearer bool
+	// openIDConnectURL is the discovery URL of openIdConnect schemes
+	openIDConnectURL string
+	extensions       extensions
+}
+
+// getDocumentFromData builds the model of the spec according to its version, reporting the problems found by
+// libopenapi. It returns nil if the model cannot be built.
+func getDocumentFromData(specByteArray []byte, diagnostics *Diagnostics) (doc *specDocument) {
+	// libopenapi can panic on malformed documents, which must not crash the caller
+	defer func() {
+		if r := recover(); r != nil {
+			diagnostics.errorf(nil, "", "failed to parse OpenAPI spec: %v", r)
+			doc = nil
+		}
+	}()
+	// The problems are reported in the diagnostics, so the libopenapi logs are discarded
+	document, err := libopenapi.NewDocumentWithConfiguration(specByteArray, &datamodel.DocumentConfiguration{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		diagnostics.errorf(nil, "", "failed to parse OpenAPI spec: %v", err)
+		return nil
+	}
+	switch document.GetSpecInfo().SpecFormat {
+	case datamodel.OAS2:
+		if version := document.GetSpecInfo().Version; version != "2.0" {
+			diagnostics.errorf(nil, "/swagger", "unsupported Swagger version %q, expected 2.0", version)
+			return nil
+		}
+		docModel, errs := document.BuildV2Model()
+		diagnostics.addDocumentErrors(errs)
+		if docModel == nil {
+			return nil
+		}
+		return newSpecDocumentV2(&docModel.Model)
+	case datamodel.OAS3, datamodel.OAS31:
+		docModel, errs := document.BuildV3Model()
+		diagnostics.addDocumentErrors(errs)
+		if docModel == nil {
+			return nil
+		}
+		return newSpecDocumentV3(&docModel.Model, diagnostics)
+	default:
+		diagnostics.errorf(nil, "", "unsupported spec version, expected Swagger 2.0 or OpenAPI 3")
+		return nil
+	}
+}
+
+// newSpecDocumentV3 reads an OpenAPI 3.0 or 3.1 document. Path items referring to components are already resolved by
+// libopenapi, while webhooks are requests sent by the service rather than to it, so their policies are ignored.
+func newSpecDocumentV3(model *v3.Document, diagnostics *Diagnostics) *specDocument {
+	doc := &specDocument{
+		definitionsPointer:     JSONPointer("components", XTeadalPolicyDefinitionsKey),
+		securitySchemesPointer: JSONPointer("components", "securitySchemes"),
+		security:               model.Security,
+	}
+	if model.Paths != nil {
+		doc.pathsExtensions = model.Paths.Extensions
+		for path := model.Paths.PathItems.First(); path != nil; path = path.Next() {
+			doc.paths = append(doc.paths, newSpecPathV3(path.Key(), path.Value()))
+		}
+	}
+	for i, server := range model.Servers {
+		defaults := make(map[string]string)
+		for variable := server.Variables.First(); variable != nil; variable = variable.Next() {
+			defaults[variable.Key()] = variable.Value().Default
+		}
+		doc.servers = append(doc.servers, specServer{
+			url:     resolveServerURL(server.URL, defaults),
+			pointer: JSONPointer("servers", strconv.Itoa(i), "url"),
+		})
+	}
+	for webhook := model.Webhooks.First(); webhook != nil; webhook = webhook.Next() {
+		pointer := JSONPointer("webhooks", webhook.Key())
+		for _, operation := range newSpecPathV3(webhook.Key(), webhook.Value()).withPolicies() {
+			diagnostics.warnf(operation.node, pointer+operation.pointer, "policies of webhooks are ignored, as webhooks are not requests to the service")
+		}
+	}
+	if model.Components != nil {
+		if model.Components.Extensions != nil {
+			doc.definitions, _ = model.Components.Extensions.Get(XTeadalPolicyDefinitionsKey)
+		}
+		for scheme := model.Components.SecuritySchemes.First(); scheme != nil; scheme = scheme.Next() {
+			doc.securitySchemes = append(doc.securitySchemes, specSecurityScheme{
+				name:             scheme.Key(),
+				kind:             scheme.Value().Type,
+				bearer:           scheme.Value().Type == "http" && strings.EqualFold(scheme.Value().Scheme, "bearer"),
+				openIDConnectURL: scheme.Value().OpenIdConnectUrl,
+				extensions:       scheme.Value().Extensions,
+			})
+		}
+	}
+	return doc
+}
+
+func newSpecPathV3(path string, item *v3.PathItem) specPath {
+	p := specPath{path: path, extensions: item.Extensions}
+	for method := item.GetOperations().First(); method != nil; method = method.Next() {
+		p.operations = append(p.operations, specOperation{
+			method:     method.Key(),
+			extensions: method.Value().Extensions,
+			security:   method.Value().Security,
+		})
+	}
+	return p
+}
+
+// newSpecDocumentV2 reads a Swagger 2.0 document. As there are no components, policy definitions are declared
+// by the top-level x-teadal-policy-definitions extension.
+func newSpecDocumentV2(model *v2.Swagger) *specDocument {
+	doc := &specDocument{
+		definitionsPointer:     JSONPointer(XTeadalPolicyDefinitionsKey),
+		securitySchemesPointer: JSONPointer("securityDefinitions"),
+		security:               model.Security,
+	}
+	if model.Paths != nil {
+		doc.pathsExtensions = model.Paths.Extensions
+		for path := model.Paths.PathItems.First(); path != nil; path = path.Next() {
+			p := specPath{path: path.Key(), extensions: path.Value().Extensions}
+			for method := path.Value().GetOperations().First(); method != nil; method = method.Next() {
+				p.operations = append(p.operations, specOperation{
+					method:     method.Key(),
+					extensions: method.Value().Extensions,
+					security:   method.Value().Security,
+				})
+			}
+			doc.paths = append(doc.paths, p)
+		}
+	}
+	if model.Extensions != nil {
+		doc.definitions, _ = model.Extensions.Get(XTeadalPolicyDefinitionsKey)
+	}
+	// The single server of Swagger 2.0 is given by its host and base path, as a scheme relative url
+	if model.Host != "" {
+		doc.servers = append(doc.servers, specServer{url: "//" + model.Host + model.BasePath, pointer: JSONPointer("host")})
+	} else if model.BasePath != "" {
+		doc.servers = append(doc.servers, specServer{url: model.BasePath, pointer: JSONPointer("basePath")})
+	}
+	if model.SecurityDefinitions != nil {
+		// Swagger 2.0 has no bearer scheme, bearer tokens are described as API keys sent in the authorization header
+		for scheme := model.SecurityDefinitions.Definitions.First(); scheme != nil; scheme = scheme.Next() {
+			doc.securitySchemes = append(doc.securitySchemes, specSecurityScheme{
+				name:       scheme.Key(),
+				kind:       scheme.Value().Type,
+				bearer:     scheme.Value().Type == "apiKey" && scheme.Value().In == "header" && strings.EqualFold(scheme.Value().Name, "authorization"),
+				extensions: scheme.Value().Extensions,
+			})
+		}
+	}
+	return doc
+}
+
+// scopeAlternatives returns the alternative sets of scopes required by the security requirements, located at pointer.
+// Only oauth2 and openIdConnect schemes define scopes, so the other schemes do not constrain the scopes of the token.
+// It returns nil if no scopes are required, as there are no requirements or one of the alternatives requires none.
+func (doc *specDocument) scopeAlternatives(requirements []*base.SecurityRequirement, pointer string, diagnostics *Diagnostics) [][]string {
+	var alternatives [][]string
+	unconstrained := false
+	for i, requirement := range requirements {
+		var scopes []string
+		if requirement.Requirements != nil {
+			for name, requirementScopes := range requirement.Requirements.FromOldest() {
+				index := slices.IndexFunc(doc.securitySchemes, func(scheme specSecurityScheme) bool {
+					return scheme.name == name
+				})
+				if index < 0 {
+					diagnostics.warnf(nil, pointer+JSONPointer(strconv.Itoa(i), name), "undefined security scheme %q", name)
+					continue
+				}
+				if kind := doc.securitySchemes[index].kind; kind == "oauth2" || kind == "openIdConnect" {
+					scopes = append(scopes, requirementScopes...)
+				}
+			}
+		}
+		if len(scopes) == 0 {
+			unconstrained = true
+			continue
+		}
+		slices.Sort(scopes)
+		alternatives = append(alternatives, slices.Compact(scopes))
+	}
+	if unconstrained {
+		return nil
+	}
+	return alternatives
+}
+
+// extensionNode locates an x-teadal-policies extension within a path item.
+type extensionNode struct {
+	node    *yaml.Node
+	pointer string
+}
+
+// withPolicies returns the x-teadal-policies extensions of the path item and of its operations, located relative to it.
+func (p specPath) withPolicies() []extensionNode {
+	var found []extensionNode
+	if node, ok := getExtension(p.extensions, XTeadalPoliciesKey); ok {
+		found = append(found, extensionNode{node, JSONPointer(XTeadalPoliciesKey)})
+	}
+	for _, operation := range p.operations {
+		if node, ok := getExtension(operation.extensions, XTeadalPoliciesKey); ok {
+			found = append(found, extensionNode{node, JSONPointer(operation.method, XTeadalPoliciesKey)})
+		}
+	}
+	return found
+}
+
+// getExtension returns the value of an extension, if the extensions are present and hold it.
+func getExtension(extensions extensions, key string) (*yaml.Node, bool) {
+	if extensions == nil {
+		return nil, false
+	}
+	return extensions.Get(key)
+}
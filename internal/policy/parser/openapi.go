@@ -3,162 +3,385 @@ package parser
 import (
 	"dspn-regogenerator/internal/policy"
 	"fmt"
-	"os"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
 
-	"github.com/pb33f/libopenapi"
-	v3 "github.com/pb33f/libopenapi/datamodel/high/v3"
+	"gopkg.in/yaml.v3"
 )
 
 const (
-	XTeadalPoliciesKey = "x-teadal-policies"
-	XTeadalIAMKey      = "x-teadal-IAM-provider"
+	XTeadalPoliciesKey          = "x-teadal-policies"
+	XTeadalIAMKey               = "x-teadal-IAM-provider"
+	XTeadalPolicyDefinitionsKey = "x-teadal-policy-definitions"
 )
 
 type XTeadalPolicies struct {
+	// Version of the extension schema, inferred from the keys when missing
+	Version     string                `json:"version" yaml:"version"`
 	Policies    []policy.PolicyClause `json:"access-policies" yaml:"access-policies"`
+	Deny        []policy.PolicyClause `json:"deny-policies" yaml:"deny-policies"`
 	Description string                `json:"description"`
+	// LegacyPolicies holds the access clauses of version 1 extensions while decoding, then they are moved to Policies
+	LegacyPolicies []policy.PolicyClause `json:"policies" yaml:"policies"`
+}
+
+// validate checks both the access and the deny clauses of the extension located at node, reporting each invalid clause.
+func (x *XTeadalPolicies) validate(node *yaml.Node, pointer string, path string, definitions map[string]policy.PolicyClause, diagnostics *Diagnostics) {
+	v := newClauseValidator(path, definitions)
+	accessKey := "access-policies"
+	if x.Version == XTeadalPoliciesV1 {
+		accessKey = "policies"
+	}
+	v.validateClauses(x.Policies, childNode(node, accessKey), pointer+JSONPointer(accessKey), diagnostics)
+	v.validateClauses(x.Deny, childNode(node, "deny-policies"), pointer+JSONPointer("deny-policies"), diagnostics)
 }
 
 type StructuredPolicies = policy.GeneralPolicies
 
-func ParseOpenAPIPolicies(specByteArray []byte) (*StructuredPolicies, error) {
-	docModel, err := getDocumentFromData(specByteArray)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse OpenAPI spec: %v", err)
+// ParseOpenAPIPolicies extracts the policies of the x-teadal-policies extensions of the spec.
+// Every problem found is returned in the diagnostics; the policies are nil if any of them is an error.
+func ParseOpenAPIPolicies(specByteArray []byte) (*StructuredPolicies, Diagnostics) {
+	var diagnostics Diagnostics
+	doc := getDocumentFromData(specByteArray, &diagnostics)
+	if doc == nil {
+		return nil, diagnostics
+	}
+	result := doc.policies(&diagnostics)
+	if diagnostics.HasErrors() {
+		return nil, diagnostics
 	}
+	return result, diagnostics
+}
 
+// policies extracts the policies of the document, adding the problems found to diagnostics.
+func (doc *specDocument) policies(diagnostics *Diagnostics) *StructuredPolicies {
 	result := policy.NewGeneralPolicies()
+	checker := &schemaChecker{diagnostics: diagnostics}
 
-	// Processing general policies
-	if docModel.Model.Paths.Extensions.Len() > 1 {
-		fmt.Fprintf(os.Stderr, "Warning: multiple extensions found in paths\n")
-	}
-	pathsTag := docModel.Model.Paths.Extensions.First()
-	for pathsTag != nil && pathsTag.Key() != "x-teadal-policies" {
-		pathsTag = pathsTag.Next()
+	// Processing policy definitions, which can be used by the clauses of every path
+	if doc.definitions != nil {
+		definitions, err := checker.decodeDefinitions(doc.definitions, doc.definitionsPointer)
+		if err != nil {
+			diagnostics.errorf(doc.definitions, doc.definitionsPointer, "failed to decode value for %s: %v", XTeadalPolicyDefinitionsKey, err)
+		} else {
+			result.Definitions = definitions
+			validateDefinitions(definitions, doc.definitions, doc.definitionsPointer, diagnostics)
+		}
 	}
-	if pathsTag != nil {
-		decodedTag := new(XTeadalPolicies)
-		err = pathsTag.Value().Decode(decodedTag)
+
+	// decodeExtension decodes and validates the x-teadal-policies extension among the given ones, if any
+	decodeExtension := func(extensions extensions, path string, pointer string) *XTeadalPolicies {
+		if extensions == nil {
+			return nil
+		}
+		if extensions.Len() > 1 {
+			diagnostics.warnf(nil, pointer, "multiple extensions found")
+		}
+		node, ok := extensions.Get(XTeadalPoliciesKey)
+		if !ok {
+			return nil
+		}
+		pointer += JSONPointer(XTeadalPoliciesKey)
+		decodedTag, err := checker.decodeXTeadalPolicies(node, pointer)
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode value for path %s: %v", pathsTag.Key(), err)
+			diagnostics.errorf(node, pointer, "failed to decode value for %s: %v", XTeadalPoliciesKey, err)
+			return nil
 		}
+		decodedTag.validate(node, pointer, path, result.Definitions, diagnostics)
+		return decodedTag
+	}
+
+	// Processing general policies
+	if decodedTag := decodeExtension(doc.pathsExtensions, "", JSONPointer("paths")); decodedTag != nil {
 		result.Policies = decodedTag.Policies
+		result.Deny = decodedTag.Deny
 	}
 
 	// Processing specialized policies
-	for path := docModel.Model.Paths.PathItems.First(); path != nil; path = path.Next() {
-		// Check if the path has more than one extension
-		if path.Value().Extensions.Len() > 1 {
-			fmt.Fprintf(os.Stderr, "Warning: multiple extensions found in path %s\n", path.Key())
-		}
-		// Decode the extension value if it exists
-		pathTag := path.Value().Extensions.First()
-		for pathTag != nil && pathTag.Key() != "x-teadal-policies" {
-			pathTag = pathTag.Next()
-		}
-		if pathTag != nil {
-			decodedTag := new(XTeadalPolicies)
-			err = pathTag.Value().Decode(decodedTag)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decode value for path %s: %v", path.Key(), err)
-			}
-			result.SpecializedPaths[path.Key()] = policy.PathPolicies{
+	for _, path := range doc.paths {
+		if decodedTag := decodeExtension(path.extensions, path.path, JSONPointer("paths", path.path)); decodedTag != nil {
+			result.SpecializedPaths[path.path] = policy.PathPolicies{
 				Policies: decodedTag.Policies,
-				Path:     path.Key(),
+				Deny:     decodedTag.Deny,
+				Path:     path.path,
 			}
 		}
 
 		// Check if the path has any methods with extensions
-		for method := path.Value().GetOperations().First(); method != nil; method = method.Next() {
-			// Check if the method has more than one extension
-			if method.Value().Extensions.Len() > 1 {
-				fmt.Fprintf(os.Stderr, "Warning: multiple extensions found in method %s in path %s\n", method.Key(), path.Key())
-			}
-			// Decode the extension value if it exists
-			methodTag := method.Value().Extensions.First()
-			for methodTag != nil && methodTag.Key() != "x-teadal-policies" {
-				methodTag = methodTag.Next()
-			}
-			if methodTag != nil {
-				decodedTag := new(XTeadalPolicies)
-				err = methodTag.Value().Decode(decodedTag)
-				if err != nil {
-					return nil, fmt.Errorf("failed to decode value for method %s in path %s: %v", method.Key(), path.Key(), err)
-				}
+		for _, method := range path.operations {
+			decodedTag := decodeExtension(method.extensions, path.path, JSONPointer("paths", path.path, method.method))
+			if decodedTag == nil {
+				continue
+			}
 
-				// Update the specialized path policies
-				var pathPolicies policy.PathPolicies
-				if _, ok := result.SpecializedPaths[path.Key()]; !ok {
-					pathPolicies = policy.PathPolicies{
-						Policies:           []policy.PolicyClause{},
-						Path:               path.Key(),
-						SpecializedMethods: make(map[string]policy.PathMethodPolicies),
-					}
-				} else {
-					pathPolicies = result.SpecializedPaths[path.Key()]
-				}
-				if pathPolicies.SpecializedMethods == nil {
-					pathPolicies.SpecializedMethods = make(map[string]policy.PathMethodPolicies)
+			// Update the specialized path policies
+			var pathPolicies policy.PathPolicies
+			if _, ok := result.SpecializedPaths[path.path]; !ok {
+				pathPolicies = policy.PathPolicies{
+					Policies:           []policy.PolicyClause{},
+					Path:               path.path,
+					SpecializedMethods: make(map[string]policy.PathMethodPolicies),
 				}
-				pathPolicies.SpecializedMethods[method.Key()] = policy.PathMethodPolicies{
-					Policies: decodedTag.Policies,
-					Method:   method.Key(),
-				}
-				result.SpecializedPaths[path.Key()] = pathPolicies
+			} else {
+				pathPolicies = result.SpecializedPaths[path.path]
+			}
+			if pathPolicies.SpecializedMethods == nil {
+				pathPolicies.SpecializedMethods = make(map[string]policy.PathMethodPolicies)
 			}
+			pathPolicies.SpecializedMethods[method.method] = policy.PathMethodPolicies{
+				Policies: decodedTag.Policies,
+				Deny:     decodedTag.Deny,
+				Method:   method.method,
+			}
+			result.SpecializedPaths[path.path] = pathPolicies
 		}
 	}
 
-	return result, nil
+	// Processing the OAuth2 scopes required by the security requirements of each operation
+	for _, path := range doc.paths {
+		for _, method := range path.operations {
+			security, pointer := method.security, JSONPointer("paths", path.path, method.method, "security")
+			if security == nil {
+				security, pointer = doc.security, JSONPointer("security")
+			}
+			if alternatives := doc.scopeAlternatives(security, pointer, diagnostics); alternatives != nil {
+				result.Scopes = append(result.Scopes, policy.ScopeRequirement{
+					Path:         path.path,
+					Method:       method.method,
+					Alternatives: alternatives,
+				})
+			}
+		}
+	}
+
+	return result
 }
 
-func ParseOpenAPIIAM(specByteArray []byte) (*string, error) {
-	docModel, err := getDocumentFromData(specByteArray)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse OpenAPI spec: %v", err)
+// clauseValidator checks the values of the decoded policy clauses that cannot be verified by the decoder itself.
+type clauseValidator struct {
+	// path is the OpenAPI path the clauses apply to, empty for the general policies
+	path       string
+	pathParams []string
+	// skipPathParams disables the path parameters check, for definitions validated outside of any path
+	skipPathParams bool
+	definitions    map[string]policy.PolicyClause
+	// using holds the definitions being validated, to detect cycles
+	using []string
+}
+
+func newClauseValidator(path string, definitions map[string]policy.PolicyClause) *clauseValidator {
+	return &clauseValidator{
+		path:        path,
+		pathParams:  slices.Collect(maps.Values(policy.PathParams(path))),
+		definitions: definitions,
+	}
+}
+
+// validateDefinitions checks every policy definition, located at node. Their path parameters are checked where they are used.
+func validateDefinitions(definitions map[string]policy.PolicyClause, node *yaml.Node, pointer string, diagnostics *Diagnostics) {
+	v := newClauseValidator("", definitions)
+	v.skipPathParams = true
+	ruleNames := make(map[string]string)
+	for _, name := range slices.Sorted(maps.Keys(definitions)) {
+		ruleName := policy.DefinitionRuleName(name)
+		if other, ok := ruleNames[ruleName]; ok {
+			diagnostics.errorf(childNode(node, name), pointer+JSONPointer(name), "policy definition %q collides with %q, both generate rule %s", name, other, ruleName)
+			continue
+		}
+		ruleNames[ruleName] = name
+		if err := v.validateClause(&policy.PolicyClause{Use: name}); err != nil {
+			diagnostics.errorf(childNode(node, name), pointer+JSONPointer(name), "%v", err)
+		}
+	}
+}
+
+// validateClauses checks the clauses of a list located at node, reporting each invalid clause.
+func (v *clauseValidator) validateClauses(clauses []policy.PolicyClause, node *yaml.Node, pointer string, diagnostics *Diagnostics) {
+	for i, clause := range clauses {
+		if err := v.validateClause(&clause); err != nil {
+			diagnostics.errorf(childNode(node, strconv.Itoa(i)), pointer+JSONPointer(strconv.Itoa(i)), "%v", err)
+		}
+	}
+}
+
+// validateClause checks a single clause, its nested clauses and the definitions it uses against the parameters of the path.
+func (v *clauseValidator) validateClause(clause *policy.PolicyClause) error {
+	if clause.PathParamsPolicy != nil && !v.skipPathParams {
+		for param := range clause.PathParamsPolicy.Value {
+			if !slices.Contains(v.pathParams, param) {
+				return fmt.Errorf("path parameter %q is not a segment of path %q", param, v.path)
+			}
+		}
 	}
-	// Check if the document has any security requirements
-	if docModel.Model.Components.SecuritySchemes.Len() == 0 {
-		return nil, fmt.Errorf("no security requirements found in OpenAPI spec")
+	if clause.ClaimsPolicy != nil {
+		for _, condition := range clause.ClaimsPolicy.Value {
+			if !condition.Operator.Valid() {
+				return fmt.Errorf("unsupported claim operator %q", condition.Operator)
+			}
+			if _, err := condition.ToRego(); err != nil {
+				return err
+			}
+			if condition.Operator == policy.ClaimOperatorRegex {
+				if _, err := regexp.Compile(condition.Value.(string)); err != nil {
+					return fmt.Errorf("invalid regular expression for claim %s: %v", condition.Claim, err)
+				}
+			}
+		}
+	}
+	if clause.CallPolicy != nil {
+		for _, limit := range clause.CallPolicy.Value {
+			if !limit.UnitOfMeasure.Valid() {
+				return fmt.Errorf("unsupported call unit of measure %q", limit.UnitOfMeasure)
+			}
+			if limit.Max == "" {
+				continue
+			}
+			if !isNonNegativeInteger(limit.Max) {
+				return fmt.Errorf("call max must be a non-negative integer, got %q", limit.Max)
+			}
+		}
 	}
-	if docModel.Model.Components.SecuritySchemes.Len() > 1 {
-		fmt.Fprintf(os.Stderr, "Warning: multiple security requirements found in OpenAPI spec\n")
+	if clause.TimelinessPolicy != nil {
+		for _, limit := range clause.TimelinessPolicy.Value {
+			if !limit.UnitOfMeasure.Valid() {
+				return fmt.Errorf("unsupported timeliness unit of measure %q", limit.UnitOfMeasure)
+			}
+			if limit.Max != "" && !isNonNegativeInteger(limit.Max) {
+				return fmt.Errorf("timeliness max must be a non-negative integer, got %q", limit.Max)
+			}
+			if limit.Min != "" && !isNonNegativeInteger(limit.Min) {
+				return fmt.Errorf("timeliness min must be a non-negative integer, got %q", limit.Min)
+			}
+		}
 	}
-	securityTag := docModel.Model.Components.SecuritySchemes.First()
-	for securityTag != nil && securityTag.Key() != "bearerAuth" {
-		securityTag = securityTag.Next()
+	if clause.AnyOf != nil && len(clause.AnyOf) == 0 {
+		return fmt.Errorf("any_of must contain at least one clause")
 	}
-	if securityTag == nil {
-		return nil, fmt.Errorf("bearerAuth security requirement not found in OpenAPI spec")
+	for i, nested := range clause.AllOf {
+		if err := v.validateClause(&nested); err != nil {
+			return fmt.Errorf("all_of %d: %v", i, err)
+		}
 	}
-	// Decode the security requirement value
-	exts := securityTag.Value().Extensions.First()
-	for exts != nil && exts.Key() != XTeadalIAMKey {
-		exts = exts.Next()
+	for i, nested := range clause.AnyOf {
+		if err := v.validateClause(&nested); err != nil {
+			return fmt.Errorf("any_of %d: %v", i, err)
+		}
 	}
-	if exts == nil {
-		return nil, fmt.Errorf(XTeadalIAMKey + "extension not found in bearerAuth security requirement")
+	if clause.Not != nil {
+		if err := v.validateClause(clause.Not); err != nil {
+			return fmt.Errorf("not: %v", err)
+		}
 	}
-	url := ""
-	err = exts.Value().Decode(&url)
+	name, err := clause.DefinitionName()
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode value for bearerAuth security requirement: %v", err)
+		return err
 	}
-	return &url, nil
+	if name != "" {
+		definition, ok := v.definitions[name]
+		if !ok {
+			return fmt.Errorf("undefined policy definition %q", name)
+		}
+		if slices.Contains(v.using, name) {
+			return fmt.Errorf("policy definition %q refers to itself", name)
+		}
+		v.using = append(v.using, name)
+		err := v.validateClause(&definition)
+		v.using = v.using[:len(v.using)-1]
+		if err != nil {
+			return fmt.Errorf("definition %s: %v", name, err)
+		}
+	}
+	return nil
 }
 
-func getDocumentFromData(specByteArray []byte) (*libopenapi.DocumentModel[v3.Document], error) {
-	document, err := libopenapi.NewDocument(specByteArray)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse OpenAPI spec: %v", err)
+func isNonNegativeInteger(value string) bool {
+	n, err := strconv.Atoi(value)
+	return err == nil && n >= 0
+}
+
+// ParseOpenAPIIAM extracts the OIDC discovery URLs of the identity providers trusted by the service from its security
+// schemes. The URL of openIdConnect schemes is their openIdConnectUrl, while http bearer and oauth2 schemes declare it
+// with the x-teadal-IAM-provider extension. Other schemes are ignored.
+// Every problem found is returned in the diagnostics; the URLs are nil if any of them is an error.
+func ParseOpenAPIIAM(specByteArray []byte) ([]string, Diagnostics) {
+	var diagnostics Diagnostics
+	doc := getDocumentFromData(specByteArray, &diagnostics)
+	if doc == nil {
+		return nil, diagnostics
 	}
-	docModel, errors := document.BuildV3Model()
-	if len(errors) > 0 {
-		for i := range errors {
-			fmt.Printf("error: %e\n", errors[i])
+	providers := doc.providers(&diagnostics)
+	if diagnostics.HasErrors() {
+		return nil, diagnostics
+	}
+	return providers, diagnostics
+}
+
+// providers extracts the OIDC discovery URLs of the identity providers of the document, adding the problems found to
+// diagnostics.
+func (doc *specDocument) providers(diagnostics *Diagnostics) []string {
+	var providers []string
+	for _, scheme := range doc.securitySchemes {
+		pointer := doc.securitySchemesPointer + JSONPointer(scheme.name)
+		url := ""
+		switch {
+		case scheme.kind == "openIdConnect":
+			url = scheme.openIDConnectURL
+		case scheme.kind == "oauth2" || scheme.bearer:
+			node, ok := getExtension(scheme.extensions, XTeadalIAMKey)
+			if !ok {
+				diagnostics.warnf(nil, pointer, "%s extension not found, the security scheme is ignored", XTeadalIAMKey)
+				continue
+			}
+			if err := node.Decode(&url); err != nil {
+				diagnostics.errorf(node, pointer+JSONPointer(XTeadalIAMKey), "failed to decode value for %s: %v", XTeadalIAMKey, err)
+				continue
+			}
+		default:
+			continue
 		}
-		panic(fmt.Sprintf("cannot create v3 model from document: %d errors reported", len(errors)))
+		if url == "" {
+			diagnostics.errorf(nil, pointer, "empty IAM provider URL")
+			continue
+		}
+		if !slices.Contains(providers, url) {
+			providers = append(providers, url)
+		}
+	}
+	if len(providers) == 0 && !diagnostics.HasErrors() {
+		diagnostics.errorf(nil, doc.securitySchemesPointer, "no http bearer, oauth2 or openIdConnect security scheme with an IAM provider found in OpenAPI spec")
+	}
+	return providers
+}
+
+// Service holds the policies, identity providers and route extracted from the spec of a service.
+type Service struct {
+	Policies  *StructuredPolicies
+	Providers []string
+	// Route is nil if the spec declares no servers
+	Route *Route
+}
+
+// ParseOpenAPIService extracts the policies, identity providers and route of the spec, as ParseOpenAPIPolicies,
+// ParseOpenAPIIAM and ParseOpenAPIRoute do, parsing the document once so that its problems are reported once.
+// Every problem found is returned in the diagnostics; the service is nil if any of them is an error.
+func ParseOpenAPIService(specByteArray []byte) (*Service, Diagnostics) {
+	var diagnostics Diagnostics
+	doc := getDocumentFromData(specByteArray, &diagnostics)
+	if doc == nil {
+		return nil, diagnostics
+	}
+	// Each extraction has its own diagnostics, as the providers check whether any error was found
+	var policyDiagnostics, providerDiagnostics, routeDiagnostics Diagnostics
+	service := &Service{
+		Policies:  doc.policies(&policyDiagnostics),
+		Providers: doc.providers(&providerDiagnostics),
+		Route:     doc.route(&routeDiagnostics),
+	}
+	diagnostics = slices.Concat(diagnostics, policyDiagnostics, providerDiagnostics, routeDiagnostics)
+	if diagnostics.HasErrors() {
+		return nil, diagnostics
 	}
-	return docModel, nil
+	return service, diagnostics
 }
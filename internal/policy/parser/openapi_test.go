@@ -1,8 +1,11 @@
 package parser_test
 
 import (
+	"dspn-regogenerator/internal/policy"
 	"dspn-regogenerator/internal/policy/parser"
 	"os"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -17,8 +20,8 @@ func TestParseOpenAPIPathsConditions(t *testing.T) {
 		t.Fatalf("Failed to read OpenAPI file: %v", err)
 	}
 	// Parse the OpenAPI document
-	r, err := parser.ParseOpenAPIPolicies(file)
-	if err != nil {
+	r, diagnostics := parser.ParseOpenAPIPolicies(file)
+	if err := diagnostics.Err(); err != nil {
 		t.Fatalf("Failed to parse OpenAPI file: %v", err)
 	}
 	if r == nil {
@@ -47,8 +50,8 @@ func TestParseOpenAPISpecializedPathConditions(t *testing.T) {
 		t.Fatalf("Failed to read OpenAPI file: %v", err)
 	}
 	// Parse the OpenAPI document
-	r, err := parser.ParseOpenAPIPolicies(file)
-	if err != nil {
+	r, diagnostics := parser.ParseOpenAPIPolicies(file)
+	if err := diagnostics.Err(); err != nil {
 		t.Fatalf("Failed to parse OpenAPI file: %v", err)
 	}
 	if r == nil {
@@ -71,8 +74,8 @@ func TestParseOpenAPISpecializedPathMethodConditions(t *testing.T) {
 		t.Fatalf("Failed to read OpenAPI file: %v", err)
 	}
 	// Parse the OpenAPI document
-	r, err := parser.ParseOpenAPIPolicies(file)
-	if err != nil {
+	r, diagnostics := parser.ParseOpenAPIPolicies(file)
+	if err := diagnostics.Err(); err != nil {
 		t.Fatalf("Failed to parse OpenAPI file: %v", err)
 	}
 	if r == nil {
@@ -94,15 +97,15 @@ func TestParsing(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to read OpenAPI file: %v", err)
 	}
-	url, err := parser.ParseOpenAPIIAM(file)
-	if err != nil {
+	urls, diagnostics := parser.ParseOpenAPIIAM(file)
+	if err := diagnostics.Err(); err != nil {
 		t.Fatalf("Failed to parse OpenAPI file: %v", err)
 	}
-	if url == nil {
-		t.Fatalf("Expected non-nil result, got nil")
+	if len(urls) != 1 {
+		t.Fatalf("Expected one provider, got %v", urls)
 	}
-	if *url != "http://localhost/keycloak/realms/master/.well-known/openid-configuration" {
-		t.Errorf("Expected URL http://localhost/keycloak/realms/master/.well-known/openid-configuration, got %s", *url)
+	if urls[0] != "http://localhost/keycloak/realms/master/.well-known/openid-configuration" {
+		t.Errorf("Expected URL http://localhost/keycloak/realms/master/.well-known/openid-configuration, got %s", urls[0])
 	}
 }
 
@@ -115,8 +118,8 @@ func TestParseBearerPathRules(t *testing.T) {
 		t.Fatalf("Failed to read OpenAPI file: %v", err)
 	}
 	// Parse the OpenAPI document
-	r, err := parser.ParseOpenAPIPolicies(file)
-	if err != nil {
+	r, diagnostics := parser.ParseOpenAPIPolicies(file)
+	if err := diagnostics.Err(); err != nil {
 		t.Fatalf("Failed to parse OpenAPI file: %v", err)
 	}
 	if _, ok := r.SpecializedPaths["/bearer"]; !ok {
@@ -168,3 +171,885 @@ func TestParseBearerPathRules(t *testing.T) {
 		t.Errorf("Expected StorageLocationPolicy value USA, got %s", specPath.Policies[1].StorageLocationPolicy.Value[1])
 	}
 }
+
+func TestParseInvalidCallUnit(t *testing.T) {
+	spec := []byte(`openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  /data:
+    get:
+      x-teadal-policies:
+        access-policies:
+          - call:
+              value:
+                - max: 10
+                  unit_of_measure: call_per_hour
+      responses:
+        "200":
+          description: ok
+`)
+	if _, diagnostics := parser.ParseOpenAPIPolicies(spec); !diagnostics.HasErrors() {
+		t.Errorf("Expected error for unsupported call unit of measure, got nil")
+	}
+}
+
+func TestParseInvalidTimelinessUnit(t *testing.T) {
+	spec := []byte(`openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  /data:
+    get:
+      x-teadal-policies:
+        access-policies:
+          - timeliness:
+              value:
+                - max: 7
+                  unit_of_measure: fortnights
+      responses:
+        "200":
+          description: ok
+`)
+	if _, diagnostics := parser.ParseOpenAPIPolicies(spec); !diagnostics.HasErrors() {
+		t.Errorf("Expected error for unsupported timeliness unit of measure, got nil")
+	}
+}
+
+func TestParsePathParamsPolicy(t *testing.T) {
+	spec := []byte(`openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  /drug_exposure/{drug_exposure_id}:
+    x-teadal-policies:
+      access-policies:
+        - path_params:
+            value:
+              drug_exposure_id: preferred_username
+    get:
+      responses:
+        "200":
+          description: ok
+  /drugs:
+    x-teadal-policies:
+      access-policies:
+        - path_params:
+            value:
+              drug_exposure_id: preferred_username
+    get:
+      responses:
+        "200":
+          description: ok
+`)
+	if _, diagnostics := parser.ParseOpenAPIPolicies(spec); !diagnostics.HasErrors() {
+		t.Errorf("Expected error for path parameter not in path, got nil")
+	}
+
+	spec = []byte(strings.Split(string(spec), "  /drugs:")[0])
+	r, diagnostics := parser.ParseOpenAPIPolicies(spec)
+	if err := diagnostics.Err(); err != nil {
+		t.Fatalf("Failed to parse OpenAPI spec: %v", err)
+	}
+	pathPolicies := r.SpecializedPaths["/drug_exposure/{drug_exposure_id}"]
+	if len(pathPolicies.Policies) != 1 || pathPolicies.Policies[0].PathParamsPolicy == nil ||
+		pathPolicies.Policies[0].PathParamsPolicy.Value["drug_exposure_id"] != "preferred_username" {
+		t.Errorf("Expected path params policy, got %v", pathPolicies.Policies)
+	}
+}
+
+func TestParseClaimsPolicy(t *testing.T) {
+	spec := []byte(`openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  /contracts:
+    get:
+      x-teadal-policies:
+        access-policies:
+          - claims:
+              value:
+                - claim: organization.country
+                  operator: in
+                  value: [Italy, Spain]
+                - claim: contract_id
+                  operator: regex
+                  value: "^C-[0-9]+$"
+                - claim: clearance
+                  operator: gte
+                  value: 3
+                - claim: department
+                  value: cardiology
+      responses:
+        "200":
+          description: ok
+`)
+	r, diagnostics := parser.ParseOpenAPIPolicies(spec)
+	if err := diagnostics.Err(); err != nil {
+		t.Fatalf("Failed to parse OpenAPI spec: %v", err)
+	}
+	methodPolicies := r.SpecializedPaths["/contracts"].SpecializedMethods["get"]
+	if len(methodPolicies.Policies) != 1 || methodPolicies.Policies[0].ClaimsPolicy == nil {
+		t.Fatalf("Expected claims policy, got %v", methodPolicies.Policies)
+	}
+	conditions := methodPolicies.Policies[0].ClaimsPolicy.Value
+	if len(conditions) != 4 || conditions[0].Claim != "organization.country" || conditions[2].Value != 3 {
+		t.Errorf("Unexpected claim conditions %v", conditions)
+	}
+	// Without operator, the claim must be equal to the value
+	if len(conditions) == 4 && (conditions[3].Operator != "" || conditions[3].Value != "cardiology") {
+		t.Errorf("Expected an equality condition without operator, got %v", conditions[3])
+	}
+
+	for _, invalid := range []string{"operator: like\n                  value: x", "operator: in\n                  value: Italy", "operator: gt\n                  value: high", "operator: regex\n                  value: \"[\""} {
+		spec := []byte(`openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  /contracts:
+    get:
+      x-teadal-policies:
+        access-policies:
+          - claims:
+              value:
+                - claim: organization.country
+                  ` + invalid + `
+      responses:
+        "200":
+          description: ok
+`)
+		if _, diagnostics := parser.ParseOpenAPIPolicies(spec); !diagnostics.HasErrors() {
+			t.Errorf("Expected error for invalid claim condition %q, got nil", invalid)
+		}
+	}
+}
+
+func TestParseDenyPolicies(t *testing.T) {
+	spec := []byte(`openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  x-teadal-policies:
+    access-policies:
+      - roles:
+          value: [doctor]
+    deny-policies:
+      - user:
+          value: [mallory]
+  /admin:
+    delete:
+      x-teadal-policies:
+        deny-policies:
+          - {}
+      responses:
+        "200":
+          description: ok
+`)
+	r, diagnostics := parser.ParseOpenAPIPolicies(spec)
+	if err := diagnostics.Err(); err != nil {
+		t.Fatalf("Failed to parse OpenAPI spec: %v", err)
+	}
+	if len(r.Deny) != 1 || r.Deny[0].UserPolicy == nil || r.Deny[0].UserPolicy.Value[0] != "mallory" {
+		t.Errorf("Expected general deny clause, got %v", r.Deny)
+	}
+	methodPolicies := r.SpecializedPaths["/admin"].SpecializedMethods["delete"]
+	if len(methodPolicies.Policies) != 0 || len(methodPolicies.Deny) != 1 {
+		t.Errorf("Expected one deny clause on DELETE /admin, got %v", methodPolicies)
+	}
+}
+
+func TestParseNestedClauses(t *testing.T) {
+	spec := []byte(`openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  x-teadal-policies:
+    access-policies:
+      - any_of:
+          - roles:
+              value: [A]
+            user:
+              value: [alice, bob]
+          - all_of:
+              - roles:
+                  value: [B]
+              - storage_location:
+                  value: [Europe]
+        not:
+          user:
+            value: [mallory]
+`)
+	r, diagnostics := parser.ParseOpenAPIPolicies(spec)
+	if err := diagnostics.Err(); err != nil {
+		t.Fatalf("Failed to parse OpenAPI spec: %v", err)
+	}
+	if len(r.Policies) != 1 {
+		t.Fatalf("Expected one clause, got %v", r.Policies)
+	}
+	clause := r.Policies[0]
+	if len(clause.AnyOf) != 2 || clause.AnyOf[0].RolePolicy == nil || len(clause.AnyOf[1].AllOf) != 2 {
+		t.Errorf("Unexpected any_of clauses %v", clause.AnyOf)
+	}
+	if clause.Not == nil || clause.Not.UserPolicy == nil || clause.Not.UserPolicy.Value[0] != "mallory" {
+		t.Errorf("Unexpected not clause %v", clause.Not)
+	}
+
+	invalid := []byte(`openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  x-teadal-policies:
+    access-policies:
+      - not:
+          any_of:
+            - call:
+                value:
+                  - max: 10
+                    unit_of_measure: call_per_hour
+`)
+	if _, diagnostics := parser.ParseOpenAPIPolicies(invalid); !diagnostics.HasErrors() {
+		t.Errorf("Expected error for invalid nested clause, got nil")
+	}
+}
+
+func TestParsePolicyDefinitions(t *testing.T) {
+	spec := []byte(`openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+components:
+  x-teadal-policy-definitions:
+    management:
+      roles:
+        value: [admin, top_management]
+    logistics:
+      any_of:
+        - use: management
+        - roles:
+            value: [logistic_user]
+paths:
+  /orders:
+    get:
+      x-teadal-policies:
+        access-policies:
+          - $ref: "#/components/x-teadal-policy-definitions/logistics"
+      responses:
+        "200":
+          description: ok
+  /invoices:
+    get:
+      x-teadal-policies:
+        access-policies:
+          - use: management
+      responses:
+        "200":
+          description: ok
+`)
+	r, diagnostics := parser.ParseOpenAPIPolicies(spec)
+	if err := diagnostics.Err(); err != nil {
+		t.Fatalf("Failed to parse OpenAPI spec: %v", err)
+	}
+	if len(r.Definitions) != 2 || r.Definitions["management"].RolePolicy == nil {
+		t.Errorf("Unexpected policy definitions %v", r.Definitions)
+	}
+	orders := r.SpecializedPaths["/orders"].SpecializedMethods["get"].Policies
+	if len(orders) != 1 || orders[0].Ref != "#/components/x-teadal-policy-definitions/logistics" {
+		t.Errorf("Unexpected policies for GET /orders %v", orders)
+	}
+	invoices := r.SpecializedPaths["/invoices"].SpecializedMethods["get"].Policies
+	if len(invoices) != 1 || invoices[0].Use != "management" {
+		t.Errorf("Unexpected policies for GET /invoices %v", invoices)
+	}
+
+	for name, invalid := range map[string]string{
+		"undefined": "use: sales",
+		"bad ref":   `$ref: "#/components/x-teadal-policy-definitions"`,
+	} {
+		spec := []byte(strings.Replace(string(spec), "use: management\n      responses", invalid+"\n      responses", 1))
+		if _, diagnostics := parser.ParseOpenAPIPolicies(spec); !diagnostics.HasErrors() {
+			t.Errorf("Expected error for %s reference, got nil", name)
+		}
+	}
+
+	cyclic := []byte(strings.Replace(string(spec), "- use: management\n", "- use: logistics\n", 1))
+	if _, diagnostics := parser.ParseOpenAPIPolicies(cyclic); !diagnostics.HasErrors() {
+		t.Errorf("Expected error for cyclic definition, got nil")
+	}
+
+	colliding := []byte(strings.Replace(string(spec), "    logistics:\n", "    manage-ment:\n      user:\n        value: [alice]\n    manage_ment:\n      user:\n        value: [bob]\n    logistics:\n", 1))
+	_, diagnostics = parser.ParseOpenAPIPolicies(colliding)
+	if err := diagnostics.Err(); err == nil || !strings.Contains(err.Error(), "policy_manage_ment") {
+		t.Errorf("Expected error for colliding definitions, got %v", err)
+	}
+}
+
+func TestParseLegacyPoliciesKey(t *testing.T) {
+	cwd, _ := os.Getwd()
+	cwd = strings.Split(cwd, "/internal")[0]
+	os.Chdir(cwd)
+	for _, name := range []string{"fdpindustry-ext.yaml", "fdpmedicine01-ext.yaml"} {
+		file, err := os.ReadFile("./testdata/schemas/" + name)
+		if err != nil {
+			t.Fatalf("Failed to read OpenAPI file: %v", err)
+		}
+		r, diagnostics := parser.ParseOpenAPIPolicies(file)
+		if err := diagnostics.Err(); err != nil {
+			t.Fatalf("Failed to parse %s: %v", name, err)
+		}
+		clauses := len(r.Policies)
+		for _, path := range r.SpecializedPaths {
+			clauses += len(path.Policies)
+			for _, method := range path.SpecializedMethods {
+				clauses += len(method.Policies)
+			}
+		}
+		if clauses == 0 {
+			t.Errorf("Expected the policies of %s to be parsed, got none", name)
+		}
+	}
+}
+
+func TestParseExtensionVersion(t *testing.T) {
+	spec := func(extension string) []byte {
+		return []byte(`openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  x-teadal-policies:
+` + extension)
+	}
+	r, diagnostics := parser.ParseOpenAPIPolicies(spec(`    version: 1
+    policies:
+      - user:
+          value: [alice]
+`))
+	if err := diagnostics.Err(); err != nil {
+		t.Fatalf("Failed to parse OpenAPI spec: %v", err)
+	}
+	if len(r.Policies) != 1 || r.Policies[0].UserPolicy == nil {
+		t.Errorf("Expected version 1 policies, got %v", r.Policies)
+	}
+
+	// With version 2 the legacy key is not part of the schema and it is ignored
+	r, diagnostics = parser.ParseOpenAPIPolicies(spec(`    version: 2
+    policies:
+      - user:
+          value: [alice]
+`))
+	if err := diagnostics.Err(); err != nil {
+		t.Fatalf("Failed to parse OpenAPI spec: %v", err)
+	}
+	if len(r.Policies) != 0 {
+		t.Errorf("Expected no version 2 policies, got %v", r.Policies)
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Pointer != "/paths/x-teadal-policies/policies" {
+		t.Errorf("Expected a warning for the policies key, got %v", diagnostics)
+	}
+
+	for name, extension := range map[string]string{
+		"unsupported version": "    version: 3\n    access-policies: []\n",
+		"both keys":           "    policies: []\n    access-policies: []\n",
+	} {
+		if _, diagnostics := parser.ParseOpenAPIPolicies(spec(extension)); !diagnostics.HasErrors() {
+			t.Errorf("Expected error for %s, got nil", name)
+		}
+	}
+}
+
+func TestJSONPointer(t *testing.T) {
+	got := parser.JSONPointer("paths", "/drugs/{id}", "get", "x-teadal-policies", "a~b")
+	want := "/paths/~1drugs~1{id}/get/x-teadal-policies/a~0b"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	spec := []byte(`openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  /orders:
+    x-teadal-policies:
+      access-policies:
+        - call:
+            value:
+              - max: 10
+                unit_of_measure: call_per_hour
+        - users:
+            value: [alice]
+    get:
+      x-teadal-policies:
+        deny-policies:
+          - timeliness:
+              value:
+                - max: 1
+                  unit_of_measure: centuries
+`)
+	r, diagnostics := parser.ParseOpenAPIPolicies(spec)
+	if r != nil {
+		t.Errorf("Expected no policies for an invalid spec, got %v", r)
+	}
+	want := parser.Diagnostics{
+		{Severity: parser.SeverityWarning, Message: `unknown policy type "users", ignored as the extension declares no version, declare it to make unknown keys errors`, Pointer: "/paths/~1orders/x-teadal-policies/access-policies/1/users", Line: 13, Column: 11},
+		{Severity: parser.SeverityError, Message: `unsupported call unit of measure "call_per_hour"`, Pointer: "/paths/~1orders/x-teadal-policies/access-policies/0", Line: 9, Column: 11},
+		{Severity: parser.SeverityError, Message: `unsupported timeliness unit of measure "centuries"`, Pointer: "/paths/~1orders/get/x-teadal-policies/deny-policies/0", Line: 18, Column: 13},
+	}
+	if len(diagnostics) != len(want) {
+		t.Fatalf("got diagnostics %v, want %v", diagnostics, want)
+	}
+	for i := range want {
+		if diagnostics[i] != want[i] {
+			t.Errorf("diagnostic %d: got %v, want %v", i, diagnostics[i], want[i])
+		}
+	}
+}
+
+func TestParseUnknownClauseKey(t *testing.T) {
+	cwd, _ := os.Getwd()
+	cwd = strings.Split(cwd, "/internal")[0]
+	os.Chdir(cwd)
+
+	// Unknown keys of the clauses of the extensions declaring their version are refused
+	file, err := os.ReadFile("./testdata/schemas/unknown-keys.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read OpenAPI file: %v", err)
+	}
+	r, diagnostics := parser.ParseOpenAPIPolicies(file)
+	if r != nil {
+		t.Errorf("Expected the clauses with unknown keys to be rejected, got %v", r)
+	}
+	pointers := make([]string, 0)
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == parser.SeverityError {
+			pointers = append(pointers, diagnostic.Pointer)
+		}
+	}
+	want := []string{
+		"/paths/x-teadal-policies/access-policies/0/roles/operation",
+		"/paths/~1orders/get/x-teadal-policies/access-policies/0/users",
+		"/paths/~1orders/get/x-teadal-policies/access-policies/1/call/value/0/min",
+	}
+	if !slices.Equal(pointers, want) {
+		t.Errorf("Expected errors at %v, got %v", want, diagnostics)
+	}
+
+	// The ones of the existing specs, without version, are reported as warnings
+	file, err = os.ReadFile("./testdata/schemas/httpbin-api.json")
+	if err != nil {
+		t.Fatalf("Failed to read OpenAPI file: %v", err)
+	}
+	r, diagnostics = parser.ParseOpenAPIPolicies(file)
+	if err := diagnostics.Err(); err != nil || r == nil {
+		t.Fatalf("Failed to parse OpenAPI spec: %v", err)
+	}
+	warnings := 0
+	for _, diagnostic := range diagnostics {
+		if strings.Contains(diagnostic.Message, "declare it to make unknown keys errors") {
+			warnings++
+		}
+	}
+	if warnings == 0 {
+		t.Errorf("Expected warnings for the unknown keys, got %v", diagnostics)
+	}
+}
+
+func TestParseMalformedSpec(t *testing.T) {
+	for name, spec := range map[string]string{
+		"invalid YAML":  "openapi: 3.0.0\npaths: [",
+		"not OpenAPI":   "swagger: '1.0'\n",
+		"empty":         "",
+		"missing ref":   "openapi: 3.0.0\ninfo:\n  title: test\n  version: 1.0.0\npaths:\n  /a:\n    get:\n      responses:\n        '200':\n          $ref: '#/components/responses/missing'\n",
+		"no components": "openapi: 3.0.0\ninfo:\n  title: test\n  version: 1.0.0\npaths: {}\n",
+	} {
+		if _, diagnostics := parser.ParseOpenAPIPolicies([]byte(spec)); name != "no components" && !diagnostics.HasErrors() {
+			t.Errorf("Expected policies errors for %s, got %v", name, diagnostics)
+		}
+		if _, diagnostics := parser.ParseOpenAPIIAM([]byte(spec)); !diagnostics.HasErrors() {
+			t.Errorf("Expected IAM errors for %s, got %v", name, diagnostics)
+		}
+	}
+}
+
+func TestParseSwagger2(t *testing.T) {
+	spec := []byte(`swagger: "2.0"
+info:
+  title: test
+  version: 1.0.0
+x-teadal-policy-definitions:
+  doctors:
+    roles:
+      value: [doctor]
+securityDefinitions:
+  bearerAuth:
+    type: apiKey
+    in: header
+    name: Authorization
+    x-teadal-IAM-provider: http://localhost/keycloak
+paths:
+  x-teadal-policies:
+    access-policies:
+      - use: doctors
+  /patients/{id}:
+    x-teadal-policies:
+      policies:
+        - path_params:
+            value:
+              id: preferred_username
+    get:
+      x-teadal-policies:
+        deny-policies:
+          - user:
+              value: [mallory]
+      responses:
+        "200":
+          description: OK
+`)
+	r, diagnostics := parser.ParseOpenAPIPolicies(spec)
+	if err := diagnostics.Err(); err != nil {
+		t.Fatalf("Failed to parse Swagger spec: %v", err)
+	}
+	if len(r.Policies) != 1 || r.Policies[0].Use != "doctors" || r.Definitions["doctors"].RolePolicy == nil {
+		t.Errorf("Expected the general policies to use the doctors definition, got %v", r.Policies)
+	}
+	path, ok := r.SpecializedPaths["/patients/{id}"]
+	if !ok || len(path.Policies) != 1 || path.Policies[0].PathParamsPolicy == nil {
+		t.Fatalf("Expected path policies for /patients/{id}, got %v", r.SpecializedPaths)
+	}
+	if len(path.SpecializedMethods["get"].Deny) != 1 {
+		t.Errorf("Expected deny policies for get, got %v", path.SpecializedMethods)
+	}
+
+	urls, diagnostics := parser.ParseOpenAPIIAM(spec)
+	if err := diagnostics.Err(); err != nil {
+		t.Fatalf("Failed to parse Swagger IAM provider: %v", err)
+	}
+	if len(urls) != 1 || urls[0] != "http://localhost/keycloak" {
+		t.Errorf("Expected IAM provider http://localhost/keycloak, got %v", urls)
+	}
+}
+
+func TestParseOpenAPI31(t *testing.T) {
+	spec := []byte(`openapi: 3.1.0
+info:
+  title: test
+  version: 1.0.0
+paths:
+  /orders:
+    $ref: '#/components/pathItems/Orders'
+webhooks:
+  newOrder:
+    post:
+      x-teadal-policies:
+        access-policies:
+          - user:
+              value: [alice]
+      responses:
+        "200":
+          description: OK
+components:
+  pathItems:
+    Orders:
+      get:
+        x-teadal-policies:
+          access-policies:
+            - roles:
+                value: [clerk]
+        responses:
+          "200":
+            description: OK
+`)
+	r, diagnostics := parser.ParseOpenAPIPolicies(spec)
+	if err := diagnostics.Err(); err != nil {
+		t.Fatalf("Failed to parse OpenAPI 3.1 spec: %v", err)
+	}
+	method, ok := r.SpecializedPaths["/orders"].SpecializedMethods["get"]
+	if !ok || len(method.Policies) != 1 || method.Policies[0].RolePolicy == nil {
+		t.Errorf("Expected the policies of the referenced path item, got %v", r.SpecializedPaths)
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Pointer != "/webhooks/newOrder/post/x-teadal-policies" {
+		t.Errorf("Expected a warning for the webhook policies, got %v", diagnostics)
+	}
+}
+
+func TestParseIAMProviders(t *testing.T) {
+	spec := []byte(`openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths: {}
+components:
+  securitySchemes:
+    keycloak:
+      type: http
+      scheme: Bearer
+      x-teadal-IAM-provider: http://keycloak/realms/teadal/.well-known/openid-configuration
+    partner:
+      type: openIdConnect
+      openIdConnectUrl: https://partner.example.com/.well-known/openid-configuration
+    oauth:
+      type: oauth2
+      flows:
+        clientCredentials:
+          tokenUrl: http://keycloak/realms/teadal/protocol/openid-connect/token
+          scopes: {}
+      x-teadal-IAM-provider: http://keycloak/realms/teadal/.well-known/openid-configuration
+    unknownProvider:
+      type: oauth2
+      flows:
+        clientCredentials:
+          tokenUrl: http://other/token
+          scopes: {}
+    apiKey:
+      type: apiKey
+      in: header
+      name: X-API-Key
+`)
+	urls, diagnostics := parser.ParseOpenAPIIAM(spec)
+	if err := diagnostics.Err(); err != nil {
+		t.Fatalf("Failed to parse IAM providers: %v", err)
+	}
+	want := []string{
+		"http://keycloak/realms/teadal/.well-known/openid-configuration",
+		"https://partner.example.com/.well-known/openid-configuration",
+	}
+	if !slices.Equal(urls, want) {
+		t.Errorf("got providers %v, want %v", urls, want)
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Pointer != "/components/securitySchemes/unknownProvider" {
+		t.Errorf("Expected a warning for the scheme without provider, got %v", diagnostics)
+	}
+
+	noProvider := []byte(`openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+paths: {}
+components:
+  securitySchemes:
+    basic:
+      type: http
+      scheme: basic
+`)
+	if _, diagnostics := parser.ParseOpenAPIIAM(noProvider); !diagnostics.HasErrors() {
+		t.Errorf("Expected error for a spec without providers, got %v", diagnostics)
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	spec := []byte(`openapi: 3.0.0
+info:
+  title: test
+  version: 1.0.0
+security:
+  - oauth: [read:drugs]
+paths:
+  /drugs:
+    get:
+      responses:
+        "200":
+          description: OK
+    post:
+      security:
+        - oauth: [write:drugs, read:drugs]
+          bearer: []
+        - oidc: [admin]
+      responses:
+        "200":
+          description: OK
+  /public:
+    get:
+      security: []
+      responses:
+        "200":
+          description: OK
+  /optional:
+    get:
+      security:
+        - oauth: [read:drugs]
+        - {}
+      responses:
+        "200":
+          description: OK
+  /bearer:
+    get:
+      security:
+        - bearer: []
+        - missing: [read:drugs]
+      responses:
+        "200":
+          description: OK
+components:
+  securitySchemes:
+    bearer:
+      type: http
+      scheme: bearer
+    oidc:
+      type: openIdConnect
+      openIdConnectUrl: http://keycloak/.well-known/openid-configuration
+    oauth:
+      type: oauth2
+      flows:
+        clientCredentials:
+          tokenUrl: http://keycloak/token
+          scopes:
+            read:drugs: Read drugs
+            write:drugs: Write drugs
+`)
+	r, diagnostics := parser.ParseOpenAPIPolicies(spec)
+	if err := diagnostics.Err(); err != nil {
+		t.Fatalf("Failed to parse OpenAPI spec: %v", err)
+	}
+	want := []policy.ScopeRequirement{
+		{Path: "/drugs", Method: "get", Alternatives: [][]string{{"read:drugs"}}},
+		{Path: "/drugs", Method: "post", Alternatives: [][]string{{"read:drugs", "write:drugs"}, {"admin"}}},
+	}
+	if !reflect.DeepEqual(r.Scopes, want) {
+		t.Errorf("got scopes %v, want %v", r.Scopes, want)
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Pointer != "/paths/~1bearer/get/security/1/missing" {
+		t.Errorf("Expected a warning for the undefined security scheme, got %v", diagnostics)
+	}
+}
+
+func TestParseRoute(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		want     *parser.Route
+		warnings int
+	}{
+		{
+			name: "no servers",
+			spec: "openapi: 3.0.0\ninfo: {title: test, version: 1.0.0}\npaths: {}\n",
+		},
+		{
+			name: "absolute url",
+			spec: "openapi: 3.0.0\ninfo: {title: test, version: 1.0.0}\npaths: {}\nservers:\n  - url: http://Medicine01.teadal.eu/fdp-medicine-node01/\n",
+			want: &parser.Route{PathPrefix: "/fdp-medicine-node01", Hosts: []string{"medicine01.teadal.eu"}},
+		},
+		{
+			name: "root url",
+			spec: "openapi: 3.0.0\ninfo: {title: test, version: 1.0.0}\npaths: {}\nservers:\n  - url: https://fdp.aquaview.ch\n",
+			want: &parser.Route{PathPrefix: "", Hosts: []string{"fdp.aquaview.ch"}},
+		},
+		{
+			name: "relative url",
+			spec: "openapi: 3.0.0\ninfo: {title: test, version: 1.0.0}\npaths: {}\nservers:\n  - url: /sfdp-amts-gtfs-static\n",
+			want: &parser.Route{PathPrefix: "/sfdp-amts-gtfs-static"},
+		},
+		{
+			name: "server variables",
+			spec: `openapi: 3.0.0
+info: {title: test, version: 1.0.0}
+paths: {}
+servers:
+  - url: https://{region}.teadal.eu/{base}
+    variables:
+      region: {default: eu}
+      base: {default: api/v1}
+`,
+			want: &parser.Route{PathPrefix: "/api/v1", Hosts: []string{"eu.teadal.eu"}},
+		},
+		{
+			name: "several hosts, different base paths",
+			spec: `openapi: 3.0.0
+info: {title: test, version: 1.0.0}
+paths: {}
+servers:
+  - url: https://a.teadal.eu/api
+  - url: https://b.teadal.eu/api
+  - url: https://c.teadal.eu/other
+`,
+			want:     &parser.Route{PathPrefix: "/api", Hosts: []string{"a.teadal.eu", "b.teadal.eu"}},
+			warnings: 1,
+		},
+		{
+			name: "swagger host and base path",
+			spec: "swagger: '2.0'\ninfo: {title: test, version: 1.0.0}\nhost: petstore.teadal.eu:8080\nbasePath: /v2\npaths: {}\n",
+			want: &parser.Route{PathPrefix: "/v2", Hosts: []string{"petstore.teadal.eu"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			route, diagnostics := parser.ParseOpenAPIRoute([]byte(test.spec))
+			if err := diagnostics.Err(); err != nil {
+				t.Fatalf("Failed to parse route: %v", err)
+			}
+			if len(diagnostics) != test.warnings {
+				t.Errorf("Expected %d warnings, got %v", test.warnings, diagnostics)
+			}
+			if !reflect.DeepEqual(route, test.want) {
+				t.Errorf("Expected route %+v, got %+v", test.want, route)
+			}
+		})
+	}
+}
+
+func TestParseService(t *testing.T) {
+	spec := `openapi: 3.0.0
+info: {title: test, version: 1.0.0}
+servers:
+  - url: https://api.teadal.eu/orders
+components:
+  securitySchemes:
+    oidc:
+      type: openIdConnect
+      openIdConnectUrl: https://iam.teadal.eu/realms/teadal/.well-known/openid-configuration
+paths:
+  x-teadal-policies:
+    access-policies:
+      - roles:
+          value: [clerk]
+  /orders:
+    get:
+      responses:
+        '200':
+          description: ok
+`
+	service, diagnostics := parser.ParseOpenAPIService([]byte(spec))
+	if err := diagnostics.Err(); err != nil {
+		t.Fatalf("Failed to parse OpenAPI spec: %v", err)
+	}
+	if len(service.Policies.Policies) != 1 || service.Policies.Policies[0].RolePolicy == nil {
+		t.Errorf("Unexpected policies %v", service.Policies.Policies)
+	}
+	if !reflect.DeepEqual(service.Providers, []string{"https://iam.teadal.eu/realms/teadal/.well-known/openid-configuration"}) {
+		t.Errorf("Unexpected providers %v", service.Providers)
+	}
+	if !reflect.DeepEqual(service.Route, &parser.Route{PathPrefix: "/orders", Hosts: []string{"api.teadal.eu"}}) {
+		t.Errorf("Unexpected route %v", service.Route)
+	}
+
+	// The problems of the document itself are reported once, not once for each part extracted from it
+	broken := []byte(strings.Replace(spec, "description: ok", "$ref: '#/components/responses/missing'", 1))
+	_, documentDiagnostics := parser.ParseOpenAPIRoute(broken)
+	if !documentDiagnostics.HasErrors() {
+		t.Fatalf("Expected document errors, got %v", documentDiagnostics)
+	}
+	service, diagnostics = parser.ParseOpenAPIService(broken)
+	if service != nil {
+		t.Errorf("Expected no service for a spec with errors, got %v", service)
+	}
+	for _, documentDiagnostic := range documentDiagnostics {
+		count := 0
+		for _, diagnostic := range diagnostics {
+			if diagnostic == documentDiagnostic {
+				count++
+			}
+		}
+		if count != 1 {
+			t.Errorf("Expected %q to be reported once, got %d times in %v", documentDiagnostic, count, diagnostics)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"dspn-regogenerator/internal/policy"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Version 1 of the x-teadal-policies extension holds the access clauses in policies
+	XTeadalPoliciesV1 = "1"
+	// Version 2 of the x-teadal-policies extension holds the access clauses in access-policies and the deny clauses in deny-policies
+	XTeadalPoliciesV2 = "2"
+)
+
+// xTeadalPoliciesKeys lists the keys of the x-teadal-policies extension for each version.
+var xTeadalPoliciesKeys = map[string][]string{
+	XTeadalPoliciesV1: {"version", "description", "policies"},
+	XTeadalPoliciesV2: {"version", "description", "access-policies", "deny-policies"},
+}
+
+// clauseKeys lists the policy types and nested clauses of a policy clause.
+var clauseKeys = []string{"user", "roles", "storage_location", "call", "timeliness", "path_params", "claims", "all_of", "any_of", "not", "use", "$ref"}
+
+// policyKeys lists the keys of each policy type, and the keys of the items of its value when it is a list.
+var policyKeys = map[string]struct {
+	keys      []string
+	valueKeys []string
+}{
+	"user":             {keys: []string{"value", "operator"}},
+	"roles":            {keys: []string{"value", "operator"}},
+	"storage_location": {keys: []string{"value", "operator"}},
+	"call":             {keys: []string{"value"}, valueKeys: []string{"max", "unit_of_measure"}},
+	"timeliness":       {keys: []string{"value"}, valueKeys: []string{"max", "min", "unit_of_measure"}},
+	"path_params":      {keys: []string{"value"}},
+	"claims":           {keys: []string{"value"}, valueKeys: []string{"claim", "operator", "value"}},
+}
+
+// JSONPointer returns the JSON pointer made of the given reference tokens, escaped as defined by RFC 6901.
+func JSONPointer(tokens ...string) string {
+	var pointer strings.Builder
+	for _, token := range tokens {
+		pointer.WriteString("/")
+		pointer.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(token))
+	}
+	return pointer.String()
+}
+
+// schemaChecker reports the keys of the extensions that are not part of their schema, which would be silently ignored by the decoder.
+// Unknown keys of the clauses are reported as errors to diagnostics, as ignoring them would drop a restriction and allow
+// more requests than intended, while the other unknown keys are reported as warnings.
+// The x-teadal-policies extensions without an explicit version, written before unknown keys were refused, keep being
+// accepted: the unknown keys of their clauses are reported as warnings telling how to make them errors.
+type schemaChecker struct {
+	diagnostics *Diagnostics
+	// unversioned is set while checking an x-teadal-policies extension without an explicit version
+	unversioned bool
+}
+
+// unversionedNote is added to the unknown keys of the clauses of the extensions without an explicit version.
+const unversionedNote = "ignored as the extension declares no version, declare it to make unknown keys errors"
+
+// clauseSeverity returns the severity of the unknown keys of the clauses, and the note added to their message.
+func (c *schemaChecker) clauseSeverity() (Severity, string) {
+	if c.unversioned {
+		return SeverityWarning, unversionedNote
+	}
+	return SeverityError, ""
+}
+
+// mapping returns the values of a mapping node by key, reporting the keys that are not known with the severity and
+// the note, if any.
+func (c *schemaChecker) mapping(node *yaml.Node, pointer string, known []string, kind string, severity Severity, note string) map[string]*yaml.Node {
+	values := make(map[string]*yaml.Node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return values
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if !slices.Contains(known, key) {
+			if note != "" {
+				c.diagnostics.add(severity, node.Content[i], pointer+JSONPointer(key), "unknown %s %q, %s", kind, key, note)
+			} else {
+				c.diagnostics.add(severity, node.Content[i], pointer+JSONPointer(key), "unknown %s %q", kind, key)
+			}
+			continue
+		}
+		values[key] = node.Content[i+1]
+	}
+	return values
+}
+
+func (c *schemaChecker) checkClauses(node *yaml.Node, pointer string) {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return
+	}
+	for i, clause := range node.Content {
+		c.checkClause(clause, pointer+JSONPointer(strconv.Itoa(i)))
+	}
+}
+
+func (c *schemaChecker) checkClause(node *yaml.Node, pointer string) {
+	severity, note := c.clauseSeverity()
+	fields := c.mapping(node, pointer, clauseKeys, "policy type", severity, note)
+	for _, key := range clauseKeys {
+		value, ok := fields[key]
+		if !ok {
+			continue
+		}
+		valuePointer := pointer + JSONPointer(key)
+		switch key {
+		case "all_of", "any_of":
+			c.checkClauses(value, valuePointer)
+		case "not":
+			c.checkClause(value, valuePointer)
+		case "use", "$ref":
+		default:
+			schema := policyKeys[key]
+			fields := c.mapping(value, valuePointer, schema.keys, "field", severity, note)
+			if items, ok := fields["value"]; ok && schema.valueKeys != nil && items.Kind == yaml.SequenceNode {
+				for i, item := range items.Content {
+					c.mapping(item, valuePointer+JSONPointer("value", strconv.Itoa(i)), schema.valueKeys, "field", severity, note)
+				}
+			}
+		}
+	}
+}
+
+// decodeXTeadalPolicies decodes an x-teadal-policies extension, located at pointer, according to its version.
+// Without an explicit version, extensions with the policies key are version 1 and the others version 2.
+func (c *schemaChecker) decodeXTeadalPolicies(node *yaml.Node, pointer string) (*XTeadalPolicies, error) {
+	decoded := new(XTeadalPolicies)
+	if err := node.Decode(decoded); err != nil {
+		return nil, err
+	}
+	c.unversioned = decoded.Version == ""
+	defer func() { c.unversioned = false }()
+	if decoded.Version == "" {
+		decoded.Version = XTeadalPoliciesV2
+		if decoded.LegacyPolicies != nil {
+			if decoded.Policies != nil {
+				return nil, fmt.Errorf("both policies and access-policies found, set the version to choose one")
+			}
+			decoded.Version = XTeadalPoliciesV1
+		}
+	}
+	keys, ok := xTeadalPoliciesKeys[decoded.Version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported %s version %q", XTeadalPoliciesKey, decoded.Version)
+	}
+	fields := c.mapping(node, pointer, keys, "field", SeverityWarning, "")
+	switch decoded.Version {
+	case XTeadalPoliciesV1:
+		decoded.Policies = decoded.LegacyPolicies
+		decoded.Deny = nil
+		c.checkClauses(fields["policies"], pointer+JSONPointer("policies"))
+	case XTeadalPoliciesV2:
+		c.checkClauses(fields["access-policies"], pointer+JSONPointer("access-policies"))
+		c.checkClauses(fields["deny-policies"], pointer+JSONPointer("deny-policies"))
+	}
+	decoded.LegacyPolicies = nil
+	return decoded, nil
+}
+
+// decodeDefinitions decodes the policy definitions extension, located at pointer.
+func (c *schemaChecker) decodeDefinitions(node *yaml.Node, pointer string) (map[string]policy.PolicyClause, error) {
+	definitions := make(map[string]policy.PolicyClause)
+	if err := node.Decode(&definitions); err != nil {
+		return nil, err
+	}
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			c.checkClause(node.Content[i+1], pointer+JSONPointer(node.Content[i].Value))
+		}
+	}
+	return definitions, nil
+}
@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSchemaCheckerUnknownKeys(t *testing.T) {
+	extension := `
+description: test
+access-policies:
+  - users:
+      value: [alice]
+  - roles:
+      value: [admin]
+      operation: AND
+    call:
+      value:
+        - min: 5
+          unit_of_measure: call_per_day
+  - any_of:
+      - storage-location:
+          value: [Italy]
+extra: true
+`
+	unversioned := ", " + unversionedNote
+	tests := []struct {
+		name      string
+		extension string
+		want      []Diagnostic
+	}{
+		{
+			name:      "unversioned",
+			extension: extension,
+			want: []Diagnostic{
+				{SeverityWarning, `unknown field "extra"`, "/paths/x-teadal-policies/extra", 16, 1},
+				{SeverityWarning, `unknown policy type "users"` + unversioned, "/paths/x-teadal-policies/access-policies/0/users", 4, 5},
+				{SeverityWarning, `unknown field "operation"` + unversioned, "/paths/x-teadal-policies/access-policies/1/roles/operation", 8, 7},
+				{SeverityWarning, `unknown field "min"` + unversioned, "/paths/x-teadal-policies/access-policies/1/call/value/0/min", 11, 11},
+				{SeverityWarning, `unknown policy type "storage-location"` + unversioned, "/paths/x-teadal-policies/access-policies/2/any_of/0/storage-location", 14, 9},
+			},
+		},
+		{
+			name:      "versioned",
+			extension: extension + "version: \"2\"\n",
+			want: []Diagnostic{
+				{SeverityWarning, `unknown field "extra"`, "/paths/x-teadal-policies/extra", 16, 1},
+				{SeverityError, `unknown policy type "users"`, "/paths/x-teadal-policies/access-policies/0/users", 4, 5},
+				{SeverityError, `unknown field "operation"`, "/paths/x-teadal-policies/access-policies/1/roles/operation", 8, 7},
+				{SeverityError, `unknown field "min"`, "/paths/x-teadal-policies/access-policies/1/call/value/0/min", 11, 11},
+				{SeverityError, `unknown policy type "storage-location"`, "/paths/x-teadal-policies/access-policies/2/any_of/0/storage-location", 14, 9},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var node yaml.Node
+			if err := yaml.Unmarshal([]byte(test.extension), &node); err != nil {
+				t.Fatalf("Failed to parse YAML: %v", err)
+			}
+			var diagnostics Diagnostics
+			checker := &schemaChecker{diagnostics: &diagnostics}
+			if _, err := checker.decodeXTeadalPolicies(node.Content[0], "/paths/x-teadal-policies"); err != nil {
+				t.Fatalf("Failed to decode extension: %v", err)
+			}
+			if len(diagnostics) != len(test.want) {
+				t.Fatalf("got diagnostics %v, want %v", diagnostics, test.want)
+			}
+			for i := range test.want {
+				if diagnostics[i] != test.want[i] {
+					t.Errorf("diagnostic %d: got %v, want %v", i, diagnostics[i], test.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Route is where the gateway routes the requests of a service, as declared by the servers of its spec.
+type Route struct {
+	// PathPrefix is the base path of the servers, without trailing slash and empty if they are served at the root
+	PathPrefix string
+	// Hosts holds the lower case host names of the servers with an absolute url
+	Hosts []string
+}
+
+// specServer is a server url with its variables replaced by their default values, located at pointer.
+type specServer struct {
+	url     string
+	pointer string
+}
+
+// ParseOpenAPIRoute returns the route of the service declared by the servers of the spec, or by the host and basePath
+// of a Swagger 2.0 spec. It returns nil if the spec declares no servers.
+// Servers with a different base path than the first one are reported as warnings, as only one prefix is matched.
+func ParseOpenAPIRoute(specByteArray []byte) (*Route, Diagnostics) {
+	var diagnostics Diagnostics
+	doc := getDocumentFromData(specByteArray, &diagnostics)
+	if doc == nil {
+		return nil, diagnostics
+	}
+	return doc.route(&diagnostics), diagnostics
+}
+
+// route returns the route declared by the servers of the document, adding the problems found to diagnostics.
+func (doc *specDocument) route(diagnostics *Diagnostics) *Route {
+	var route *Route
+	for _, server := range doc.servers {
+		if strings.ContainsAny(server.url, "{}") {
+			diagnostics.warnf(nil, server.pointer, "server url %q has undefined variables, the server is ignored", server.url)
+			continue
+		}
+		u, err := url.Parse(server.url)
+		if err != nil {
+			diagnostics.warnf(nil, server.pointer, "invalid server url, the server is ignored: %v", err)
+			continue
+		}
+		prefix := strings.TrimRight(u.Path, "/")
+		if prefix != "" && !strings.HasPrefix(prefix, "/") {
+			prefix = "/" + prefix
+		}
+		if route == nil {
+			route = &Route{PathPrefix: prefix}
+		} else if prefix != route.PathPrefix {
+			diagnostics.warnf(nil, server.pointer, "server base path %q differs from %q, only the first one is matched", prefix, route.PathPrefix)
+			continue
+		}
+		if host := strings.ToLower(u.Hostname()); host != "" && !slices.Contains(route.Hosts, host) {
+			route.Hosts = append(route.Hosts, host)
+		}
+	}
+	return route
+}
+
+// resolveServerURL replaces the variables of a server url by their default values.
+func resolveServerURL(serverURL string, defaults map[string]string) string {
+	for name, value := range defaults {
+		serverURL = strings.ReplaceAll(serverURL, "{"+name+"}", value)
+	}
+	return serverURL
+}
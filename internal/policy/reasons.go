@@ -0,0 +1,200 @@
+package policy
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// ReasonsRuleName is the name of the set collecting the human readable reasons of the decision.
+const ReasonsRuleName = "reasons"
+
+// ReasonRules returns the rules adding a human readable message to the reasons set, e.g. "role doctors required on
+// GET /drugs". When the request is not allowed, each failed check of the access clauses applying to the requested
+// operation adds a message, as well as the operations of paths with no access clause for the requested method.
+// Each deny clause and each scope requirement applying to the operation adds a message when it denies the request.
+// The messages of general clauses report the requested method and path, the others the OpenAPI operation.
+func (p *GeneralPolicies) ReasonRules() ([]*ast.Rule, error) {
+	// Generate the policy rules first, so that the helpers are named as in the rules returned by Rules
+	helpers := NewHelpers()
+	helpers.definitions = p.Definitions
+	if _, err := p.policyRules(helpers); err != nil {
+		return nil, err
+	}
+	rules := make([]*ast.Rule, 0)
+	for i, clause := range p.Policies {
+		clauseRules, err := accessReasonRules(&clause, helpers, nil, "", "")
+		if err != nil {
+			return nil, fmt.Errorf("general clause %d: %v", i, err)
+		}
+		rules = append(rules, clauseRules...)
+	}
+	for i, clause := range p.Deny {
+		rule, err := denyReasonRule(&clause, helpers, nil, "", "")
+		if err != nil {
+			return nil, fmt.Errorf("general deny: clause %d: %v", i, err)
+		}
+		rules = append(rules, rule)
+	}
+	accessPaths := p.accessPaths()
+	for _, key := range slices.Sorted(maps.Keys(p.SpecializedPaths)) {
+		path := p.SpecializedPaths[key]
+		path.siblings = exactSiblings(path.Path, accessPaths)
+		pathRules, err := path.reasonRules(helpers)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, pathRules...)
+	}
+	for _, requirement := range p.Scopes {
+		rules = append(rules, requirement.ReasonRule())
+	}
+	return rules, nil
+}
+
+// ReasonsToRego converts the reason rules of the policies to formatted Rego source.
+func (p *GeneralPolicies) ReasonsToRego() (string, error) {
+	rules, err := p.ReasonRules()
+	if err != nil {
+		return "", err
+	}
+	return FormatRules(rules)
+}
+
+// reasonRules returns the reason rules of the access and deny clauses of the path and of its methods, excluding the
+// exact sibling paths of a templated path as its access and deny rules do.
+func (p *PathPolicies) reasonRules(helpers *Helpers) ([]*ast.Rule, error) {
+	rules := make([]*ast.Rule, 0)
+	pathCode := append(PathCondition(p.Path), pathExclusion(p.siblings)...)
+	for i, clause := range p.Policies {
+		clauseRules, err := accessReasonRules(&clause, helpers, pathCode, p.Path, "")
+		if err != nil {
+			return nil, fmt.Errorf("path %s: clause %d: %v", p.Path, i, err)
+		}
+		rules = append(rules, clauseRules...)
+	}
+	specializedMethods := p.accessMethods()
+	if len(p.Policies) == 0 && len(specializedMethods) > 0 {
+		// A path with only specialized methods allows just those methods
+		rules = append(rules, newReasonRule(reasonMessage("no access policy", p.Path, ""),
+			[]*ast.Expr{ast.NewExpr(ast.VarTerm(AllowRuleName)).Complement(), pathMatch(p.Path)},
+			pathExclusion(p.siblings),
+			[]*ast.Expr{ast.Member.Expr(ast.VarTerm("method"), stringArrayTerm(specializedMethods)).Complement()},
+		))
+	}
+	for i, clause := range p.Deny {
+		rule, err := denyReasonRule(&clause, helpers, pathCode, p.Path, "")
+		if err != nil {
+			return nil, fmt.Errorf("path %s deny: clause %d: %v", p.Path, i, err)
+		}
+		rules = append(rules, rule)
+	}
+	for _, method := range slices.Sorted(maps.Keys(p.SpecializedMethods)) {
+		methodPolicies := p.SpecializedMethods[method]
+		methodCode := NewBody(pathCode, []*ast.Expr{ast.Equal.Expr(ast.VarTerm("method"), ast.StringTerm(method))})
+		for i, clause := range methodPolicies.Policies {
+			clauseRules, err := accessReasonRules(&clause, helpers, methodCode, p.Path, method)
+			if err != nil {
+				return nil, fmt.Errorf("path %s: method %s: clause %d: %v", p.Path, method, i, err)
+			}
+			rules = append(rules, clauseRules...)
+		}
+		for i, clause := range methodPolicies.Deny {
+			rule, err := denyReasonRule(&clause, helpers, methodCode, p.Path, method)
+			if err != nil {
+				return nil, fmt.Errorf("path %s: method %s deny: clause %d: %v", p.Path, method, i, err)
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// ReasonRule returns the rule adding the scopes required by the operation to the reasons when they are not granted.
+func (r *ScopeRequirement) ReasonRule() *ast.Rule {
+	alternatives := make([]string, 0, len(r.Alternatives))
+	for _, scopes := range r.Alternatives {
+		if len(r.Alternatives) > 1 && len(scopes) > 1 {
+			alternatives = append(alternatives, "("+joinValues(scopes, OperatorAnd)+")")
+		} else {
+			alternatives = append(alternatives, joinValues(scopes, OperatorAnd))
+		}
+	}
+	description := "OAuth2 scopes " + strings.Join(alternatives, " or ") + " required"
+	return newReasonRule(reasonMessage(description, r.Path, r.Method), []*ast.Expr{
+		pathMatch(r.Path),
+		ast.Equal.Expr(ast.VarTerm("method"), ast.StringTerm(r.Method)),
+		ast.NewExpr(ast.VarTerm(ScopesGrantedRuleName)).Complement(),
+	})
+}
+
+// accessReasonRules returns one reason rule for each expression of each check of an access clause, true when the
+// request is not allowed, the operation condition holds and the expression does not.
+func accessReasonRules(clause *PolicyClause, helpers *Helpers, operation []*ast.Expr, path string, method string) ([]*ast.Rule, error) {
+	checks, err := clause.checks(helpers)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]*ast.Rule, 0, len(checks))
+	for _, check := range checks {
+		message := reasonMessage(check.description+" required", path, method)
+		for _, expr := range check.exprs {
+			rules = append(rules, newReasonRule(message, []*ast.Expr{ast.NewExpr(ast.VarTerm(AllowRuleName)).Complement()}, operation, []*ast.Expr{expr.Complement()}))
+		}
+	}
+	return rules, nil
+}
+
+// denyReasonRule returns the reason rule of a deny clause, true when the operation condition and the clause hold.
+func denyReasonRule(clause *PolicyClause, helpers *Helpers, operation []*ast.Expr, path string, method string) (*ast.Rule, error) {
+	exprs, err := clause.ToRego(helpers)
+	if err != nil {
+		return nil, err
+	}
+	description := "request denied"
+	if len(exprs) > 0 {
+		description += " to " + clause.Describe()
+	}
+	return newReasonRule(reasonMessage(description, path, method), operation, exprs), nil
+}
+
+// reasonMessage returns the message of a reason on an operation, e.g. "role doctors required on GET /drugs".
+// If the path or the method are empty, the message reports the requested ones with sprintf.
+func reasonMessage(description string, path string, method string) *ast.Term {
+	if path != "" && method != "" {
+		return ast.StringTerm(description + " on " + strings.ToUpper(method) + " " + path)
+	}
+	escape := strings.NewReplacer("%", "%%")
+	args := make([]*ast.Term, 0, 2)
+	format := escape.Replace(description) + " on "
+	if method == "" {
+		format += "%s"
+		args = append(args, ast.Upper.Call(ast.VarTerm("method")))
+	} else {
+		format += escape.Replace(strings.ToUpper(method))
+	}
+	if path == "" {
+		format += " %s"
+		args = append(args, ast.VarTerm("path"))
+	} else {
+		format += " " + escape.Replace(path)
+	}
+	return ast.Sprintf.Call(ast.StringTerm(format), ast.ArrayTerm(args...))
+}
+
+// newReasonRule returns a rule adding the message to the reasons set when the body is satisfied. Messages built from
+// the request are bound to msg at the end of the body.
+func newReasonRule(message *ast.Term, exprs ...[]*ast.Expr) *ast.Rule {
+	key := message
+	if _, ok := message.Value.(ast.String); !ok {
+		key = ast.VarTerm("msg")
+		exprs = append(exprs, []*ast.Expr{ast.Assign.Expr(key, message)})
+	}
+	body := NewBody(exprs...)
+	head := ast.NewHead(ast.Var(ReasonsRuleName), key)
+	head.Reference = ast.Ref{ast.VarTerm(ReasonsRuleName)}
+	return &ast.Rule{Head: head, Body: body}
+}
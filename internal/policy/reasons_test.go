@@ -0,0 +1,160 @@
+package policy_test
+
+import (
+	"dspn-regogenerator/internal/policy"
+	"testing"
+)
+
+func TestReasonRules(t *testing.T) {
+	roleA := policy.PolicyClause{
+		RolePolicy: &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"A"}}},
+	}
+	roleB := policy.PolicyClause{
+		RolePolicy: &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"B"}}},
+	}
+	tests := []struct {
+		name string
+		pol  *policy.GeneralPolicies
+		want string
+	}{
+		{
+			name: "general clause",
+			pol: &policy.GeneralPolicies{
+				Policies: []policy.PolicyClause{
+					{
+						UserPolicy: &policy.UserPolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorAnd, Value: []string{"user1"}}},
+						CallPolicy: &policy.CallPolicy{Value: []policy.CallLimit{{Max: "100", UnitOfMeasure: policy.CallFrequencyDaily}}},
+					},
+				},
+			},
+			want: "reasons contains msg if {\n\tnot allow_request\n\tnot user == \"user1\"\n\tmsg := sprintf(\"user user1 required on %s %s\", [upper(method), path])\n}\n\n" +
+				"reasons contains msg if {\n\tnot allow_request\n\tnot call_count(\"call_per_day\") < 100\n\tmsg := sprintf(\"fewer than 100 calls per day required on %s %s\", [upper(method), path])\n}\n",
+		},
+		{
+			name: "method clause",
+			pol: &policy.GeneralPolicies{
+				SpecializedPaths: map[string]policy.PathPolicies{
+					"/drugs": {
+						Path: "/drugs",
+						SpecializedMethods: map[string]policy.PathMethodPolicies{
+							"get": {Method: "get", Policies: []policy.PolicyClause{{RolePolicy: &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"doctors"}}}}}},
+						},
+					},
+				},
+			},
+			want: "reasons contains msg if {\n\tnot allow_request\n\tpath == \"/drugs\"\n\tnot method in [\"get\"]\n\tmsg := sprintf(\"no access policy on %s /drugs\", [upper(method)])\n}\n\n" +
+				"reasons contains \"role doctors required on GET /drugs\" if {\n\tnot allow_request\n\tpath == \"/drugs\"\n\tmethod == \"get\"\n\tnot count({\"doctors\"} & roles) != 0\n}\n",
+		},
+		{
+			name: "nested clauses",
+			pol: &policy.GeneralPolicies{
+				SpecializedPaths: map[string]policy.PathPolicies{
+					"/items/{owner}": {
+						Path: "/items/{owner}",
+						Policies: []policy.PolicyClause{
+							{AnyOf: []policy.PolicyClause{roleA, {PathParamsPolicy: &policy.PathParamsPolicy{Value: map[string]string{"owner": "sub"}}}}, Not: &roleB},
+						},
+					},
+				},
+			},
+			want: "reasons contains msg if {\n\tnot allow_request\n\tglob.match(\"/items/?*\", [\"/\"], path)\n\tpath_params := {\"owner\": split(path, \"/\")[2]}\n\tnot any_of_1(path_params)\n" +
+				"\tmsg := sprintf(\"any of (role A) or (path parameter owner equal to claim sub) required on %s /items/{owner}\", [upper(method)])\n}\n\n" +
+				"reasons contains msg if {\n\tnot allow_request\n\tglob.match(\"/items/?*\", [\"/\"], path)\n\tpath_params := {\"owner\": split(path, \"/\")[2]}\n\tclause_1\n" +
+				"\tmsg := sprintf(\"not (role B) required on %s /items/{owner}\", [upper(method)])\n}\n",
+		},
+		{
+			name: "deny and scopes",
+			pol: &policy.GeneralPolicies{
+				Deny: []policy.PolicyClause{roleB},
+				SpecializedPaths: map[string]policy.PathPolicies{
+					"/admin": {
+						Path: "/admin",
+						SpecializedMethods: map[string]policy.PathMethodPolicies{
+							"delete": {Method: "delete", Deny: []policy.PolicyClause{{}}},
+						},
+					},
+				},
+				Scopes: []policy.ScopeRequirement{
+					{Path: "/drugs/{id}", Method: "delete", Alternatives: [][]string{{"admin"}, {"delete:drugs", "write:drugs"}}},
+				},
+			},
+			want: "reasons contains msg if {\n\tcount({\"B\"} & roles) != 0\n\tmsg := sprintf(\"request denied to role B on %s %s\", [upper(method), path])\n}\n\n" +
+				"reasons contains \"request denied on DELETE /admin\" if {\n\tpath == \"/admin\"\n\tmethod == \"delete\"\n}\n\n" +
+				"reasons contains \"OAuth2 scopes admin or (delete:drugs and write:drugs) required on DELETE /drugs/{id}\" if {\n\tglob.match(\"/drugs/?*\", [\"/\"], path)\n\tmethod == \"delete\"\n\tnot scopes_granted\n}\n",
+		},
+		{
+			name: "exact sibling of a templated path",
+			pol: &policy.GeneralPolicies{
+				SpecializedPaths: map[string]policy.PathPolicies{
+					"/items/{id}": {
+						Path:     "/items/{id}",
+						Policies: []policy.PolicyClause{roleA},
+						Deny:     []policy.PolicyClause{roleB},
+					},
+					"/items/export": {
+						Path:     "/items/export",
+						Policies: []policy.PolicyClause{roleB},
+					},
+				},
+			},
+			want: "reasons contains msg if {\n\tnot allow_request\n\tpath == \"/items/export\"\n\tnot count({\"B\"} & roles) != 0\n\tmsg := sprintf(\"role B required on %s /items/export\", [upper(method)])\n}\n\n" +
+				"reasons contains msg if {\n\tnot allow_request\n\tglob.match(\"/items/?*\", [\"/\"], path)\n\tpath_params := {\"id\": split(path, \"/\")[2]}\n\tnot path in [\"/items/export\"]\n" +
+				"\tnot count({\"A\"} & roles) != 0\n\tmsg := sprintf(\"role A required on %s /items/{id}\", [upper(method)])\n}\n\n" +
+				"reasons contains msg if {\n\tglob.match(\"/items/?*\", [\"/\"], path)\n\tpath_params := {\"id\": split(path, \"/\")[2]}\n\tnot path in [\"/items/export\"]\n" +
+				"\tcount({\"B\"} & roles) != 0\n\tmsg := sprintf(\"request denied to role B on %s /items/{id}\", [upper(method)])\n}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.pol.ReasonsToRego()
+			if err != nil {
+				t.Fatalf("ReasonsToRego() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPolicyClauseDescribe(t *testing.T) {
+	tests := []struct {
+		name string
+		pol  *policy.PolicyClause
+		want string
+	}{
+		{name: "empty", pol: &policy.PolicyClause{}, want: "any request"},
+		{
+			name: "policies",
+			pol: &policy.PolicyClause{
+				UserPolicy:            &policy.UserPolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"alice", "bob", "carol"}}},
+				RolePolicy:            &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorAnd, Value: []string{"doctors", "admins"}}},
+				StorageLocationPolicy: &policy.StorageLocationPolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"Europe"}}},
+				TimelinessPolicy:      &policy.TimelinessPolicy{Value: []policy.TimelinessLimit{{Max: "7", UnitOfMeasure: policy.StorageDurationDay}}},
+				ClaimsPolicy: &policy.ClaimsPolicy{Value: []policy.ClaimCondition{
+					{Claim: "organization.country", Operator: policy.ClaimOperatorEqual, Value: "Italy"},
+					{Claim: "level", Operator: policy.ClaimOperatorGreaterOrEqual, Value: 3},
+				}},
+			},
+			want: `user alice, bob or carol and roles doctors and admins and location in Europe and data at most 7 days old and ` +
+				`claim organization.country equal to "Italy" and claim level at least 3`,
+		},
+		{
+			name: "nested",
+			pol: &policy.PolicyClause{
+				Use: "management",
+				Not: &policy.PolicyClause{UserPolicy: &policy.UserPolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"mallory"}}}},
+			},
+			want: "policy management and not (user mallory)",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.pol.Describe(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
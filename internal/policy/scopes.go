@@ -0,0 +1,46 @@
+package policy
+
+import (
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+const (
+	// ScopesRequiredRuleName is the rule that is true if the requested operation requires OAuth2 scopes
+	ScopesRequiredRuleName = "scopes_required"
+	// ScopesGrantedRuleName is the rule that is true if the token is granted the scopes required by the requested operation
+	ScopesGrantedRuleName = "scopes_granted"
+)
+
+// ScopeRequirement holds the OAuth2 scopes required to call an operation, as declared by its security requirements.
+// The token must be granted all the scopes of at least one of the alternatives.
+type ScopeRequirement struct {
+	Path         string
+	Method       string
+	Alternatives [][]string
+	// siblings holds the exact paths matched by the templated path, which are excluded from its scope rules
+	siblings []string
+}
+
+// Rules returns the scopes_required rule matching the operation, and one scopes_granted rule for each alternative.
+// The scopes granted to the token are read from the token_scopes set defined by the service. Requests to the exact
+// sibling paths of a templated path resolve to the operations of those paths and are left to their own rules.
+func (r *ScopeRequirement) Rules() []*ast.Rule {
+	operation := []*ast.Expr{pathMatch(r.Path)}
+	operation = append(operation, pathExclusion(r.siblings)...)
+	operation = append(operation, ast.Equal.Expr(ast.VarTerm("method"), ast.StringTerm(r.Method)))
+	rules := []*ast.Rule{NewRule(ScopesRequiredRuleName, NewBody(operation))}
+	for _, scopes := range r.Alternatives {
+		rules = append(rules, NewRule(ScopesGrantedRuleName, NewBody(operation, []*ast.Expr{
+			setMatchExpr(scopes, OperatorAnd, ast.VarTerm("token_scopes")),
+		})))
+	}
+	return rules
+}
+
+// pathMatch returns the expression matching the request path against the OpenAPI path, without binding its parameters.
+func pathMatch(path string) *ast.Expr {
+	if !IsTemplatedPath(path) {
+		return ast.Equal.Expr(ast.VarTerm("path"), ast.StringTerm(path))
+	}
+	return pathGlobMatch(path)
+}
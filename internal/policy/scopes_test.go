@@ -0,0 +1,64 @@
+package policy_test
+
+import (
+	"dspn-regogenerator/internal/policy"
+	"testing"
+)
+
+func TestScopeRequirements(t *testing.T) {
+	tests := []generalTestCase{
+		{
+			name: "scopes only",
+			pol: &policy.GeneralPolicies{
+				Scopes: []policy.ScopeRequirement{
+					{Path: "/drugs", Method: "get", Alternatives: [][]string{{"read:drugs"}}},
+					{Path: "/drugs/{id}", Method: "delete", Alternatives: [][]string{{"admin"}, {"delete:drugs", "write:drugs"}}},
+				},
+			},
+			want: "scopes_required if {\n\tpath == \"/drugs\"\n\tmethod == \"get\"\n}\n\n" +
+				"scopes_granted if {\n\tpath == \"/drugs\"\n\tmethod == \"get\"\n\tcount({\"read:drugs\"} - token_scopes) == 0\n}\n\n" +
+				"scopes_required if {\n\tglob.match(\"/drugs/?*\", [\"/\"], path)\n\tmethod == \"delete\"\n}\n\n" +
+				"scopes_granted if {\n\tglob.match(\"/drugs/?*\", [\"/\"], path)\n\tmethod == \"delete\"\n\tcount({\"admin\"} - token_scopes) == 0\n}\n\n" +
+				"scopes_granted if {\n\tglob.match(\"/drugs/?*\", [\"/\"], path)\n\tmethod == \"delete\"\n\tcount({\"delete:drugs\", \"write:drugs\"} - token_scopes) == 0\n}\n",
+		},
+		{
+			name: "exact path matching a templated path",
+			pol: &policy.GeneralPolicies{
+				Scopes: []policy.ScopeRequirement{
+					{Path: "/items/{id}", Method: "get", Alternatives: [][]string{{"read"}}},
+					{Path: "/items/admin", Method: "get", Alternatives: [][]string{{"admin"}}},
+				},
+			},
+			want: "scopes_required if {\n\tglob.match(\"/items/?*\", [\"/\"], path)\n\tnot path in [\"/items/admin\"]\n\tmethod == \"get\"\n}\n\n" +
+				"scopes_granted if {\n\tglob.match(\"/items/?*\", [\"/\"], path)\n\tnot path in [\"/items/admin\"]\n\tmethod == \"get\"\n\tcount({\"read\"} - token_scopes) == 0\n}\n\n" +
+				"scopes_required if {\n\tpath == \"/items/admin\"\n\tmethod == \"get\"\n}\n\n" +
+				"scopes_granted if {\n\tpath == \"/items/admin\"\n\tmethod == \"get\"\n\tcount({\"admin\"} - token_scopes) == 0\n}\n",
+		},
+		{
+			name: "with policies",
+			pol: &policy.GeneralPolicies{
+				Policies: []policy.PolicyClause{
+					{RolePolicy: &policy.RolePolicy{PolicyDetail: policy.PolicyDetail{Operator: policy.OperatorOr, Value: []string{"doctor"}}}},
+				},
+				Scopes: []policy.ScopeRequirement{
+					{Path: "/drugs", Method: "get", Alternatives: [][]string{{"read:drugs"}}},
+				},
+			},
+			want: "allow_request if count({\"doctor\"} & roles) != 0\n\n" +
+				"scopes_required if {\n\tpath == \"/drugs\"\n\tmethod == \"get\"\n}\n\n" +
+				"scopes_granted if {\n\tpath == \"/drugs\"\n\tmethod == \"get\"\n\tcount({\"read:drugs\"} - token_scopes) == 0\n}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.pol.ToRego()
+			if err != nil {
+				t.Fatalf("ToRego() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
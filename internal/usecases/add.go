@@ -11,61 +11,172 @@ import (
 	"maps"
 	"os"
 	"path/filepath"
+	"regexp"
 	"slices"
+	"strings"
 	"time"
 )
 
-func AddService(serviceName string, specData []byte) error {
+// ServiceConfig collects the settings of a service that are not part of its OpenAPI spec.
+type ServiceConfig struct {
+	// Source of the data timestamp checked by timeliness policies, in the form <header|query|claim>:<name>.
+	// If empty, the generator default is used.
+	TimelinessSource string
+	// Source of the location checked by storage location policies, in the form <header|query|claim>:<name>.
+	// If empty, the generator default is used.
+	LocationSource string
+	// Audience the tokens must be issued for. If empty, any audience is accepted.
+	Audience string
+	// Clock skew tolerated when checking the validity period of the tokens, as a Go duration such as 30s.
+	// If empty, no skew is tolerated.
+	ClockSkew string
+	// Pin the keys of the identity providers in the bundle data, fetching them at generation time.
+	PinKeys bool
+	// Keys of the identity providers to pin in the bundle data, as a JSON object mapping each issuer to its JWKS.
+	// If set, the keys are pinned without fetching them.
+	PinnedKeys []byte
+	// Path prefix of the requests addressed to the service, "/" for none.
+	// If empty, it is the base path of the servers of the spec, defaulting to /<service name> if they declare none.
+	PathPrefix string
+	// Host names the requests must be addressed to. If empty, any host is accepted unless MatchHosts is set.
+	Hosts []string
+	// Match the hosts of the servers of the spec, unless Hosts is set.
+	MatchHosts bool
+	// Generate the Envoy ext_authz result object of the service besides allow.
+	ExtAuthzResult bool
+	// Actor adding the service, recorded in the history of the bundle.
+	Actor string
+}
+
+// pathPrefixPattern matches the path prefixes made of segments of unreserved, sub-delimiter, colon and at sign
+// characters, so that the prefix inferred from the spec or given by the user is a plain path.
+var pathPrefixPattern = regexp.MustCompile(`^(/[A-Za-z0-9\-._~!$&'()*+,;=:@]+)*$`)
+
+// generatorOptions builds the generator options for the service from the user provided configuration and the route
+// declared by its spec, nil if the spec declares no servers. A warning is added to diagnostics when the servers declare
+// no base path, as the service is then routed at /<service name> rather than at the root, where it would catch the
+// requests of every other service.
+func (c ServiceConfig) generatorOptions(serviceName string, route *parser.Route, diagnostics *parser.Diagnostics) (generator.ServiceOptions, error) {
+	options := generator.ServiceOptions{
+		ServiceName: serviceName,
+		PathPrefix:  "/" + serviceName,
+
+		QuotaServiceURL: config.QuotaServiceURL,
+		Audience:        c.Audience,
+		PinnedKeys:      c.PinKeys || c.PinnedKeys != nil,
+		ExtAuthzResult:  c.ExtAuthzResult,
+	}
+	if route != nil && route.PathPrefix != "" {
+		options.PathPrefix = route.PathPrefix
+	}
+	if route != nil && route.PathPrefix == "" && c.PathPrefix == "" {
+		*diagnostics = append(*diagnostics, parser.Diagnostic{
+			Severity: parser.SeverityWarning,
+			Message:  fmt.Sprintf("the servers of the spec declare no base path, the service is routed at %s: set the path prefix to / to route it at the root", options.PathPrefix),
+		})
+	}
+	if c.PathPrefix != "" {
+		options.PathPrefix = "/" + strings.Trim(c.PathPrefix, "/")
+		if options.PathPrefix == "/" {
+			options.PathPrefix = ""
+		}
+	}
+	if !pathPrefixPattern.MatchString(options.PathPrefix) {
+		return options, fmt.Errorf("invalid path prefix %q: only path characters are allowed", options.PathPrefix)
+	}
+	switch {
+	case len(c.Hosts) > 0:
+		for _, host := range c.Hosts {
+			options.Hosts = append(options.Hosts, strings.ToLower(host))
+		}
+	case c.MatchHosts:
+		if route == nil || len(route.Hosts) == 0 {
+			return options, fmt.Errorf("no host declared by the servers of the spec")
+		}
+		options.Hosts = route.Hosts
+	}
+	if c.TimelinessSource != "" {
+		source, err := generator.ParseAttributeSource(c.TimelinessSource)
+		if err != nil {
+			return options, fmt.Errorf("invalid timeliness source: %v", err)
+		}
+		options.Timeliness = source
+	}
+	if c.LocationSource != "" {
+		source, err := generator.ParseAttributeSource(c.LocationSource)
+		if err != nil {
+			return options, fmt.Errorf("invalid location source: %v", err)
+		}
+		options.Location = source
+	}
+	if c.ClockSkew != "" {
+		skew, err := time.ParseDuration(c.ClockSkew)
+		if err != nil {
+			return options, fmt.Errorf("invalid clock skew: %v", err)
+		}
+		if skew < 0 {
+			return options, fmt.Errorf("invalid clock skew: %s is negative", c.ClockSkew)
+		}
+		options.ClockSkew = skew
+	}
+	return options, nil
+}
+
+// AddService generates the policies of a service from its OpenAPI spec and adds them to the bundle.
+// It returns every problem found in the spec; if any of them is an error, the returned error is the parser.Diagnostics.
+func AddService(serviceName string, specData []byte, serviceConfig ServiceConfig) (parser.Diagnostics, error) {
+	// Parse the OpenAPI spec to extract policies, provider and route, reporting the problems of all of them at once
+	service, diagnostics := parser.ParseOpenAPIService(specData)
+	if err := diagnostics.Err(); err != nil {
+		return diagnostics, err
+	}
+	options, err := serviceConfig.generatorOptions(serviceName, service.Route, &diagnostics)
+	if err != nil {
+		return diagnostics, err
+	}
+	var keys *generator.PinnedKeys
+	if options.PinnedKeys {
+		if keys, err = pinnedKeys(serviceConfig.PinnedKeys, service.Providers); err != nil {
+			return diagnostics, err
+		}
+	}
+
 	minioRepo, err := bundle.NewMinioRepositoryFromConfig()
 	if err != nil {
-		return fmt.Errorf("error creating minio repository: %v", err)
+		return diagnostics, fmt.Errorf("error creating minio repository: %v", err)
 	}
 	ctx := context.Background()
 
 	// Verify if the bundle exists on minio
 	bundleExists, err := minioRepo.BundleExists(ctx, config.LatestBundleName)
 	if err != nil {
-		return fmt.Errorf("error checking bundle existence: %v", err)
+		return diagnostics, fmt.Errorf("error checking bundle existence: %v", err)
 	}
 	if !bundleExists {
-		return fmt.Errorf("bundle %s does not exist in Minio", config.LatestBundleName)
+		return diagnostics, fmt.Errorf("bundle %s does not exist in Minio", config.LatestBundleName)
 	}
 
 	// Load the existing bundle from Minio
 	b, err := minioRepo.Read(config.LatestBundleName)
 	if err != nil {
-		return fmt.Errorf("error loading bundle from Minio: %v", err)
+		return diagnostics, fmt.Errorf("error loading bundle from Minio: %v", err)
 	}
 
 	// Create a temporary directory for the output
 	tempDir, err := os.MkdirTemp("", "bundle-patch-*")
 	if err != nil {
-		return fmt.Errorf("error creating temp directory: %v", err)
+		return diagnostics, fmt.Errorf("error creating temp directory: %v", err)
 	}
 	regoDir := filepath.Join(tempDir, "rego")
 	err = os.MkdirAll(regoDir, os.ModePerm)
 	if err != nil {
-		return fmt.Errorf("error creating rego directory: %v", err)
-	}
-
-	// Parse the OpenAPI spec to extract policies and provider
-	policies, err := parser.ParseOpenAPIPolicies(specData)
-	if err != nil || policies == nil {
-		return fmt.Errorf("error parsing OpenAPI spec: %v", err)
-	}
-	provider, err := parser.ParseOpenAPIIAM(specData)
-	if err != nil || provider == nil {
-		return fmt.Errorf("error parsing OpenAPI provider: %v", err)
+		return diagnostics, fmt.Errorf("error creating rego directory: %v", err)
 	}
 
 	// Generate the service folder
-	options := generator.ServiceOptions{
-		ServiceName: serviceName,
-		PathPrefix:  "/" + serviceName,
-	}
-	err = generator.GenerateServiceFolder(options, regoDir, *provider, policies)
+	err = generator.GenerateServiceFolder(options, regoDir, service.Providers, service.Policies)
 	if err != nil {
-		return fmt.Errorf("error generating service folder: %v", err)
+		return diagnostics, fmt.Errorf("error generating service folder: %v", err)
 	}
 
 	// Load the regoDir folder and compose a map[string][]byte
@@ -88,36 +199,97 @@ func AddService(serviceName string, specData []byte) error {
 		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("error reading rego files: %v", err)
+		return diagnostics, fmt.Errorf("error reading rego files: %v", err)
 	}
 	fmt.Print("regoFiles: ", slices.Collect(maps.Keys(regoFiles)), "\n")
 
 	err = b.AddService(serviceName, regoFiles)
 	if err != nil {
-		return fmt.Errorf("error adding service to bundle: %v", err)
+		return diagnostics, fmt.Errorf("error adding service to bundle: %v", err)
+	}
+	if err := setRegions(b); err != nil {
+		return diagnostics, err
+	}
+	if keys != nil {
+		if err := b.SetData(generator.PinnedKeysDataPath(serviceName), keys); err != nil {
+			return diagnostics, fmt.Errorf("error adding pinned keys to bundle: %v", err)
+		}
+	}
+
+	unrouted, err := routeServices(b)
+	if err != nil {
+		return diagnostics, err
+	}
+	for _, service := range unrouted {
+		diagnostics = append(diagnostics, parser.Diagnostic{
+			Severity: parser.SeverityWarning,
+			Message:  fmt.Sprintf("service %s was added before the requests were dispatched by route and is denied every request: add it again", service),
+		})
 	}
 
 	services, err := b.Services()
 	if err != nil {
-		return fmt.Errorf("error getting services from bundle: %v", err)
+		return diagnostics, fmt.Errorf("error getting services from bundle: %v", err)
 	}
 	if err := generator.GenerateNewMain(regoDir, services); err != nil {
-		return fmt.Errorf("error generating main.rego: %v", err)
+		return diagnostics, fmt.Errorf("error generating main.rego: %v", err)
 	}
 	if err := b.LoadNewMain(filepath.Join(regoDir, "main.rego")); err != nil {
-		return fmt.Errorf("error loading new main.rego: %v", err)
+		return diagnostics, fmt.Errorf("error loading new main.rego: %v", err)
 	}
 
-	// Copy the current bundle to a backup timestamped object
-	newBundleName := config.TagBundleName(time.Now().Format("2006-01-02_15-04-05"))
-	if err := minioRepo.CopyBundle(ctx, config.LatestBundleName, newBundleName); err != nil {
-		return fmt.Errorf("error renaming bundle file: %v", err)
+	if err := publishBundle(ctx, minioRepo, b, serviceConfig.Actor); err != nil {
+		return diagnostics, err
 	}
+	slog.Info("Bundle updated successfully and uploaded to Minio", "serviceName", serviceName)
+	return diagnostics, nil
+}
 
-	// Write the updated bundle to Minio
-	if err := minioRepo.Write(config.LatestBundleName, *b); err != nil {
-		return fmt.Errorf("error writing updated bundle to Minio: %v", err)
+// routeServices replaces the policies of the static services declaring no route with the current ones, and returns
+// the other services declaring no route, which must be added again for the main policy to dispatch requests to them.
+func routeServices(b *bundle.Bundle) ([]string, error) {
+	unrouted, err := b.UnroutedServices()
+	if err != nil {
+		return nil, fmt.Errorf("error getting services from bundle: %v", err)
+	}
+	remaining := make([]string, 0, len(unrouted))
+	for _, service := range unrouted {
+		if !slices.Contains(generator.StaticServiceNames, service) {
+			remaining = append(remaining, service)
+			continue
+		}
+		files, err := generator.StaticServiceFiles(service)
+		if err != nil {
+			slog.Warn("Error reading static service", "service", service, "error", err)
+			remaining = append(remaining, service)
+			continue
+		}
+		if err := b.AddService(service, files); err != nil {
+			return nil, fmt.Errorf("error updating static service %s: %v", service, err)
+		}
+		slog.Info("Static service updated to declare its route", "service", service)
+	}
+	return remaining, nil
+}
+
+// setRegions writes the region hierarchy of the configured regions file to the bundle, or the built-in one if no file
+// is configured and the bundle has none, so that a hierarchy edited in the bundle is kept.
+func setRegions(b *bundle.Bundle) error {
+	if config.RegionsFile == "" {
+		if _, ok := b.GetData(generator.RegionsDataPath); ok {
+			return nil
+		}
+		if err := b.SetData(generator.RegionsDataPath, generator.DefaultRegions); err != nil {
+			return fmt.Errorf("error adding regions to bundle: %v", err)
+		}
+		return nil
+	}
+	regions, err := generator.LoadRegions(config.RegionsFile)
+	if err != nil {
+		return err
+	}
+	if err := b.SetData(generator.RegionsDataPath, regions); err != nil {
+		return fmt.Errorf("error adding regions to bundle: %v", err)
 	}
-	slog.Info("Bundle updated successfully and uploaded to Minio", "serviceName", serviceName)
 	return nil
 }
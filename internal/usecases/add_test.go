@@ -0,0 +1,126 @@
+package usecases
+
+import (
+	"context"
+	"dspn-regogenerator/internal/bundle"
+	"dspn-regogenerator/internal/config"
+	"dspn-regogenerator/internal/generator"
+	"dspn-regogenerator/internal/policy/parser"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGeneratorOptionsPathPrefix(t *testing.T) {
+	tests := []struct {
+		name       string
+		pathPrefix string
+		route      *parser.Route
+		want       string
+		warnings   int
+	}{
+		{name: "no servers", want: "/orders"},
+		{name: "base path of the servers", route: &parser.Route{PathPrefix: "/api/orders"}, want: "/api/orders"},
+		{name: "servers without base path", route: &parser.Route{Hosts: []string{"fdp.aquaview.ch"}}, want: "/orders", warnings: 1},
+		{name: "root prefix", pathPrefix: "/", route: &parser.Route{Hosts: []string{"fdp.aquaview.ch"}}, want: ""},
+		{name: "given prefix", pathPrefix: "shop/orders/", route: &parser.Route{PathPrefix: "/api/orders"}, want: "/shop/orders"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var diagnostics parser.Diagnostics
+			options, err := ServiceConfig{PathPrefix: test.pathPrefix}.generatorOptions("orders", test.route, &diagnostics)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if options.PathPrefix != test.want {
+				t.Errorf("expected path prefix %q, got %q", test.want, options.PathPrefix)
+			}
+			if len(diagnostics) != test.warnings || diagnostics.HasErrors() {
+				t.Errorf("expected %d warnings, got %v", test.warnings, diagnostics)
+			}
+		})
+	}
+
+	var diagnostics parser.Diagnostics
+	if _, err := (ServiceConfig{PathPrefix: "/orders/{id}"}).generatorOptions("orders", nil, &diagnostics); err == nil {
+		t.Errorf("expected an error for a prefix with template characters")
+	}
+}
+
+func TestSetRegions(t *testing.T) {
+	b, err := bundle.NewFromFS(context.Background(), fstest.MapFS{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := setRegions(b); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if regions, ok := b.GetData(generator.RegionsDataPath); !ok || !reflect.DeepEqual(regions.(map[string]interface{})["Milan"], []interface{}{"Italy"}) {
+		t.Errorf("expected the built-in regions in a bundle with none, got %v", regions)
+	}
+
+	// A hierarchy already in the bundle is kept
+	edited := map[string]interface{}{"Milan": []interface{}{"Lombardy"}, "Lombardy": []interface{}{"Italy"}}
+	if err := b.SetData(generator.RegionsDataPath, edited); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := setRegions(b); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if regions, _ := b.GetData(generator.RegionsDataPath); !reflect.DeepEqual(regions, edited) {
+		t.Errorf("expected the regions of the bundle to be kept, got %v", regions)
+	}
+
+	// The configured regions file replaces it
+	regionsFile := filepath.Join(t.TempDir(), "regions.json")
+	if err := os.WriteFile(regionsFile, []byte(`{"Zurich": ["Switzerland"], "Switzerland": ["Europe"]}`), 0644); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	previous := config.RegionsFile
+	config.RegionsFile = regionsFile
+	t.Cleanup(func() { config.RegionsFile = previous })
+	if err := setRegions(b); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := map[string]interface{}{"Zurich": []interface{}{"Switzerland"}, "Switzerland": []interface{}{"Europe"}}
+	if regions, _ := b.GetData(generator.RegionsDataPath); !reflect.DeepEqual(regions, want) {
+		t.Errorf("expected the regions of the file, got %v", regions)
+	}
+
+	config.RegionsFile = filepath.Join(t.TempDir(), "missing.json")
+	if err := setRegions(b); err == nil {
+		t.Errorf("expected an error for a missing regions file")
+	}
+}
+
+func TestRouteServices(t *testing.T) {
+	// The static services are read relative to the project root
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := os.Chdir("../.."); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	b, err := bundle.NewFromFS(context.Background(), fstest.MapFS{
+		"rego/minio/service.rego":  {Data: []byte("package minio.service\n\nallow := true\n")},
+		"rego/orders/service.rego": {Data: []byte("package orders\n\nallow := true\n")},
+	}, "minio", "orders")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	unrouted, err := routeServices(b)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(unrouted, []string{"orders"}) {
+		t.Errorf("expected only orders to be left unrouted, got %v", unrouted)
+	}
+	if unrouted, _ := b.UnroutedServices(); !reflect.DeepEqual(unrouted, []string{"orders"}) {
+		t.Errorf("expected the minio placeholder to declare its route, got %v unrouted", unrouted)
+	}
+}
@@ -0,0 +1,153 @@
+package usecases
+
+import (
+	"context"
+	"dspn-regogenerator/internal/bundle"
+	"dspn-regogenerator/internal/config"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+)
+
+// DecisionRequest is an HTTP request to decide with the policies of the latest bundle, as Envoy sends it to OPA.
+type DecisionRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Host    string            `json:"host,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Claims of a token assumed to be valid, replacing the verification of the authorization header when set
+	Claims map[string]interface{} `json:"claims,omitempty"`
+}
+
+// InvalidDecisionRequestError reports a decision request that cannot be evaluated, e.g. with a relative path.
+type InvalidDecisionRequestError struct {
+	Reason string
+}
+
+func (e InvalidDecisionRequestError) Error() string {
+	return "invalid decision request: " + e.Reason
+}
+
+// decisionMethods are the HTTP methods a decision request can have.
+var decisionMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// validate checks that the request has a known method and an absolute path, returning an InvalidDecisionRequestError
+// otherwise.
+func (r DecisionRequest) validate() error {
+	if !slices.Contains(decisionMethods, strings.ToUpper(r.Method)) {
+		return InvalidDecisionRequestError{Reason: fmt.Sprintf("unknown method %q", r.Method)}
+	}
+	if !strings.HasPrefix(r.Path, "/") {
+		return InvalidDecisionRequestError{Reason: fmt.Sprintf("path %q is not absolute", r.Path)}
+	}
+	return nil
+}
+
+// Decision is the outcome of the main policy for a request, with the human readable reasons collected by the service
+// the request is routed to.
+type Decision struct {
+	Allow   bool     `json:"allow"`
+	Service string   `json:"service,omitempty"`
+	Reason  string   `json:"reason"`
+	Reasons []string `json:"reasons"`
+}
+
+// Decide evaluates the request against the policies of the latest bundle, without sending it to the service.
+// Requests that cannot be evaluated are reported with an InvalidDecisionRequestError.
+func Decide(ctx context.Context, request DecisionRequest) (*Decision, error) {
+	if err := request.validate(); err != nil {
+		return nil, err
+	}
+	minioRepo, err := bundle.NewMinioRepositoryFromConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error creating minio repository: %v", err)
+	}
+	bundleExists, err := minioRepo.BundleExists(ctx, config.LatestBundleName)
+	if err != nil {
+		return nil, fmt.Errorf("error checking bundle existence: %v", err)
+	}
+	if !bundleExists {
+		return nil, fmt.Errorf("bundle %s not found", config.LatestBundleName)
+	}
+	b, err := minioRepo.Read(config.LatestBundleName)
+	if err != nil {
+		return nil, fmt.Errorf("error loading bundle from Minio: %v", err)
+	}
+	return decide(ctx, b, request)
+}
+
+// decide evaluates the main policy of the bundle and the reasons of the service the request is routed to. When claims
+// are given, the token of every service is replaced by a valid token with these claims.
+func decide(ctx context.Context, b *bundle.Bundle, request DecisionRequest) (*Decision, error) {
+	if err := request.validate(); err != nil {
+		return nil, err
+	}
+	headers := make(map[string]interface{}, len(request.Headers))
+	for name, value := range request.Headers {
+		headers[strings.ToLower(name)] = value
+	}
+	input := map[string]interface{}{
+		"attributes": map[string]interface{}{
+			"request": map[string]interface{}{
+				"http": map[string]interface{}{
+					"method":  strings.ToUpper(request.Method),
+					"path":    request.Path,
+					"host":    request.Host,
+					"headers": headers,
+				},
+			},
+		},
+	}
+
+	with := ""
+	if request.Claims != nil {
+		services, err := b.Services()
+		if err != nil {
+			return nil, fmt.Errorf("error getting services from bundle: %v", err)
+		}
+		token, err := ast.InterfaceToValue(map[string]interface{}{"valid": true, "payload": request.Claims})
+		if err != nil {
+			return nil, InvalidDecisionRequestError{Reason: fmt.Sprintf("invalid claims: %v", err)}
+		}
+		for _, service := range services {
+			with += fmt.Sprintf(" with data.%s.oidc.token as %v", service, token)
+		}
+	}
+	query := strings.Join([]string{
+		"allow := data.teadal.allow" + with,
+		"reason := data.teadal.reason" + with,
+		"services := {service | service := data.teadal.service}" + with,
+		"reasons := {message | some service in services; some message in data[service].reasons}" + with,
+	}, "; ")
+	rs, err := b.Query(ctx, query, input)
+	if err != nil {
+		return nil, fmt.Errorf("error evaluating policies: %v", err)
+	}
+	if len(rs) != 1 {
+		return nil, fmt.Errorf("the main policy is undefined for the request")
+	}
+	bindings := rs[0].Bindings
+
+	decision := &Decision{Reasons: []string{}}
+	decision.Allow, _ = bindings["allow"].(bool)
+	decision.Reason, _ = bindings["reason"].(string)
+	if services, ok := bindings["services"].([]interface{}); ok && len(services) > 0 {
+		decision.Service, _ = services[0].(string)
+	}
+	if reasons, ok := bindings["reasons"].([]interface{}); ok {
+		for _, reason := range reasons {
+			if message, ok := reason.(string); ok {
+				decision.Reasons = append(decision.Reasons, message)
+			}
+		}
+	}
+	sort.Strings(decision.Reasons)
+	return decision, nil
+}
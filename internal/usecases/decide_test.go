@@ -0,0 +1,36 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDecisionRequestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		request DecisionRequest
+		wantErr bool
+	}{
+		{name: "valid", request: DecisionRequest{Method: "get", Path: "/drugs"}},
+		{name: "missing method", request: DecisionRequest{Path: "/drugs"}, wantErr: true},
+		{name: "unknown method", request: DecisionRequest{Method: "FETCH", Path: "/drugs"}, wantErr: true},
+		{name: "relative path", request: DecisionRequest{Method: "GET", Path: "drugs"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.request.validate()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("expected error %v, got %v", test.wantErr, err)
+			}
+			if err != nil && !errors.As(err, &InvalidDecisionRequestError{}) {
+				t.Errorf("expected an InvalidDecisionRequestError, got %T", err)
+			}
+		})
+	}
+
+	// Invalid requests are reported before the bundle is read
+	if _, err := Decide(context.Background(), DecisionRequest{Method: "GET", Path: "drugs"}); !errors.As(err, &InvalidDecisionRequestError{}) {
+		t.Errorf("expected an InvalidDecisionRequestError, got %v", err)
+	}
+}
@@ -9,10 +9,10 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
-	"time"
 )
 
-func DeleteService(serviceName string) error {
+// DeleteService removes the policies of a service from the bundle and publishes it, recording the actor of the change.
+func DeleteService(serviceName string, actor string) error {
 	minioRepo, err := bundle.NewMinioRepositoryFromConfig()
 	if err != nil {
 		return fmt.Errorf("error creating minio repository: %v", err)
@@ -50,6 +50,14 @@ func DeleteService(serviceName string) error {
 		return fmt.Errorf("error creating rego directory: %v", err)
 	}
 
+	unrouted, err := routeServices(b)
+	if err != nil {
+		return err
+	}
+	for _, service := range unrouted {
+		slog.Warn("Service added before the requests were dispatched by route is denied every request, add it again", "service", service)
+	}
+
 	// Generate the new main.rego file
 	serviceList, err := b.Services()
 	if err != nil {
@@ -63,15 +71,8 @@ func DeleteService(serviceName string) error {
 		return fmt.Errorf("error loading new main.rego into bundle: %v", err)
 	}
 
-	// Copy the current bundle to a backup timestamped object
-	newBundleName := config.TagBundleName(time.Now().Format("2006-01-02_15-04-05"))
-	if err := minioRepo.CopyBundle(ctx, config.LatestBundleName, newBundleName); err != nil {
-		return fmt.Errorf("error renaming bundle file: %v", err)
-	}
-
-	// Save the new bundle to Minio
-	if err := minioRepo.Write(config.LatestBundleName, *b); err != nil {
-		return fmt.Errorf("error saving new bundle to Minio: %v", err)
+	if err := publishBundle(ctx, minioRepo, b, actor); err != nil {
+		return err
 	}
 
 	slog.Info("Successfully deleted policies for service", "service", serviceName)
@@ -0,0 +1,36 @@
+package usecases
+
+import (
+	"context"
+	"dspn-regogenerator/internal/bundle"
+	"dspn-regogenerator/internal/config"
+	"fmt"
+)
+
+// DiffBundles compares the versions of the bundle with the tags, as listed by History, returning the changes from
+// the first one to the second one.
+func DiffBundles(tagA string, tagB string) (*bundle.Changes, error) {
+	minioRepo, err := bundle.NewMinioRepositoryFromConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error creating minio repository: %v", err)
+	}
+	ctx := context.Background()
+
+	bundles := make([]*bundle.Bundle, 0, 2)
+	for _, tag := range []string{tagA, tagB} {
+		bundleName := config.TagBundleName(tag)
+		bundleExists, err := minioRepo.BundleExists(ctx, bundleName)
+		if err != nil {
+			return nil, fmt.Errorf("error checking bundle existence: %v", err)
+		}
+		if !bundleExists {
+			return nil, fmt.Errorf("bundle %s not found", bundleName)
+		}
+		b, err := minioRepo.Read(bundleName)
+		if err != nil {
+			return nil, fmt.Errorf("error loading bundle %s from Minio: %v", bundleName, err)
+		}
+		bundles = append(bundles, b)
+	}
+	return bundle.Diff(bundles[0], bundles[1])
+}
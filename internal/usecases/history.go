@@ -0,0 +1,113 @@
+package usecases
+
+import (
+	"context"
+	"dspn-regogenerator/internal/bundle"
+	"dspn-regogenerator/internal/config"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// LatestTag is the tag of the latest bundle, the one loaded by OPA.
+const LatestTag = "LATEST"
+
+// BundleVersion describes a version of the bundle stored in Minio, identified by its tag: LATEST or the timestamp of
+// the backup.
+type BundleVersion struct {
+	Tag string `json:"tag"`
+	bundle.HistoryEntry
+}
+
+// publishBundle backs up the latest bundle to a timestamped object, then replaces it with the bundle, stamped with a
+// new revision recording the actor of the change and signed with the configured keys. The expired backups are then
+// deleted.
+func publishBundle(ctx context.Context, minioRepo *bundle.MinioRepository, b *bundle.Bundle, actor string) error {
+	// Copy the current bundle to a backup timestamped object
+	newBundleName := config.TagBundleName(time.Now().Format(backupTagLayout))
+	if err := minioRepo.CopyBundle(ctx, config.LatestBundleName, newBundleName); err != nil {
+		return fmt.Errorf("error renaming bundle file: %v", err)
+	}
+
+	// Write the updated bundle to Minio
+	if err := b.Stamp(actor); err != nil {
+		return fmt.Errorf("error stamping bundle: %v", err)
+	}
+	if err := b.Sign(bundle.NewSigningKeysFromConfig()); err != nil {
+		return err
+	}
+	if err := minioRepo.Write(config.LatestBundleName, *b); err != nil {
+		return fmt.Errorf("error writing updated bundle to Minio: %v", err)
+	}
+	enforceRetention(ctx, minioRepo)
+	return nil
+}
+
+// History lists the versions of the bundle stored in Minio, from the most recent one.
+func History() ([]BundleVersion, error) {
+	minioRepo, err := bundle.NewMinioRepositoryFromConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error creating minio repository: %v", err)
+	}
+	return history(context.Background(), minioRepo)
+}
+
+func history(ctx context.Context, minioRepo *bundle.MinioRepository) ([]BundleVersion, error) {
+	entries, err := minioRepo.History(ctx, bundlePrefix())
+	if err != nil {
+		return nil, fmt.Errorf("error listing bundles: %v", err)
+	}
+	versions := make([]BundleVersion, 0, len(entries))
+	for _, entry := range entries {
+		versions = append(versions, BundleVersion{Tag: bundleTag(entry.Name), HistoryEntry: entry})
+	}
+	return versions, nil
+}
+
+// bundlePrefix returns the prefix of the names of the versions of the bundle, followed by their tag.
+func bundlePrefix() string {
+	return strings.TrimSuffix(config.TagBundleName(""), ".tar.gz")
+}
+
+// bundleTag returns the tag of the version of the bundle with the name.
+func bundleTag(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(name, bundlePrefix()), ".tar.gz")
+}
+
+// Rollback replaces the latest bundle with the version with the tag. The latest bundle is backed up first, and the
+// rollback is recorded as a new revision, so it can be rolled back in turn.
+func Rollback(tag string, actor string) error {
+	if tag == LatestTag {
+		return fmt.Errorf("cannot roll back to the latest bundle")
+	}
+	minioRepo, err := bundle.NewMinioRepositoryFromConfig()
+	if err != nil {
+		return fmt.Errorf("error creating minio repository: %v", err)
+	}
+	ctx := context.Background()
+
+	bundleName := config.TagBundleName(tag)
+	bundleExists, err := minioRepo.BundleExists(ctx, bundleName)
+	if err != nil {
+		return fmt.Errorf("error checking bundle existence: %v", err)
+	}
+	if !bundleExists {
+		return fmt.Errorf("bundle %s not found", bundleName)
+	}
+	b, err := minioRepo.Read(bundleName)
+	if err != nil {
+		return fmt.Errorf("error loading bundle %s from Minio: %v", bundleName, err)
+	}
+	latest, err := minioRepo.Read(config.LatestBundleName)
+	if err != nil {
+		return fmt.Errorf("error loading bundle from Minio: %v", err)
+	}
+
+	b.PrepareRollback(latest, bundleName)
+	if err := publishBundle(ctx, minioRepo, b, actor); err != nil {
+		return err
+	}
+	slog.Info("Bundle rolled back successfully", "tag", tag)
+	return nil
+}
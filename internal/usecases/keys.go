@@ -0,0 +1,82 @@
+package usecases
+
+import (
+	"context"
+	"dspn-regogenerator/internal/bundle"
+	"dspn-regogenerator/internal/config"
+	"dspn-regogenerator/internal/generator"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// pinnedKeys returns the keys to pin for the identity providers: the provided keys if any, otherwise the ones
+// fetched from the providers within the configured timeout.
+func pinnedKeys(keysData []byte, providers []string) (*generator.PinnedKeys, error) {
+	if keysData != nil {
+		keys, err := generator.ParsePinnedKeys(keysData, providers)
+		if err != nil {
+			return nil, fmt.Errorf("error reading pinned keys: %v", err)
+		}
+		return keys, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.KeysFetchTimeout)*time.Second)
+	defer cancel()
+	keys, err := generator.FetchPinnedKeys(ctx, providers)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching keys to pin: %v", err)
+	}
+	return keys, nil
+}
+
+// RefreshPinnedKeys replaces the keys pinned in the bundle for a service, fetching them again from its identity
+// providers or, if keysData is not nil, reading them from it. The updated bundle is then published, recording the actor
+// of the change.
+func RefreshPinnedKeys(serviceName string, keysData []byte, actor string) error {
+	minioRepo, err := bundle.NewMinioRepositoryFromConfig()
+	if err != nil {
+		return fmt.Errorf("error creating minio repository: %v", err)
+	}
+	ctx := context.Background()
+
+	bundleExists, err := minioRepo.BundleExists(ctx, config.LatestBundleName)
+	if err != nil {
+		return fmt.Errorf("error checking bundle existence: %v", err)
+	}
+	if !bundleExists {
+		return fmt.Errorf("bundle %s not found", config.LatestBundleName)
+	}
+	b, err := minioRepo.Read(config.LatestBundleName)
+	if err != nil {
+		return fmt.Errorf("error loading bundle from Minio: %v", err)
+	}
+
+	// The discovery urls of the providers are stored with the keys when the service is added
+	value, ok := b.GetData(generator.PinnedKeysDataPath(serviceName))
+	if !ok {
+		return fmt.Errorf("service %s does not pin the keys of its identity providers", serviceName)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error reading pinned keys: %v", err)
+	}
+	var current generator.PinnedKeys
+	if err := json.Unmarshal(encoded, &current); err != nil {
+		return fmt.Errorf("error reading pinned keys: %v", err)
+	}
+
+	keys, err := pinnedKeys(keysData, current.MetadataURLs)
+	if err != nil {
+		return err
+	}
+	if err := b.SetData(generator.PinnedKeysDataPath(serviceName), keys); err != nil {
+		return fmt.Errorf("error adding pinned keys to bundle: %v", err)
+	}
+
+	if err := publishBundle(ctx, minioRepo, b, actor); err != nil {
+		return err
+	}
+	slog.Info("Pinned keys refreshed successfully", "serviceName", serviceName, "issuers", len(keys.Issuers))
+	return nil
+}
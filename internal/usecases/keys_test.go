@@ -0,0 +1,30 @@
+package usecases
+
+import (
+	"dspn-regogenerator/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPinnedKeysTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	previous := config.KeysFetchTimeout
+	config.KeysFetchTimeout = 1
+	t.Cleanup(func() { config.KeysFetchTimeout = previous })
+
+	start := time.Now()
+	if _, err := pinnedKeys(nil, []string{server.URL + "/.well-known/openid-configuration"}); err == nil {
+		t.Fatalf("expected an error for an identity provider not responding")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the fetch to give up after the timeout, took %v", elapsed)
+	}
+}
@@ -0,0 +1,85 @@
+package usecases
+
+import (
+	"context"
+	"dspn-regogenerator/internal/bundle"
+	"dspn-regogenerator/internal/config"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// backupTagLayout is the layout of the timestamp tagging the backups of the latest bundle.
+const backupTagLayout = "2006-01-02_15-04-05"
+
+// RetentionFromConfig returns the retention policy of the backups of the package configuration.
+func RetentionFromConfig() bundle.RetentionPolicy {
+	return bundle.RetentionPolicy{
+		KeepLast: config.BundleRetentionCount,
+		KeepFor:  time.Duration(config.BundleRetentionDays) * 24 * time.Hour,
+	}
+}
+
+// Prune deletes the timestamped backups of the bundle expired by the retention policy, or only lists them if dryRun
+// is set. The latest bundle and the tagged releases, whose tag is not a timestamp, are always kept. The backups are
+// selected from the object listing, without reading them, so they are only described by their name and tag.
+func Prune(retention bundle.RetentionPolicy, dryRun bool) ([]BundleVersion, error) {
+	minioRepo, err := bundle.NewMinioRepositoryFromConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error creating minio repository: %v", err)
+	}
+	return prune(context.Background(), minioRepo, retention, dryRun)
+}
+
+func prune(ctx context.Context, minioRepo *bundle.MinioRepository, retention bundle.RetentionPolicy, dryRun bool) ([]BundleVersion, error) {
+	expired := []BundleVersion{}
+	if retention.Unlimited() {
+		return expired, nil
+	}
+	bundles, err := minioRepo.ListBundles(ctx, bundlePrefix())
+	if err != nil {
+		return nil, fmt.Errorf("error listing bundles: %v", err)
+	}
+	for _, version := range expiredBackups(bundles, retention, time.Now()) {
+		if !dryRun {
+			if err := minioRepo.DeleteBundle(ctx, version.Name); err != nil {
+				return expired, err
+			}
+		}
+		expired = append(expired, version)
+	}
+	return expired, nil
+}
+
+// expiredBackups returns the timestamped backups among the listed bundles that are expired by the retention policy at
+// the given time. Backups are aged and ordered by the timestamp of their tag, i.e. when they were taken, rather than
+// by the time they were stored.
+func expiredBackups(bundles []bundle.Backup, retention bundle.RetentionPolicy, now time.Time) []BundleVersion {
+	backups := []bundle.Backup{}
+	for _, b := range bundles {
+		taken, err := time.ParseInLocation(backupTagLayout, bundleTag(b.Name), time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, bundle.Backup{Name: b.Name, Time: taken})
+	}
+
+	expired := []BundleVersion{}
+	for _, backup := range retention.Expired(backups, now) {
+		entry := bundle.HistoryEntry{Name: backup.Name, Timestamp: backup.Time, Services: []string{}}
+		expired = append(expired, BundleVersion{Tag: bundleTag(backup.Name), HistoryEntry: entry})
+	}
+	return expired
+}
+
+// enforceRetention deletes the backups expired by the configured retention policy. As the bundle is already written,
+// failures are only logged.
+func enforceRetention(ctx context.Context, minioRepo *bundle.MinioRepository) {
+	expired, err := prune(ctx, minioRepo, RetentionFromConfig(), false)
+	if err != nil {
+		slog.Error("Error enforcing bundle retention", "error", err)
+	}
+	if len(expired) > 0 {
+		slog.Info("Expired bundle backups deleted", "count", len(expired))
+	}
+}
@@ -0,0 +1,33 @@
+package usecases
+
+import (
+	"dspn-regogenerator/internal/bundle"
+	"dspn-regogenerator/internal/config"
+	"testing"
+	"time"
+)
+
+func TestExpiredBackups(t *testing.T) {
+	now := time.Date(2025, 6, 30, 12, 0, 0, 0, time.Local)
+	backup := func(taken time.Time, stored time.Time) bundle.Backup {
+		return bundle.Backup{Name: config.TagBundleName(taken.Format(backupTagLayout)), Time: stored}
+	}
+	// The backup taken by the last write was stored, e.g. restored from another bucket, long after it was taken
+	recent := backup(now.Add(-time.Minute), now.AddDate(0, -3, 0))
+	old := backup(now.AddDate(0, 0, -10), now)
+	bundles := []bundle.Backup{
+		{Name: config.TagBundleName(LatestTag), Time: now},
+		old,
+		{Name: config.TagBundleName("v1.0"), Time: now.AddDate(-1, 0, 0)},
+		recent,
+	}
+
+	expired := expiredBackups(bundles, bundle.RetentionPolicy{KeepFor: 7 * 24 * time.Hour}, now)
+	if len(expired) != 1 || expired[0].Name != old.Name || expired[0].Tag != now.AddDate(0, 0, -10).Format(backupTagLayout) {
+		t.Errorf("expected only the backup taken 10 days ago to expire, got %v", expired)
+	}
+	expired = expiredBackups(bundles, bundle.RetentionPolicy{KeepLast: 1}, now)
+	if len(expired) != 1 || expired[0].Name != old.Name {
+		t.Errorf("expected the most recently taken backup to be kept, got %v", expired)
+	}
+}
@@ -24,7 +24,7 @@ import data.testBundle.oidc
 import data.testBundle
 
 test_expected_metadata if {
-    oidc.metadata_url != null
+    count(oidc.metadata_urls) > 0
 }
 
 test_allow_get_bearer if {
@@ -37,7 +37,7 @@ test_allow_get_bearer if {
             }
         }
     } with input.attributes.request.http as {
-        "path": "/bearer",
+        "path": "/testBundle/bearer",
         "method": "get",
     }
 }`
@@ -82,14 +82,10 @@ func InitialTest(ctx context.Context) error {
 		}
 
 		// Parse the OpenAPI spec to extract policies and provider
-		policies, err := parser.ParseOpenAPIPolicies(specData)
-		if err != nil || policies == nil {
+		service, diagnostics := parser.ParseOpenAPIService(specData)
+		if err := diagnostics.Err(); err != nil {
 			return fmt.Errorf("error parsing OpenAPI spec: %w", err)
 		}
-		provider, err := parser.ParseOpenAPIIAM(specData)
-		if err != nil || provider == nil {
-			return fmt.Errorf("error parsing OpenAPI provider: %w", err)
-		}
 
 		// Create a temporary directory for the output
 		tempDir, err := os.MkdirTemp("", "bundle-*")
@@ -105,12 +101,12 @@ func InitialTest(ctx context.Context) error {
 		// Generate the static folder
 		generator.GenerateStaticFolders(regoDir)
 
-		// Generate the service folder
-		options := generator.ServiceOptions{
-			ServiceName: serviceName,
-			PathPrefix:  "/httpbin",
+		// Generate the service folder, routed as an added service with the default configuration
+		options, err := ServiceConfig{}.generatorOptions(serviceName, service.Route, &diagnostics)
+		if err != nil {
+			return fmt.Errorf("error configuring service: %w", err)
 		}
-		err = generator.GenerateServiceFolder(options, regoDir, *provider, policies)
+		err = generator.GenerateServiceFolder(options, regoDir, service.Providers, service.Policies)
 		if err != nil {
 			return fmt.Errorf("error generating service folder: %w", err)
 		}
@@ -134,6 +130,15 @@ func InitialTest(ctx context.Context) error {
 		if err != nil {
 			return fmt.Errorf("error building bundle: %w", err)
 		}
+		if err := setRegions(b); err != nil {
+			return err
+		}
+		if err := b.Stamp(""); err != nil {
+			return fmt.Errorf("error stamping bundle: %w", err)
+		}
+		if err := b.Sign(bundle.NewSigningKeysFromConfig()); err != nil {
+			return err
+		}
 		if err := minioRepo.Write(config.LatestBundleName, *b); err != nil {
 			return fmt.Errorf("error writing bundle to Minio: %w", err)
 		}
@@ -141,13 +146,13 @@ func InitialTest(ctx context.Context) error {
 	}
 
 	// Download the bundle from MinIO
-	bundlePath, err := minioRepo.Read(config.LatestBundleName)
+	archive, err := minioRepo.ReadArchive(config.LatestBundleName)
 	if err != nil {
 		return fmt.Errorf("error downloading bundle from MinIO: %w", err)
 	}
 	testBundlePath := filepath.Join(os.TempDir(), config.LatestBundleName)
 	fsRepo := bundle.NewFileSystemRepository(filepath.Dir(testBundlePath))
-	if err := fsRepo.Write(config.LatestBundleName, *bundlePath); err != nil {
+	if err := fsRepo.WriteArchive(config.LatestBundleName, archive); err != nil {
 		return fmt.Errorf("error writing bundle to file: %w", err)
 	}
 
@@ -0,0 +1,27 @@
+package usecases
+
+import (
+	"context"
+	"dspn-regogenerator/internal/bundle"
+	"fmt"
+	"os"
+)
+
+// VerifyBundleFile verifies the signature of a bundle archive, e.g. downloaded manually from the repository, and
+// returns the services of the bundle.
+func VerifyBundleFile(path string, signingKeys *bundle.SigningKeys) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening bundle: %v", err)
+	}
+	defer file.Close()
+	b, err := bundle.NewVerifiedFromArchive(context.Background(), file, signingKeys)
+	if err != nil {
+		return nil, fmt.Errorf("bundle verification failed: %v", err)
+	}
+	services, err := b.Services()
+	if err != nil {
+		return nil, fmt.Errorf("error getting services from bundle: %v", err)
+	}
+	return services, nil
+}
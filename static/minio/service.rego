@@ -2,14 +2,19 @@
 # Placeholder policy for MinIO.
 #
 
-package minio.service
+package minio
 
 import rego.v1
 
 import input.attributes.request.http as http_request
 
+# Route of the placeholder, so that the main policy only dispatches the MinIO requests to it
+route := {"prefix": "/minio", "hosts": []}
+
+default route_matched := false
+
+route_matched if startswith(http_request.path, "/minio/")
+
 default allow := false
 
-allow if {
-	regex.match("^/minio/.*", http_request.path)
-}
+allow if route_matched